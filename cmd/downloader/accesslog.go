@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"gorm.io/gorm"
+)
+
+const (
+	accessLogBuffer       = 10000
+	accessLogFlushTimeout = 10 * time.Second
+	maxUserAgentLength    = 512
+)
+
+type DownloadAccess struct {
+	ID          uint      `gorm:"primaryKey"`
+	Token       string    `gorm:"index:idx_download_accesses_token_created,priority:1;not null"`
+	Route       string    `gorm:"not null"`
+	Artifact    string    `gorm:"not null"`
+	Disposition string    `gorm:"not null"`
+	ClientIP    string    `gorm:"column:client_ip"`
+	UserAgent   string    `gorm:"size:512"`
+	Status      int       `gorm:"not null"`
+	BytesSent   int64     `gorm:"not null;default:0"`
+	Result      string    `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"index:idx_download_accesses_token_created,priority:2"`
+}
+
+// accessLogWriter batches DownloadAccess rows in memory and inserts them from
+// a single goroutine, so request handlers never wait on PostgreSQL. When the
+// buffer is full new entries are dropped and counted rather than blocking.
+type accessLogWriter struct {
+	db        *gorm.DB
+	entries   chan DownloadAccess
+	batchSize int
+	interval  time.Duration
+}
+
+var accessLog *accessLogWriter
+
+func newAccessLogWriter(db *gorm.DB, batchSize int, interval time.Duration) *accessLogWriter {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &accessLogWriter{
+		db:        db,
+		entries:   make(chan DownloadAccess, accessLogBuffer),
+		batchSize: batchSize,
+		interval:  interval,
+	}
+}
+
+func (a *accessLogWriter) Record(entry DownloadAccess) {
+	if a == nil {
+		return
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	select {
+	case a.entries <- entry:
+	default:
+		appmetrics.DownloadAccessLog.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run writes batches until ctx is cancelled, then flushes whatever is still
+// buffered. Cancel ctx only after the HTTP server has stopped.
+func (a *accessLogWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	batch := make([]DownloadAccess, 0, a.batchSize)
+	for {
+		select {
+		case entry := <-a.entries:
+			batch = append(batch, entry)
+			if len(batch) >= a.batchSize {
+				batch = a.flush(batch)
+			}
+		case <-ticker.C:
+			batch = a.flush(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-a.entries:
+					batch = append(batch, entry)
+					if len(batch) >= a.batchSize {
+						batch = a.flush(batch)
+					}
+				default:
+					a.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *accessLogWriter) flush(batch []DownloadAccess) []DownloadAccess {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), accessLogFlushTimeout)
+	defer cancel()
+
+	depStart := time.Now()
+	err := a.db.WithContext(ctx).CreateInBatches(batch, a.batchSize).Error
+	appmetrics.ObserveDependency("downloader", "postgres", "access_log_insert", depStart, err)
+	if err != nil {
+		appmetrics.DownloadAccessLog.WithLabelValues("error").Add(float64(len(batch)))
+		log.Printf("Access log insert of %d entries failed: %v", len(batch), err)
+	} else {
+		appmetrics.DownloadAccessLog.WithLabelValues("success").Add(float64(len(batch)))
+	}
+	return batch[:0]
+}
+
+// accessResponseWriter remembers the status and body size of a response for
+// the access log.
+type accessResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func newDownloadAccess(r *http.Request, w *accessResponseWriter, route, token, artifact, disposition, result string) DownloadAccess {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	userAgent = strings.ToValidUTF8(userAgent, "")
+	return DownloadAccess{
+		Token:       token,
+		Route:       route,
+		Artifact:    artifact,
+		Disposition: disposition,
+		ClientIP:    trustedProxies.ClientIP(r),
+		UserAgent:   userAgent,
+		Status:      status,
+		BytesSent:   w.bytes,
+		Result:      result,
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDownloadAccessCapturesResponse(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/view/token?signed=1", nil)
+	req.Header.Set("User-Agent", strings.Repeat("a", maxUserAgentLength+10))
+	aw := &accessResponseWriter{ResponseWriter: httptest.NewRecorder()}
+	aw.WriteHeader(http.StatusPartialContent)
+	_, _ = aw.Write([]byte("0123"))
+
+	entry := newDownloadAccess(req, aw, "/view/{token}", "token", "signed", "inline", "partial")
+
+	if entry.Status != http.StatusPartialContent || entry.BytesSent != 4 {
+		t.Fatalf("unexpected response capture: %+v", entry)
+	}
+	if len(entry.UserAgent) != maxUserAgentLength {
+		t.Fatalf("expected user agent to be truncated, got %d bytes", len(entry.UserAgent))
+	}
+	if entry.Artifact != "signed" || entry.Disposition != "inline" || entry.Result != "partial" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+}
+
+func TestAccessLogRecordNeverBlocks(t *testing.T) {
+	writer := newAccessLogWriter(nil, 10, time.Second)
+	for i := 0; i < accessLogBuffer+5; i++ {
+		writer.Record(DownloadAccess{Token: "token"})
+	}
+	if len(writer.entries) != accessLogBuffer {
+		t.Fatalf("expected buffer to be full, got %d", len(writer.entries))
+	}
+
+	var disabled *accessLogWriter
+	disabled.Record(DownloadAccess{Token: "token"})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+)
+
+type Document struct {
+	Token        string `gorm:"primaryKey"`
+	OriginalName string
+	S3Key        string
+	MimeType     string
+	MaxDownloads int
+	ViewOnly     bool
+	ExpiresAt    *time.Time
+	RevokedAt    *time.Time
+	CreatedAt    time.Time
+	// DownloadsUsed and MeteredBytes copy the Redis counters of limited
+	// tokens, so restoring doc:<token> does not reset max_downloads.
+	DownloadsUsed int
+	MeteredBytes  int64
+}
+
+var documentRetention time.Duration
+
+func (d Document) fileMeta() FileMeta {
+	return FileMeta{
+		OriginalName: d.OriginalName,
+		S3Key:        d.S3Key,
+		MimeType:     d.MimeType,
+		Policy:       tokenpolicy.Policy{MaxDownloads: d.MaxDownloads, ViewOnly: d.ViewOnly, ExpiresAt: d.ExpiresAt},
+	}
+}
+
+func (d Document) usage() tokenpolicy.Usage {
+	return tokenpolicy.Usage{Downloads: d.DownloadsUsed, MeteredBytes: d.MeteredBytes}
+}
+
+// retained reports whether the signed copy of the document may still be
+// served after its link has expired.
+func (d Document) retained(now time.Time) bool {
+	return documentRetention > 0 && now.Before(d.CreatedAt.Add(documentRetention))
+}
+
+// authorizeToken runs the Redis policy check and falls back to the documents
+// table when the doc:<token> cache entry is gone. Live links are written back
+// to Redis and re-authorized. Expired links only serve the signed copy for the
+// retention period, without download counting. The returned bool tells the
+// caller whether the request was counted against the download limit.
+func authorizeToken(ctx context.Context, rdb *redis.Client, token string, route tokenpolicy.Route, count, signed bool) (string, tokenpolicy.Decision, bool, error) {
+	depStart := time.Now()
+	val, decision, err := tokenpolicy.Authorize(ctx, rdb, token, route, count)
+	appmetrics.ObserveDependency("downloader", "redis", "token_authorize", depStart, err)
+	if err != nil || decision != tokenpolicy.Missing || db == nil {
+		return val, decision, count, err
+	}
+
+	var doc Document
+	depStart = time.Now()
+	err = db.WithContext(ctx).First(&doc, "token = ?", token).Error
+	appmetrics.ObserveDependency("downloader", "postgres", "document_lookup", depStart, err)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", tokenpolicy.Missing, count, nil
+	}
+	if err != nil {
+		return "", "", count, err
+	}
+	if doc.RevokedAt != nil {
+		return "", tokenpolicy.Revoked, count, nil
+	}
+
+	data, err := json.Marshal(doc.fileMeta())
+	if err != nil {
+		return "", "", count, err
+	}
+	now := time.Now().UTC()
+	if ttl := doc.fileMeta().TTL(now, doc.CreatedAt); ttl > 0 {
+		depStart = time.Now()
+		err = tokenpolicy.Restore(ctx, rdb, token, string(data), ttl, doc.usage())
+		appmetrics.ObserveDependency("downloader", "redis", "token_restore", depStart, err)
+		if err != nil {
+			return "", "", count, err
+		}
+		depStart = time.Now()
+		val, decision, err = tokenpolicy.Authorize(ctx, rdb, token, route, count)
+		appmetrics.ObserveDependency("downloader", "redis", "token_authorize", depStart, err)
+		return val, decision, count, err
+	}
+
+	if !signed || !doc.retained(now) {
+		return "", tokenpolicy.Missing, false, nil
+	}
+	if route == tokenpolicy.RouteDownload && doc.ViewOnly {
+		return "", tokenpolicy.ViewOnly, false, nil
+	}
+	return string(data), tokenpolicy.Allowed, false, nil
+}
+
+// recordUsage copies the Redis counters of a limited token into its documents
+// row. downloads_used only grows, so a write racing a newer one cannot hand
+// back a download that was already used.
+func recordUsage(ctx context.Context, rdb *redis.Client, token string) {
+	if db == nil {
+		return
+	}
+	usage, err := tokenpolicy.ReadUsage(ctx, rdb, token)
+	if err != nil {
+		log.Printf("Usage read failed for %s: %v", logutil.MaskToken(token), err)
+		return
+	}
+	depStart := time.Now()
+	err = db.WithContext(ctx).Model(&Document{}).Where("token = ?", token).Updates(map[string]any{
+		"downloads_used": gorm.Expr("GREATEST(downloads_used, ?)", usage.Downloads),
+		"metered_bytes":  usage.MeteredBytes,
+	}).Error
+	appmetrics.ObserveDependency("downloader", "postgres", "usage_update", depStart, err)
+	if err != nil {
+		log.Printf("Usage update failed for %s: %v", logutil.MaskToken(token), err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/linksign"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+)
+
+// serveSignedLink answers /link/<token> URLs issued with linksign. The link
+// itself carries the artifact, disposition and expiry; the documents table
+// locates the file and decides revocation and view_only, and limited tokens
+// are counted in Redis like /download and /view.
+func serveSignedLink(w http.ResponseWriter, r *http.Request, keys *linksign.KeySet, rdb *redis.Client, s3c *s3.Client, downloadPresigner, viewPresigner *s3.PresignClient, bucket string) {
+	signedLabel := "false"
+	if r.URL.Query().Get("a") == string(linksign.Signed) {
+		signedLabel = "true"
+	}
+	aw := &accessResponseWriter{ResponseWriter: w}
+	w = aw
+	token := ""
+	var link linksign.Link
+	result := "error"
+	defer func() {
+		appmetrics.DownloadRequests.WithLabelValues("/link/{token}", signedLabel, result).Inc()
+		if token != "" {
+			accessLog.Record(newDownloadAccess(r, aw, "/link/{token}", token, string(link.Artifact), string(link.Disposition), result))
+		}
+	}()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		result = "method_not_allowed"
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pathToken := strings.TrimPrefix(r.URL.Path, linksign.PathPrefix)
+	if pathToken == "" || strings.Contains(pathToken, "/") {
+		result = "bad_request"
+		http.Error(w, "Token required", http.StatusBadRequest)
+		return
+	}
+
+	link, err := keys.Verify(pathToken, r.URL.Query(), time.Now())
+	if errors.Is(err, linksign.ErrExpired) {
+		result = "link_expired"
+		http.Error(w, "Link expired", http.StatusGone)
+		return
+	}
+	if err != nil {
+		result = "invalid_signature"
+		http.Error(w, "Invalid link signature", http.StatusForbidden)
+		return
+	}
+	token = pathToken
+
+	lookupStart := time.Now()
+	var doc Document
+	depStart := time.Now()
+	err = db.WithContext(r.Context()).First(&doc, "token = ?", token).Error
+	appmetrics.ObserveDependency("downloader", "postgres", "document_lookup", depStart, err)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		result = "not_found"
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		http.Error(w, "Link expired or invalid", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		log.Printf("Document lookup failed for %s: %v", logutil.MaskToken(token), err)
+		http.Error(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if status, refused, message := checkLinkDocument(doc, link, time.Now()); refused != "" {
+		result = refused
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		http.Error(w, message, status)
+		return
+	}
+
+	presigner := downloadPresigner
+	policyRoute := tokenpolicy.RouteDownload
+	if link.Disposition == linksign.Inline {
+		presigner = viewPresigner
+		policyRoute = tokenpolicy.RouteView
+	}
+	if doc.MaxDownloads > 0 {
+		_, decision, counted, err := authorizeToken(r.Context(), rdb, token, policyRoute, countsAsDownload(r, presigner != nil), link.Artifact == linksign.Signed)
+		if err != nil {
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			log.Printf("Token lookup failed for %s: %v", logutil.MaskToken(token), err)
+			http.Error(w, "Metadata lookup failed", http.StatusInternalServerError)
+			return
+		}
+		switch decision {
+		case tokenpolicy.Missing:
+			result = "link_expired"
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			http.Error(w, "Link expired", http.StatusGone)
+			return
+		case tokenpolicy.Revoked:
+			result = "revoked"
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			http.Error(w, "Link has been revoked", http.StatusGone)
+			return
+		case tokenpolicy.ViewOnly:
+			result = "view_only"
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			http.Error(w, "This link can only be viewed", http.StatusForbidden)
+			return
+		case tokenpolicy.Exhausted:
+			result = "limit_reached"
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			http.Error(w, "Download limit reached", http.StatusGone)
+			return
+		}
+		defer func() {
+			settleDownload(rdb, token, aw, counted, result)
+		}()
+	}
+
+	meta := doc.fileMeta()
+	if link.Artifact == linksign.Signed {
+		if status := useSignedArtifact(r.Context(), token, &meta); status != http.StatusOK {
+			message := "DB error"
+			if status == http.StatusNotFound {
+				result = "not_found"
+				message = "Signed document not found"
+			}
+			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+			http.Error(w, message, status)
+			return
+		}
+	}
+	appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, "success").Observe(time.Since(lookupStart).Seconds())
+
+	result = deliverFile(w, r, s3c, presigner, bucket, meta, string(link.Disposition), token, signedLabel)
+}
+
+// checkLinkDocument applies the document's own policy to a signed link. Links
+// to the signed copy are bounded by their own exp and DOCUMENT_RETENTION, like
+// /download?signed=1; links to the original may not outlive the token. It
+// returns the status, result and message to refuse with, or an empty result.
+func checkLinkDocument(doc Document, link linksign.Link, now time.Time) (int, string, string) {
+	expired := doc.ExpiresAt != nil && !now.Before(*doc.ExpiresAt)
+	if link.Artifact == linksign.Signed && documentRetention > 0 {
+		expired = !doc.retained(now)
+	}
+	switch {
+	case doc.RevokedAt != nil:
+		return http.StatusGone, "revoked", "Link has been revoked"
+	case expired:
+		return http.StatusGone, "link_expired", "Link expired"
+	case doc.ViewOnly && link.Disposition == linksign.Attachment:
+		return http.StatusForbidden, "view_only", "This link can only be viewed"
+	}
+	return http.StatusOK, "", ""
+}
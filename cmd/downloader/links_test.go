@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/linksign"
+)
+
+func TestServeSignedLinkRejectsBeforeLookup(t *testing.T) {
+	keys, err := linksign.ParseKeys([]string{"k1:0000000000000000000000000000000000000000000000000000000000000001"})
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	link := linksign.Link{Token: "abc-token", Artifact: linksign.Signed, Disposition: linksign.Inline, ExpiresAt: time.Now().Add(-time.Minute)}
+	live := link
+	live.ExpiresAt = time.Now().Add(time.Hour)
+	tampered := keys.Sign(live)
+	tampered.Set("d", string(linksign.Attachment))
+
+	cases := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"expired", keys.Path(link), http.StatusGone},
+		{"tampered", "/link/abc-token?" + tampered.Encode(), http.StatusForbidden},
+		{"unsigned", "/link/abc-token?a=signed&d=inline&exp=9999999999", http.StatusForbidden},
+		{"missing token", "/link/", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		serveSignedLink(rec, httptest.NewRequest(http.MethodGet, tc.path, nil), keys, nil, nil, nil, nil, "docs")
+		if rec.Code != tc.status {
+			t.Errorf("%s: got %d, want %d", tc.name, rec.Code, tc.status)
+		}
+	}
+}
+
+func TestCheckLinkDocument(t *testing.T) {
+	previousRetention := documentRetention
+	defer func() { documentRetention = previousRetention }()
+	documentRetention = 720 * time.Hour
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	recent, old := now.Add(-48*time.Hour), now.Add(-1000*time.Hour)
+	inline := linksign.Link{Artifact: linksign.Original, Disposition: linksign.Inline}
+	attachment := linksign.Link{Artifact: linksign.Original, Disposition: linksign.Attachment}
+	signed := linksign.Link{Artifact: linksign.Signed, Disposition: linksign.Attachment}
+
+	cases := []struct {
+		name   string
+		doc    Document
+		link   linksign.Link
+		status int
+		result string
+	}{
+		{"live", Document{ExpiresAt: &future}, attachment, http.StatusOK, ""},
+		{"no expiry", Document{}, attachment, http.StatusOK, ""},
+		{"token expired", Document{ExpiresAt: &past}, inline, http.StatusGone, "link_expired"},
+		{"revoked", Document{ExpiresAt: &future, RevokedAt: &past}, inline, http.StatusGone, "revoked"},
+		{"view only", Document{ExpiresAt: &future, ViewOnly: true}, attachment, http.StatusForbidden, "view_only"},
+		{"view only inline", Document{ExpiresAt: &future, ViewOnly: true}, inline, http.StatusOK, ""},
+		{"signed after token expiry", Document{CreatedAt: recent, ExpiresAt: &past}, signed, http.StatusOK, ""},
+		{"signed after retention", Document{CreatedAt: old, ExpiresAt: &past}, signed, http.StatusGone, "link_expired"},
+		{"signed revoked", Document{CreatedAt: recent, ExpiresAt: &past, RevokedAt: &past}, signed, http.StatusGone, "revoked"},
+	}
+	for _, tc := range cases {
+		status, result, _ := checkLinkDocument(tc.doc, tc.link, now)
+		if status != tc.status || result != tc.result {
+			t.Errorf("%s: got %d %q, want %d %q", tc.name, status, result, tc.status, tc.result)
+		}
+	}
+}
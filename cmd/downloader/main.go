@@ -4,25 +4,27 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"mime"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 	"unicode"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/clientip"
 	"github.com/yarlKot1904/signer/internal/config"
 	"github.com/yarlKot1904/signer/internal/infra"
+	"github.com/yarlKot1904/signer/internal/linksign"
 	"github.com/yarlKot1904/signer/internal/logutil"
 	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -31,6 +33,7 @@ type FileMeta struct {
 	OriginalName string `json:"original_name"`
 	S3Key        string `json:"s3_key"`
 	MimeType     string `json:"mime_type"`
+	tokenpolicy.Policy
 }
 
 type SigningSession struct {
@@ -38,7 +41,11 @@ type SigningSession struct {
 	SignedS3Key string
 }
 
-var db *gorm.DB
+var (
+	db             *gorm.DB
+	presignTTL     time.Duration
+	trustedProxies clientip.Proxies
+)
 
 func main() {
 	cfg, err := config.Load()
@@ -55,6 +62,32 @@ func main() {
 		if err != nil {
 			log.Fatal("DB connect failed:", err)
 		}
+		if err := db.AutoMigrate(&DownloadAccess{}); err != nil {
+			log.Fatal("Migration failed:", err)
+		}
+		accessLog = newAccessLogWriter(db, cfg.AccessLogBatch, cfg.AccessLogFlushInterval)
+	}
+	accessLogCtx, stopAccessLog := context.WithCancel(context.Background())
+	accessLogDone := make(chan struct{})
+	go func() {
+		defer close(accessLogDone)
+		if accessLog != nil {
+			accessLog.Run(accessLogCtx)
+		}
+	}()
+
+	documentRetention = cfg.DocumentRetention
+	trustedProxies, err = clientip.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal("Config error:", err)
+	}
+
+	linkKeys, err := linksign.ParseKeys(cfg.LinkSigningKeys)
+	if err != nil {
+		log.Fatal("Config error:", err)
+	}
+	if linkKeys != nil && db == nil {
+		log.Fatal("Config error: LINK_SIGNING_KEYS requires DB_DSN")
 	}
 
 	s3Client, err := infra.NewS3Client(appCtx, cfg.MinioEndpoint, cfg.MinioID, cfg.MinioSecret, cfg.MinioRegion)
@@ -72,13 +105,38 @@ func main() {
 		}
 	}()
 
+	var downloadPresigner, viewPresigner *s3.PresignClient
+	if cfg.DownloadRedirect || cfg.ViewRedirect {
+		presignClient := s3Client
+		if cfg.MinioPublicEndpoint != "" {
+			presignClient, err = infra.NewS3Client(appCtx, cfg.MinioPublicEndpoint, cfg.MinioID, cfg.MinioSecret, cfg.MinioRegion)
+			if err != nil {
+				log.Fatal("S3 presign client failed:", err)
+			}
+		}
+		presigner := s3.NewPresignClient(presignClient)
+		if cfg.DownloadRedirect {
+			downloadPresigner = presigner
+		}
+		if cfg.ViewRedirect {
+			viewPresigner = presigner
+		}
+		presignTTL = cfg.PresignTTL
+		log.Printf("Presigned redirects enabled: download=%t view=%t ttl=%s", cfg.DownloadRedirect, cfg.ViewRedirect, cfg.PresignTTL)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/download/", appmetrics.InstrumentHandlerFunc("downloader", "/download/{token}", func(w http.ResponseWriter, r *http.Request) {
-		serveFile(w, r, redisClient, s3Client, cfg.MinioBucket, false)
+		serveFile(w, r, redisClient, s3Client, downloadPresigner, cfg.MinioBucket, false)
 	}))
 	mux.HandleFunc("/view/", appmetrics.InstrumentHandlerFunc("downloader", "/view/{token}", func(w http.ResponseWriter, r *http.Request) {
-		serveFile(w, r, redisClient, s3Client, cfg.MinioBucket, true)
+		serveFile(w, r, redisClient, s3Client, viewPresigner, cfg.MinioBucket, true)
 	}))
+	if linkKeys != nil {
+		mux.HandleFunc(linksign.PathPrefix, appmetrics.InstrumentHandlerFunc("downloader", "/link/{token}", func(w http.ResponseWriter, r *http.Request) {
+			serveSignedLink(w, r, linkKeys, redisClient, s3Client, downloadPresigner, viewPresigner, cfg.MinioBucket)
+		}))
+	}
 	mux.HandleFunc("/health", appmetrics.InstrumentHandlerFunc("downloader", "/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(`{"status":"ok"}`))
@@ -93,7 +151,9 @@ func main() {
 		IdleTimeout:       cfg.HTTPIdleTimeout,
 	}
 
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-appCtx.Done()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 		defer cancel()
@@ -106,50 +166,97 @@ func main() {
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+	<-shutdownDone
+	stopAccessLog()
+	<-accessLogDone
 }
 
-func serveFile(w http.ResponseWriter, r *http.Request, rdb *redis.Client, s3c *s3.Client, bucket string, isInline bool) {
+func serveFile(w http.ResponseWriter, r *http.Request, rdb *redis.Client, s3c *s3.Client, presigner *s3.PresignClient, bucket string, isInline bool) {
 	route := "/download/{token}"
 	if isInline {
 		route = "/view/{token}"
 	}
 	signedLabel := "false"
+	artifact := "original"
 	if r.URL.Query().Get("signed") == "1" {
 		signedLabel = "true"
+		artifact = "signed"
+	}
+	disposition := "attachment"
+	if isInline {
+		disposition = "inline"
 	}
+	aw := &accessResponseWriter{ResponseWriter: w}
+	w = aw
+	token := ""
 	result := "error"
 	defer func() {
 		appmetrics.DownloadRequests.WithLabelValues(route, signedLabel, result).Inc()
+		if token != "" {
+			accessLog.Record(newDownloadAccess(r, aw, route, token, artifact, disposition, result))
+		}
 	}()
 
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		result = "method_not_allowed"
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 3 || parts[2] == "" {
 		result = "bad_request"
 		http.Error(w, "Token required", http.StatusBadRequest)
 		return
 	}
-	token := parts[2]
+	token = parts[2]
+
+	policyRoute := tokenpolicy.RouteDownload
+	if isInline {
+		policyRoute = tokenpolicy.RouteView
+	}
 
 	lookupStart := time.Now()
-	depStart := time.Now()
-	val, err := rdb.Get(r.Context(), "doc:"+token).Result()
-	appmetrics.ObserveDependency("downloader", "redis", "redis_get", depStart, err)
+	val, decision, counted, err := authorizeToken(r.Context(), rdb, token, policyRoute, countsAsDownload(r, presigner != nil), signedLabel == "true")
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			result = "not_found"
-			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
-			log.Printf("Token lookup failed for %s: %v", logutil.MaskToken(token), err)
-			http.Error(w, "Link expired or invalid", http.StatusNotFound)
-			return
-		}
 		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
 		log.Printf("Token lookup failed for %s: %v", logutil.MaskToken(token), err)
 		http.Error(w, "Metadata lookup failed", http.StatusInternalServerError)
 		return
 	}
+	switch decision {
+	case tokenpolicy.Missing:
+		result = "not_found"
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		log.Printf("Token lookup failed for %s: not found", logutil.MaskToken(token))
+		http.Error(w, "Link expired or invalid", http.StatusNotFound)
+		return
+	case tokenpolicy.Revoked:
+		result = "revoked"
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		http.Error(w, "Link has been revoked", http.StatusGone)
+		return
+	case tokenpolicy.ViewOnly:
+		result = "view_only"
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		http.Error(w, "This link can only be viewed", http.StatusForbidden)
+		return
+	case tokenpolicy.Exhausted:
+		result = "limit_reached"
+		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
+		http.Error(w, "Download limit reached", http.StatusGone)
+		return
+	}
 
 	var meta FileMeta
-	if err := json.Unmarshal([]byte(val), &meta); err != nil {
+	err = json.Unmarshal([]byte(val), &meta)
+	if err == nil && meta.MaxDownloads > 0 {
+		defer func() {
+			settleDownload(rdb, token, aw, counted, result)
+		}()
+	}
+	if err != nil {
 		appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
 		log.Printf("Invalid Redis metadata for %s: %v", logutil.MaskToken(token), err)
 		http.Error(w, "Invalid file metadata", http.StatusInternalServerError)
@@ -168,63 +275,115 @@ func serveFile(w http.ResponseWriter, r *http.Request, rdb *redis.Client, s3c *s
 			return
 		}
 
-		var s SigningSession
-		depStart = time.Now()
-		res := db.WithContext(r.Context()).First(&s, "token = ?", token)
-		appmetrics.ObserveDependency("downloader", "postgres", "signed_lookup", depStart, res.Error)
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) || s.SignedS3Key == "" {
-			result = "not_found"
-			appmetrics.SignedLookupMissing.Inc()
-			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
-			log.Printf("Signed lookup failed for %s: %v", logutil.MaskToken(token), res.Error)
-			http.Error(w, "Signed document not found", http.StatusNotFound)
-			return
-		}
-		if res.Error != nil {
+		if status := useSignedArtifact(r.Context(), token, &meta); status != http.StatusOK {
+			message := "DB error"
+			if status == http.StatusNotFound {
+				result = "not_found"
+				message = "Signed document not found"
+			}
 			appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, result).Observe(time.Since(lookupStart).Seconds())
-			http.Error(w, "DB error", http.StatusInternalServerError)
+			http.Error(w, message, status)
 			return
 		}
-		meta.S3Key = s.SignedS3Key
-		meta.OriginalName = "signed_" + meta.OriginalName
 	}
 	appmetrics.DownloadLookupDuration.WithLabelValues(signedLabel, "success").Observe(time.Since(lookupStart).Seconds())
 
-	depStart = time.Now()
-	obj, err := s3c.GetObject(r.Context(), &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(meta.S3Key),
-	})
-	appmetrics.ObserveDependency("downloader", "minio", "s3_get", depStart, err)
-	if err != nil {
-		appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "error").Inc()
-		log.Printf("S3 lookup failed for token=%s key=%s: %v", logutil.MaskToken(token), meta.S3Key, err)
-		http.Error(w, "File storage error", http.StatusInternalServerError)
-		return
-	}
-	defer obj.Body.Close()
+	result = deliverFile(w, r, s3c, presigner, bucket, meta, disposition, token, signedLabel)
+}
 
-	dispositionType := "attachment"
-	if isInline {
-		dispositionType = "inline"
+// useSignedArtifact points meta at the signed copy of the document. It returns
+// the HTTP status to answer with when the signed copy cannot be served.
+func useSignedArtifact(ctx context.Context, token string, meta *FileMeta) int {
+	var s SigningSession
+	depStart := time.Now()
+	res := db.WithContext(ctx).First(&s, "token = ?", token)
+	appmetrics.ObserveDependency("downloader", "postgres", "signed_lookup", depStart, res.Error)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) || (res.Error == nil && s.SignedS3Key == "") {
+		appmetrics.SignedLookupMissing.Inc()
+		log.Printf("Signed lookup failed for %s: %v", logutil.MaskToken(token), res.Error)
+		return http.StatusNotFound
 	}
+	if res.Error != nil {
+		return http.StatusInternalServerError
+	}
+	meta.S3Key = s.SignedS3Key
+	meta.OriginalName = "signed_" + meta.OriginalName
+	return http.StatusOK
+}
 
+func deliverFile(w http.ResponseWriter, r *http.Request, s3c *s3.Client, presigner *s3.PresignClient, bucket string, meta FileMeta, dispositionType, token, signedLabel string) string {
 	filename := sanitizedFilename(meta.OriginalName)
-	w.Header().Set("Content-Disposition", mustFormatContentDisposition(dispositionType, filename))
+	disposition := mustFormatContentDisposition(dispositionType, filename)
+	if presigner != nil {
+		return redirectToObject(w, r, presigner, bucket, meta.S3Key, disposition, token)
+	}
+
+	w.Header().Set("Content-Disposition", disposition)
 	w.Header().Set("Content-Type", "application/pdf")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
 
-	n, err := io.Copy(w, obj.Body)
-	if n > 0 {
-		appmetrics.DownloadS3ReadBytes.WithLabelValues(signedLabel).Observe(float64(n))
+	return serveObject(w, r, s3c, bucket, meta.S3Key, token, signedLabel)
+}
+
+// countsAsDownload reports whether a request uses up one of the token's
+// downloads up front. PDF viewers fetch documents in many ranges, so only the
+// request for the start of the file is counted; other ranges are metered by
+// settleDownload. A presigned redirect hands out the whole object, so every
+// redirected GET counts.
+func countsAsDownload(r *http.Request, redirect bool) bool {
+	if r.Method != http.MethodGet {
+		return false
 	}
-	if err != nil {
-		appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "error").Inc()
-		log.Printf("Stream error for token=%s key=%s: %v", logutil.MaskToken(token), meta.S3Key, err)
+	byteRange := requestedRange(r)
+	return redirect || byteRange == "" || strings.HasPrefix(byteRange, "bytes=0-")
+}
+
+// settleDownload runs after a request for a token with a download limit. A
+// counted request that sent no part of the file is refunded; otherwise the
+// bytes sent are metered, so ranges that add up to the whole file use up a
+// download too.
+func settleDownload(rdb *redis.Client, token string, w *accessResponseWriter, counted bool, result string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	size := servedObjectSize(w.status, w.Header())
+	sent := int64(0)
+	if size > 0 {
+		sent = w.bytes
+	}
+	if counted || sent > 0 {
+		defer recordUsage(ctx, rdb, token)
+	}
+	if counted && sent == 0 && result != "success" && result != "partial" && result != "redirect" {
+		if err := tokenpolicy.Refund(ctx, rdb, token); err != nil {
+			log.Printf("Download refund failed for %s: %v", logutil.MaskToken(token), err)
+		}
 		return
 	}
-	appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "success").Inc()
-	result = "success"
+	if sent == 0 || (counted && sent >= size) {
+		return
+	}
+	if _, err := tokenpolicy.RecordBytes(ctx, rdb, token, sent, size, counted); err != nil {
+		log.Printf("Download metering failed for %s: %v", logutil.MaskToken(token), err)
+	}
+}
+
+// servedObjectSize returns the full object size of a 200 or 206 file
+// response, or 0 for any other response.
+func servedObjectSize(status int, header http.Header) int64 {
+	switch status {
+	case http.StatusOK:
+		size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		return size
+	case http.StatusPartialContent:
+		_, total, ok := strings.Cut(header.Get("Content-Range"), "/")
+		if !ok {
+			return 0
+		}
+		size, _ := strconv.ParseInt(total, 10, 64)
+		return size
+	}
+	return 0
 }
 
 func sanitizedFilename(name string) string {
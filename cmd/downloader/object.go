@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+)
+
+type objectInfo struct {
+	ETag          *string
+	LastModified  *time.Time
+	ContentLength *int64
+	ContentRange  *string
+}
+
+func serveObject(w http.ResponseWriter, r *http.Request, s3c *s3.Client, bucket, key, token, signedLabel string) string {
+	ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match"))
+
+	if r.Method == http.MethodHead {
+		input := &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+		if ifNoneMatch != "" {
+			input.IfNoneMatch = aws.String(ifNoneMatch)
+		}
+		depStart := time.Now()
+		head, err := s3c.HeadObject(r.Context(), input)
+		appmetrics.ObserveDependency("downloader", "minio", "s3_head", depStart, storageFailure(err))
+		if err != nil {
+			return writeObjectError(w, r, s3c, bucket, key, token, signedLabel, err)
+		}
+		setObjectHeaders(w, objectInfo{ETag: head.ETag, LastModified: head.LastModified, ContentLength: head.ContentLength})
+		w.WriteHeader(http.StatusOK)
+		appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "success").Inc()
+		return "success"
+	}
+
+	input := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if ifNoneMatch != "" {
+		input.IfNoneMatch = aws.String(ifNoneMatch)
+	}
+	byteRange, err := rangeToServe(r, s3c, bucket, key)
+	if err != nil {
+		return writeObjectError(w, r, s3c, bucket, key, token, signedLabel, err)
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+
+	depStart := time.Now()
+	obj, err := s3c.GetObject(r.Context(), input)
+	appmetrics.ObserveDependency("downloader", "minio", "s3_get", depStart, storageFailure(err))
+	if err != nil {
+		return writeObjectError(w, r, s3c, bucket, key, token, signedLabel, err)
+	}
+	defer obj.Body.Close()
+
+	status := http.StatusOK
+	if input.Range != nil && obj.ContentRange != nil {
+		status = http.StatusPartialContent
+	}
+	setObjectHeaders(w, objectInfo{ETag: obj.ETag, LastModified: obj.LastModified, ContentLength: obj.ContentLength, ContentRange: obj.ContentRange})
+	w.WriteHeader(status)
+
+	n, err := io.Copy(w, obj.Body)
+	if n > 0 {
+		appmetrics.DownloadS3ReadBytes.WithLabelValues(signedLabel).Observe(float64(n))
+	}
+	if err != nil {
+		appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "error").Inc()
+		log.Printf("Stream error for token=%s key=%s: %v", logutil.MaskToken(token), key, err)
+		return "error"
+	}
+	appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "success").Inc()
+	if status == http.StatusPartialContent {
+		return "partial"
+	}
+	return "success"
+}
+
+func writeObjectError(w http.ResponseWriter, r *http.Request, s3c *s3.Client, bucket, key, token, signedLabel string, err error) string {
+	switch statusCode, header := s3ErrorResponse(err); statusCode {
+	case http.StatusNotModified:
+		if etag := header.Get("ETag"); etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return "not_modified"
+	case http.StatusRequestedRangeNotSatisfiable:
+		head, headErr := s3c.HeadObject(r.Context(), &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if headErr == nil && head.ContentLength != nil {
+			w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(*head.ContentLength, 10))
+		}
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return "range_not_satisfiable"
+	default:
+		appmetrics.DownloadS3Read.WithLabelValues(signedLabel, "error").Inc()
+		log.Printf("S3 lookup failed for token=%s key=%s: %v", logutil.MaskToken(token), key, err)
+		w.Header().Del("Content-Disposition")
+		http.Error(w, "File storage error", http.StatusInternalServerError)
+		return "error"
+	}
+}
+
+func setObjectHeaders(w http.ResponseWriter, info objectInfo) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	if info.ETag != nil && *info.ETag != "" {
+		w.Header().Set("ETag", *info.ETag)
+	}
+	if info.LastModified != nil {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if info.ContentLength != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*info.ContentLength, 10))
+	}
+	if info.ContentRange != nil && *info.ContentRange != "" {
+		w.Header().Set("Content-Range", *info.ContentRange)
+	}
+}
+
+// requestedRange returns the Range header when it asks for a single byte
+// range. Multi-range requests are served in full, which RFC 9110 allows.
+func requestedRange(r *http.Request) string {
+	value := strings.TrimSpace(r.Header.Get("Range"))
+	if !strings.HasPrefix(value, "bytes=") || strings.Contains(value, ",") {
+		return ""
+	}
+	return value
+}
+
+// rangeToServe returns the range to request from storage. An If-Range that
+// does not match the stored object drops the range, so the client gets the
+// full body even when the range itself is unsatisfiable.
+func rangeToServe(r *http.Request, s3c *s3.Client, bucket, key string) (string, error) {
+	byteRange := requestedRange(r)
+	ifRange := strings.TrimSpace(r.Header.Get("If-Range"))
+	if byteRange == "" || ifRange == "" {
+		return byteRange, nil
+	}
+
+	depStart := time.Now()
+	head, err := s3c.HeadObject(r.Context(), &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	appmetrics.ObserveDependency("downloader", "minio", "s3_head", depStart, err)
+	if err != nil {
+		return "", err
+	}
+	if !ifRangeMatches(ifRange, head.ETag, head.LastModified) {
+		return "", nil
+	}
+	return byteRange, nil
+}
+
+func ifRangeMatches(ifRange string, etag *string, lastModified *time.Time) bool {
+	ifRange = strings.TrimSpace(ifRange)
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return etag != nil && *etag == ifRange
+	}
+	if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+	since, err := http.ParseTime(ifRange)
+	if err != nil || lastModified == nil {
+		return false
+	}
+	return lastModified.UTC().Truncate(time.Second).Equal(since.UTC())
+}
+
+func s3ErrorResponse(err error) (int, http.Header) {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) || respErr.Response == nil || respErr.Response.Response == nil {
+		return 0, http.Header{}
+	}
+	return respErr.HTTPStatusCode(), respErr.Response.Header
+}
+
+func storageFailure(err error) error {
+	if status, _ := s3ErrorResponse(err); status == http.StatusNotModified || status == http.StatusRequestedRangeNotSatisfiable {
+		return nil
+	}
+	return err
+}
+
+func redirectToObject(w http.ResponseWriter, r *http.Request, presigner *s3.PresignClient, bucket, key, disposition, token string) string {
+	depStart := time.Now()
+	req, err := presigner.PresignGetObject(r.Context(), &s3.GetObjectInput{
+		Bucket:                     aws.String(bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(disposition),
+		ResponseContentType:        aws.String("application/pdf"),
+	}, s3.WithPresignExpires(presignTTL))
+	appmetrics.ObserveDependency("downloader", "minio", "s3_presign", depStart, err)
+	if err != nil {
+		log.Printf("Presign failed for token=%s key=%s: %v", logutil.MaskToken(token), key, err)
+		http.Error(w, "File storage error", http.StatusInternalServerError)
+		return "error"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, req.URL, http.StatusFound)
+	return "redirect"
+}
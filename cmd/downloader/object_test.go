@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/yarlKot1904/signer/internal/infra"
+)
+
+var testObjectModified = time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+var fakeS3Gets atomic.Int32
+
+func newFakeS3(t *testing.T, body []byte) *httptest.Server {
+	t.Helper()
+	fakeS3Gets.Store(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fakeS3Gets.Add(1)
+		}
+		if r.URL.Path != "/docs/2026/03/file" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"abc123"`)
+		http.ServeContent(w, r, "", testObjectModified, bytes.NewReader(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func serveTestObject(t *testing.T, method string, headers map[string]string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	server := newFakeS3(t, []byte("0123456789"))
+	s3c, err := infra.NewS3Client(context.Background(), server.URL, "id", "secret", "us-east-1")
+	if err != nil {
+		t.Fatalf("s3 client: %v", err)
+	}
+
+	req := httptest.NewRequest(method, "/download/token", nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	recorder := httptest.NewRecorder()
+	result := serveObject(recorder, req, s3c, "docs", "2026/03/file", "token", "false")
+	return recorder, result
+}
+
+func TestServeObjectFullBody(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, nil)
+
+	if rec.Code != http.StatusOK || result != "success" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	if rec.Body.String() != "0123456789" {
+		t.Fatalf("unexpected body: %q", rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != "10" || rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("missing length headers: %v", rec.Header())
+	}
+	if rec.Header().Get("ETag") != `"abc123"` {
+		t.Fatalf("unexpected etag: %s", rec.Header().Get("ETag"))
+	}
+	if rec.Header().Get("Last-Modified") != testObjectModified.Format(http.TimeFormat) {
+		t.Fatalf("unexpected last-modified: %s", rec.Header().Get("Last-Modified"))
+	}
+}
+
+func TestServeObjectRange(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=2-5"})
+
+	if rec.Code != http.StatusPartialContent || result != "partial" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	if rec.Body.String() != "2345" {
+		t.Fatalf("unexpected body: %q", rec.Body.String())
+	}
+	if rec.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Fatalf("unexpected content-range: %s", rec.Header().Get("Content-Range"))
+	}
+}
+
+func TestServeObjectStaleIfRangeServesFullBody(t *testing.T) {
+	rec, _ := serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=2-5", "If-Range": `"other"`})
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("expected full body, got %d %q", rec.Code, rec.Body.String())
+	}
+	if got := fakeS3Gets.Load(); got != 1 {
+		t.Fatalf("expected one storage read, got %d", got)
+	}
+}
+
+func TestServeObjectStaleIfRangeIgnoresUnsatisfiableRange(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=50-60", "If-Range": `"other"`})
+
+	if rec.Code != http.StatusOK || result != "success" || rec.Body.String() != "0123456789" {
+		t.Fatalf("expected full body, got %d %s %q", rec.Code, result, rec.Body.String())
+	}
+}
+
+func TestServeObjectMatchingIfRange(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=2-5", "If-Range": `"abc123"`})
+
+	if rec.Code != http.StatusPartialContent || result != "partial" || rec.Body.String() != "2345" {
+		t.Fatalf("expected partial body, got %d %s %q", rec.Code, result, rec.Body.String())
+	}
+}
+
+func TestServeObjectNotModified(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, map[string]string{"If-None-Match": `"abc123"`})
+
+	if rec.Code != http.StatusNotModified || result != "not_modified" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected empty body, got %q", rec.Body.String())
+	}
+}
+
+func TestServeObjectUnsatisfiableRange(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=50-60"})
+
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable || result != "range_not_satisfiable" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	if rec.Header().Get("Content-Range") != "bytes */10" {
+		t.Fatalf("unexpected content-range: %s", rec.Header().Get("Content-Range"))
+	}
+}
+
+func TestServeObjectHead(t *testing.T) {
+	rec, result := serveTestObject(t, http.MethodHead, nil)
+
+	if rec.Code != http.StatusOK || result != "success" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("expected no body for HEAD, got %q", rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != "10" {
+		t.Fatalf("unexpected content-length: %s", rec.Header().Get("Content-Length"))
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	etag := `"abc123"`
+	modified := testObjectModified.Add(500 * time.Millisecond)
+
+	cases := []struct {
+		ifRange string
+		want    bool
+	}{
+		{"", true},
+		{`"abc123"`, true},
+		{`"other"`, false},
+		{`W/"abc123"`, false},
+		{testObjectModified.Format(http.TimeFormat), true},
+		{testObjectModified.Add(time.Hour).Format(http.TimeFormat), false},
+		{"garbage", false},
+	}
+	for _, tc := range cases {
+		if got := ifRangeMatches(tc.ifRange, &etag, &modified); got != tc.want {
+			t.Errorf("ifRangeMatches(%q) = %v, want %v", tc.ifRange, got, tc.want)
+		}
+	}
+}
+
+func TestRedirectToObjectPresignsOverrides(t *testing.T) {
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	previousTTL := presignTTL
+	defer func() { presignTTL = previousTTL }()
+	presignTTL = 2 * time.Minute
+
+	s3c, err := infra.NewS3Client(context.Background(), "https://files.example.com", "id", "secret", "us-east-1")
+	if err != nil {
+		t.Fatalf("s3 client: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/view/token", nil)
+	rec := httptest.NewRecorder()
+	disposition := mustFormatContentDisposition("inline", "report.pdf")
+	result := redirectToObject(rec, req, s3.NewPresignClient(s3c), "docs", "2026/03/file", disposition, "token")
+
+	if rec.Code != http.StatusFound || result != "redirect" {
+		t.Fatalf("unexpected status %d result %s", rec.Code, result)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad location: %v", err)
+	}
+	if location.Host != "files.example.com" || location.Path != "/docs/2026/03/file" {
+		t.Fatalf("unexpected presigned target: %s", location)
+	}
+	query := location.Query()
+	if query.Get("response-content-disposition") != disposition {
+		t.Fatalf("unexpected disposition override: %q", query.Get("response-content-disposition"))
+	}
+	if query.Get("response-content-type") != "application/pdf" {
+		t.Fatalf("unexpected content type override: %q", query.Get("response-content-type"))
+	}
+	if query.Get("X-Amz-Expires") != "120" {
+		t.Fatalf("unexpected expiry: %q", query.Get("X-Amz-Expires"))
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("expected redirect to be uncacheable")
+	}
+}
+
+func TestCountsAsDownload(t *testing.T) {
+	cases := []struct {
+		method   string
+		rng      string
+		redirect bool
+		want     bool
+	}{
+		{http.MethodGet, "", false, true},
+		{http.MethodGet, "bytes=0-1023", false, true},
+		{http.MethodGet, "bytes=1024-2047", false, false},
+		{http.MethodGet, "bytes=-1024", false, false},
+		{http.MethodGet, "bytes=1-", false, false},
+		{http.MethodGet, "bytes=1024-2047", true, true},
+		{http.MethodHead, "", false, false},
+		{http.MethodHead, "", true, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/download/token", nil)
+		if tc.rng != "" {
+			req.Header.Set("Range", tc.rng)
+		}
+		if got := countsAsDownload(req, tc.redirect); got != tc.want {
+			t.Errorf("%s %q redirect=%v: got %v, want %v", tc.method, tc.rng, tc.redirect, got, tc.want)
+		}
+	}
+}
+
+func TestServedObjectSize(t *testing.T) {
+	for _, rng := range []string{"bytes=-4", "bytes=1-", "bytes=2-5"} {
+		rec, _ := serveTestObject(t, http.MethodGet, map[string]string{"Range": rng})
+		if got := servedObjectSize(rec.Code, rec.Header()); got != 10 {
+			t.Errorf("%s: expected the full object size, got %d", rng, got)
+		}
+	}
+	rec, _ := serveTestObject(t, http.MethodGet, nil)
+	if got := servedObjectSize(rec.Code, rec.Header()); got != 10 {
+		t.Errorf("full body: expected the object size, got %d", got)
+	}
+	rec, _ = serveTestObject(t, http.MethodGet, map[string]string{"Range": "bytes=50-60"})
+	if got := servedObjectSize(rec.Code, rec.Header()); got != 0 {
+		t.Errorf("unsatisfiable range: expected no size, got %d", got)
+	}
+}
+
+func TestDocumentRetained(t *testing.T) {
+	previous := documentRetention
+	defer func() { documentRetention = previous }()
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := Document{CreatedAt: created}
+
+	documentRetention = 30 * 24 * time.Hour
+	if !doc.retained(created.Add(48 * time.Hour)) {
+		t.Fatal("expected document to be retained after its link expired")
+	}
+	if doc.retained(created.Add(31 * 24 * time.Hour)) {
+		t.Fatal("expected document past retention to be dropped")
+	}
+	documentRetention = 0
+	if doc.retained(created.Add(time.Hour)) {
+		t.Fatal("expected zero retention to disable signed retrieval after expiry")
+	}
+}
@@ -148,7 +148,7 @@ func handleSendRequest(w http.ResponseWriter, r *http.Request, sender mailer.Sen
 		return
 	}
 	if transport != "smtp" {
-		appmetrics.MailerMessageBytes.WithLabelValues(template, transport).Observe(float64(len(msg.Body)))
+		appmetrics.MailerMessageBytes.WithLabelValues(template, transport).Observe(float64(len(msg.Body) + len(msg.HTMLBody)))
 	}
 
 	if err := sender.Send(r.Context(), msg); err != nil {
@@ -163,7 +163,7 @@ func handleSendRequest(w http.ResponseWriter, r *http.Request, sender mailer.Sen
 
 func boundedTemplate(template string) string {
 	switch template {
-	case mailer.TemplateSigningOTP, mailer.TemplateSignedDocument:
+	case mailer.TemplateSigningOTP, mailer.TemplateSigningReminder, mailer.TemplateSignedDocument:
 		return template
 	default:
 		return "unknown"
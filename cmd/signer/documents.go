@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+)
+
+type Document struct {
+	Token     string `gorm:"primaryKey"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// checkVerifiableToken decides whether a download token may still be verified.
+// The documents table is authoritative; tokens uploaded before it existed are
+// only known to Redis.
+func checkVerifiableToken(ctx context.Context, token string, now time.Time) (int, string) {
+	var doc Document
+	depStart := time.Now()
+	err := db.WithContext(ctx).First(&doc, "token = ?", token).Error
+	appmetrics.ObserveDependency("signer", "postgres", "document_lookup", depStart, err)
+	switch {
+	case err == nil:
+		return documentStatus(doc, now, appCfg.DocumentRetention)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusInternalServerError, "token lookup failed"
+	}
+
+	depStart = time.Now()
+	_, err = redisDB.Get(ctx, tokenpolicy.MetaKey(token)).Result()
+	appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
+	if errors.Is(err, redis.Nil) {
+		return http.StatusNotFound, "token not found or expired"
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "token lookup failed"
+	}
+	return http.StatusOK, ""
+}
+
+func documentStatus(doc Document, now time.Time, retention time.Duration) (int, string) {
+	if doc.RevokedAt != nil {
+		return http.StatusGone, "document has been revoked"
+	}
+	if retention > 0 && !now.Before(doc.CreatedAt.Add(retention)) {
+		return http.StatusNotFound, "token not found or expired"
+	}
+	return http.StatusOK, ""
+}
+
+// signedLinkExpiry returns when emailed /link URLs for token should expire:
+// after SIGNED_LINK_TTL, but never after the retention of its signed copy.
+// Tokens without a documents row get the plain TTL.
+func signedLinkExpiry(ctx context.Context, token string, now time.Time) (time.Time, error) {
+	var doc Document
+	depStart := time.Now()
+	err := db.WithContext(ctx).First(&doc, "token = ?", token).Error
+	appmetrics.ObserveDependency("signer", "postgres", "document_lookup", depStart, err)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return now.Add(appCfg.SignedLinkTTL), nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return capLinkExpiry(doc, now, appCfg.SignedLinkTTL, appCfg.DocumentRetention), nil
+}
+
+// capLinkExpiry mirrors the downloader: the signed copy outlives the token only
+// while DOCUMENT_RETENTION is set.
+func capLinkExpiry(doc Document, now time.Time, ttl, retention time.Duration) time.Time {
+	expiresAt := now.Add(ttl)
+	limit := doc.ExpiresAt
+	if retention > 0 {
+		retained := doc.CreatedAt.Add(retention)
+		limit = &retained
+	}
+	if limit != nil && limit.Before(expiresAt) {
+		expiresAt = *limit
+	}
+	return expiresAt
+}
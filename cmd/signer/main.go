@@ -19,6 +19,7 @@ import (
 	"io"
 	"log"
 	"math/big"
+	"mime"
 	"mime/multipart"
 	"net"
 	"net/http"
@@ -32,13 +33,17 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/clientip"
 	"github.com/yarlKot1904/signer/internal/config"
 	"github.com/yarlKot1904/signer/internal/infra"
+	"github.com/yarlKot1904/signer/internal/linksign"
 	"github.com/yarlKot1904/signer/internal/logutil"
 	"github.com/yarlKot1904/signer/internal/mailer"
 	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/queue"
+	"github.com/yarlKot1904/signer/internal/receipt"
+	"github.com/yarlKot1904/signer/internal/truststore"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -63,6 +68,10 @@ type SigningSession struct {
 	SignedS3Key        string
 	SignedAt           *time.Time
 	NotificationSentAt *time.Time
+	VoidedAt           *time.Time
+
+	RemindersSent  int `gorm:"default:0"`
+	LastReminderAt *time.Time
 }
 
 type TaskMessage struct {
@@ -82,17 +91,54 @@ type VerifyRequest struct {
 }
 
 type VerificationResult struct {
-	Status                string  `json:"status"`
-	ServiceOwned          bool    `json:"service_owned"`
-	SignaturePresent      bool    `json:"signature_present"`
-	IntegrityValid        bool    `json:"integrity_valid"`
-	SignerSubject         *string `json:"signer_subject"`
-	SignerCN              *string `json:"signer_cn"`
-	SigningTime           *string `json:"signing_time"`
-	CertificateSelfSigned *bool   `json:"certificate_self_signed"`
-	CertificateSHA256     *string `json:"certificate_sha256"`
-	CertificateTrusted    *bool   `json:"certificate_trusted"`
-	Error                 *string `json:"error"`
+	Status                string            `json:"status"`
+	ServiceOwned          bool              `json:"service_owned"`
+	Engine                string            `json:"engine,omitempty"`
+	SignaturePresent      bool              `json:"signature_present"`
+	IntegrityValid        bool              `json:"integrity_valid"`
+	SignerSubject         *string           `json:"signer_subject"`
+	SignerCN              *string           `json:"signer_cn"`
+	SigningTime           *string           `json:"signing_time"`
+	CertificateSelfSigned *bool             `json:"certificate_self_signed"`
+	CertificateSHA256     *string           `json:"certificate_sha256"`
+	CertificateTrusted    *bool             `json:"certificate_trusted"`
+	Error                 *string           `json:"error"`
+	Chain                 *truststore.Chain `json:"chain,omitempty"`
+	Signatures            []SignatureDetail `json:"signatures,omitempty"`
+	Receipt               *string           `json:"receipt,omitempty"`
+
+	CertificateChain []string `json:"-"`
+}
+
+// SignatureDetail describes one signature of the PDF in document order; the
+// top-level VerificationResult fields summarise the first of them.
+type SignatureDetail struct {
+	Index                 int               `json:"index"`
+	Status                string            `json:"status"`
+	IntegrityValid        bool              `json:"integrity_valid"`
+	SignerSubject         *string           `json:"signer_subject"`
+	SignerCN              *string           `json:"signer_cn"`
+	SigningTime           *string           `json:"signing_time"`
+	ByteRange             []int64           `json:"byte_range"`
+	CoversWholeDocument   bool              `json:"covers_whole_document"`
+	CertificateSelfSigned *bool             `json:"certificate_self_signed"`
+	CertificateSHA256     *string           `json:"certificate_sha256"`
+	CertificateTrusted    *bool             `json:"certificate_trusted"`
+	Chain                 *truststore.Chain `json:"chain,omitempty"`
+	Error                 *string           `json:"error"`
+}
+
+// pdfVerifyResponse is the pdfsigner /verify body: the public result plus the
+// signature's certificates as base64 DER, signer first.
+type pdfVerifyResponse struct {
+	VerificationResult
+	CertificateChain []string       `json:"certificate_chain"`
+	Signatures       []pdfSignature `json:"signatures"`
+}
+
+type pdfSignature struct {
+	SignatureDetail
+	CertificateChain []string `json:"certificate_chain"`
 }
 
 type FileMeta struct {
@@ -122,12 +168,10 @@ func (e apiError) Error() string {
 	return e.Message
 }
 
-type taskAction int
-
 const (
-	taskAck taskAction = iota
-	taskReject
-	taskNackRequeue
+	taskAck    = queue.Ack
+	taskReject = queue.Reject
+	taskRetry  = queue.Retry
 )
 
 const verifyCleanupZSetKey = "verify:cleanup"
@@ -140,6 +184,10 @@ var (
 	s3Client         *s3.Client
 	redisDB          *redis.Client
 	masterKey        []byte
+	linkKeys         *linksign.KeySet
+	receiptKeys      *receipt.KeySet
+	trustedProxies   clientip.Proxies
+	trustStore       *truststore.Store
 	httpClient       *http.Client
 	signDocumentFunc = signDocument
 	notifyMailerFunc = notifyMailer
@@ -153,13 +201,43 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if appCfg.PDFSignURL == "" {
-		log.Fatal("PDFSIGN_URL is required")
+	if err := validateSignEngine(appCfg.SignEngine); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateVerifyEngine(appCfg.VerifyEngine); err != nil {
+		log.Fatal(err)
+	}
+	if appCfg.PDFSignURL == "" && needsPDFSigner() {
+		log.Fatal("PDFSIGN_URL is required unless SIGN_ENGINE and VERIFY_ENGINE are both go")
 	}
 	if appCfg.MailerURL == "" {
 		log.Fatal("MAILER_URL is required")
 	}
 
+	if err := validateReminderThresholds(appCfg.ReminderThresholds); err != nil {
+		log.Fatal(err)
+	}
+
+	linkKeys, err = linksign.ParseKeys(appCfg.LinkSigningKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	receiptKeys, err = receipt.ParseKeys(appCfg.ReceiptSigningKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustedProxies, err = clientip.ParseProxies(appCfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trustStore, err = truststore.Load(appCfg.TrustStoreDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if trustStore != nil {
+		log.Printf("Trust store loaded: anchors=%d tenants=%d version=%s", trustStore.Anchors(), trustStore.Tenants(), trustStore.Version())
+	}
+
 	masterKey, err = decodeMasterKey(appCfg.MasterKeyHex)
 	if err != nil {
 		log.Fatal("MASTER_KEY_HEX error:", err)
@@ -207,48 +285,32 @@ func main() {
 		log.Fatal("Migration failed:", err)
 	}
 
-	rabbitConn, err := amqp.Dial(appCfg.RabbitURL)
-	if err != nil {
-		log.Fatal("RabbitMQ connect failed:", err)
-	}
-	defer rabbitConn.Close()
-
-	rabbitCh, err := rabbitConn.Channel()
-	if err != nil {
-		log.Fatal("RabbitMQ channel failed:", err)
-	}
-	defer rabbitCh.Close()
-
-	q, err := rabbitCh.QueueDeclare(
-		"signer.tasks",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	msgs, err := rabbitCh.Consume(
-		q.Name,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+	tasks, err := queue.New(appCtx, "signer", appCfg, redisDB)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Task queue connect failed:", err)
 	}
+	defer tasks.Close()
 
-	go consumeTasks(appCtx, msgs)
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumeTasks(appCtx, tasks)
+	}()
+	go runDLQDepthLoop(appCtx, tasks)
+	verifyUploads = newVerifyUploadWaiter(redisDB)
+	go verifyUploads.Run(appCtx)
+	go runReminderLoop(appCtx)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/sign", appmetrics.InstrumentHandlerFunc("signer", "/api/sign", handleSignRequest))
 	mux.HandleFunc("/api/verify", appmetrics.InstrumentHandlerFunc("signer", "/api/verify", handleVerifyRequest))
+	mux.HandleFunc(verifyV2Path, appmetrics.InstrumentHandlerFunc("signer", verifyV2Path, handleVerifyRequest))
+	mux.HandleFunc("/api/verify/batch", appmetrics.InstrumentHandlerFunc("signer", "/api/verify/batch", handleVerifyBatch))
+	mux.HandleFunc(verifyHashPathPrefix, appmetrics.InstrumentHandlerFunc("signer", "/api/verify/hash/{sha256}", handleVerifyByHash))
+	if receiptKeys != nil {
+		mux.HandleFunc("/api/verify/receipt", appmetrics.InstrumentHandlerFunc("signer", "/api/verify/receipt", handleValidateReceipt))
+		mux.HandleFunc("/api/verify/jwks.json", appmetrics.InstrumentHandlerFunc("signer", "/api/verify/jwks.json", handleReceiptKeys))
+	}
 	mux.HandleFunc("/health", appmetrics.InstrumentHandlerFunc("signer", "/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(`{"status":"ok"}`))
@@ -276,43 +338,34 @@ func main() {
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
-}
-
-func consumeTasks(appCtx context.Context, msgs <-chan amqp.Delivery) {
-	log.Printf("Signer Worker started. Waiting for messages.")
 
-	for {
-		select {
-		case <-appCtx.Done():
-			return
-		case delivery, ok := <-msgs:
-			if !ok {
-				return
-			}
+	select {
+	case <-consumerDone:
+	case <-time.After(appCfg.ShutdownTimeout):
+		log.Printf("Signer Worker did not drain within %s", appCfg.ShutdownTimeout)
+	}
+}
 
-			taskCtx, cancel := context.WithTimeout(appCtx, appCfg.DependencyTimeout)
-			action := processTask(taskCtx, delivery.Body)
-			cancel()
+func consumeTasks(appCtx context.Context, tasks queue.Queue) {
+	log.Printf("Signer Worker started on %s (%s). Waiting for messages.", tasks.Name(), tasks.Backend())
 
-			switch action {
-			case taskAck:
-				if err := delivery.Ack(false); err != nil {
-					log.Printf("RabbitMQ ack failed: %v", err)
-				}
-			case taskReject:
-				if err := delivery.Reject(false); err != nil {
-					log.Printf("RabbitMQ reject failed: %v", err)
-				}
-			case taskNackRequeue:
-				if err := delivery.Nack(false, true); err != nil {
-					log.Printf("RabbitMQ nack failed: %v", err)
-				}
-			}
-		}
+	opts := queue.ConsumeOptions{
+		Workers:       appCfg.TaskWorkers,
+		Prefetch:      appCfg.TaskPrefetch,
+		MaxAttempts:   appCfg.TaskMaxAttempts,
+		SettleTimeout: appCfg.DependencyTimeout,
+	}
+	err := tasks.Consume(appCtx, opts, func(ctx context.Context, d queue.Delivery) queue.Action {
+		taskCtx, cancel := context.WithTimeout(ctx, appCfg.DependencyTimeout)
+		defer cancel()
+		return processTask(taskCtx, d.Body)
+	})
+	if err != nil {
+		log.Printf("Signer Worker stopped: %v", err)
 	}
 }
 
-func processTask(ctx context.Context, body []byte) taskAction {
+func processTask(ctx context.Context, body []byte) queue.Action {
 	taskResult := "error"
 	defer func() {
 		appmetrics.WorkerTasks.WithLabelValues(taskResult).Inc()
@@ -333,13 +386,13 @@ func processTask(ctx context.Context, body []byte) taskAction {
 	code, err := generateCode()
 	if err != nil {
 		log.Printf("OTP generation error: %v", err)
-		return taskNackRequeue
+		return taskRetry
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Hash error: %v", err)
-		return taskNackRequeue
+		return taskRetry
 	}
 
 	if err := upsertPendingNotification(ctx, task, string(hash)); err != nil {
@@ -351,13 +404,13 @@ func processTask(ctx context.Context, body []byte) taskAction {
 		}
 		appmetrics.OTPSessionsCreated.WithLabelValues("error").Inc()
 		log.Printf("DB Error: %v", err)
-		return taskNackRequeue
+		return taskRetry
 	}
 	appmetrics.OTPSessionsCreated.WithLabelValues("success").Inc()
 
 	if err := notifyMailer(ctx, buildSigningNotification(task, code)); err != nil {
 		log.Printf("Mailer dispatch failed for token=%s: %v", logutil.MaskToken(task.Token), err)
-		return taskNackRequeue
+		return taskRetry
 	}
 
 	now := time.Now().UTC()
@@ -367,7 +420,7 @@ func processTask(ctx context.Context, body []byte) taskAction {
 		Update("notification_sent_at", &now)
 	if result.Error != nil {
 		log.Printf("Notification state update failed for token=%s: %v", logutil.MaskToken(task.Token), result.Error)
-		return taskNackRequeue
+		return taskRetry
 	}
 	if result.RowsAffected == 0 {
 		log.Printf("Notification state already updated for token=%s", logutil.MaskToken(task.Token))
@@ -394,7 +447,7 @@ func upsertPendingNotification(ctx context.Context, task TaskMessage, codeHash s
 			return tx.Create(&session).Error
 		case result.Error != nil:
 			return result.Error
-		case session.NotificationSentAt != nil:
+		case session.NotificationSentAt != nil, session.VoidedAt != nil:
 			return errNotificationAlreadySent
 		default:
 			session.Email = task.Email
@@ -424,7 +477,10 @@ func buildSigningNotification(task TaskMessage, code string) mailer.SendRequest
 	}
 }
 
-func buildSignedDocumentNotification(recipient, token, signedURL string) mailer.SendRequest {
+// buildSignedDocumentNotification links to /link URLs expiring at
+// linkExpiresAt when link signing is enabled, and falls back to the plain
+// download path once that time has passed.
+func buildSignedDocumentNotification(recipient, token, signedURL string, linkExpiresAt time.Time) mailer.SendRequest {
 	signedDownloadPath := strings.TrimSpace(signedURL)
 	if signedDownloadPath == "" {
 		escapedToken := url.PathEscape(token)
@@ -435,6 +491,17 @@ func buildSignedDocumentNotification(recipient, token, signedURL string) mailer.
 	if strings.HasPrefix(signedViewPath, "/download/") {
 		signedViewPath = "/view/" + strings.TrimPrefix(signedViewPath, "/download/")
 	}
+	if linkKeys != nil && linkExpiresAt.After(time.Now()) {
+		link := linksign.Link{
+			Token:       token,
+			Artifact:    linksign.Signed,
+			Disposition: linksign.Attachment,
+			ExpiresAt:   linkExpiresAt.UTC(),
+		}
+		signedDownloadPath = linkKeys.Path(link)
+		link.Disposition = linksign.Inline
+		signedViewPath = linkKeys.Path(link)
+	}
 
 	return mailer.SendRequest{
 		Template:    mailer.TemplateSignedDocument,
@@ -519,7 +586,14 @@ func handleSignRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	notifyCtx, cancel := context.WithTimeout(context.Background(), appCfg.DependencyTimeout)
-	if err := notifyMailerFunc(notifyCtx, buildSignedDocumentNotification(recipient, req.Token, signedURL)); err != nil {
+	linkExpiresAt := time.Time{}
+	if linkKeys != nil {
+		linkExpiresAt, err = signedLinkExpiry(notifyCtx, req.Token, time.Now())
+		if err != nil {
+			log.Printf("Signed link expiry lookup failed for token=%s, sending plain links: %v", logutil.MaskToken(req.Token), err)
+		}
+	}
+	if err := notifyMailerFunc(notifyCtx, buildSignedDocumentNotification(recipient, req.Token, signedURL, linkExpiresAt)); err != nil {
 		log.Printf("Signed document notification failed for token=%s recipient=%s: %v", logutil.MaskToken(req.Token), logutil.MaskEmail(recipient), err)
 	} else {
 		log.Printf("Signed document notification queued: token=%s recipient=%s", logutil.MaskToken(req.Token), logutil.MaskEmail(recipient))
@@ -558,6 +632,9 @@ func signDocument(ctx context.Context, req SignRequest) (signedURL string, recip
 			return apiError{Status: http.StatusInternalServerError, Message: "Internal error"}
 		}
 
+		if session.VoidedAt != nil {
+			return apiError{Status: http.StatusGone, Message: "Session has been voided"}
+		}
 		if session.Attempts >= MaxAttempts {
 			appmetrics.OTPAttempts.WithLabelValues("blocked").Inc()
 			return apiError{Status: http.StatusForbidden, Message: "Too many attempts. Session blocked."}
@@ -603,9 +680,9 @@ func signDocument(ctx context.Context, req SignRequest) (signedURL string, recip
 			return apiError{Status: http.StatusInternalServerError, Message: "Failed to load original PDF"}
 		}
 
-		signedPDF, err := signPDFViaService(ctx, appCfg.PDFSignURL, pdfBytes, certPEM, keyPEM, session.Token)
+		signedPDF, err := signPDF(ctx, pdfBytes, certPEM, keyPEM, session.Token)
 		if err != nil {
-			log.Printf("pdfsigner error: %v", err)
+			log.Printf("pdf signing error (engine=%s): %v", appCfg.SignEngine, err)
 			return apiError{Status: http.StatusInternalServerError, Message: "PDF signing failed"}
 		}
 
@@ -684,6 +761,19 @@ func handleVerifyRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkVerifyOptions(r); err != nil {
+		result := verificationError("error", err.Error())
+		recordVerifyRequest("unknown", result)
+		writeVerificationJSON(w, http.StatusBadRequest, result)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" || mediaType == "application/pdf" {
+		handleVerifyByBody(w, r, mediaType)
+		return
+	}
+
 	var req VerifyRequest
 	if err := decodeJSONBody(w, r, &req); err != nil {
 		var apiErr apiError
@@ -712,142 +802,86 @@ func handleVerifyRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleVerifyByToken(w http.ResponseWriter, r *http.Request, token string) {
-	depStart := time.Now()
-	_, err := redisDB.Get(r.Context(), "doc:"+token).Result()
-	appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			result := verificationError("error", "token not found or expired")
-			recordVerifyRequest("token", result)
-			writeVerificationJSON(w, http.StatusNotFound, result)
-			return
-		}
-		result := verificationError("error", "token lookup failed")
-		recordVerifyRequest("token", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+	statusCode, verification, pdfBytes := verifyByToken(r.Context(), token)
+	finishVerification(w, r, "token", statusCode, verification, pdfBytes)
+}
+
+func verifyByToken(ctx context.Context, token string) (int, VerificationResult, []byte) {
+	if status, message := checkVerifiableToken(ctx, token, time.Now().UTC()); status != http.StatusOK {
+		return status, verificationError("error", message), nil
 	}
 
 	var session SigningSession
-	depStart = time.Now()
-	dbResult := db.WithContext(r.Context()).First(&session, "token = ?", token)
+	depStart := time.Now()
+	dbResult := db.WithContext(ctx).First(&session, "token = ?", token)
 	appmetrics.ObserveDependency("signer", "postgres", "signing_session_lookup", depStart, dbResult.Error)
 	if errors.Is(dbResult.Error, gorm.ErrRecordNotFound) || session.SignedS3Key == "" {
-		result := verificationError("error", "signed document not found")
-		recordVerifyRequest("token", result)
-		writeVerificationJSON(w, http.StatusNotFound, result)
-		return
+		return http.StatusNotFound, verificationError("error", "signed document not found"), nil
 	}
 	if dbResult.Error != nil {
-		result := verificationError("error", "database lookup failed")
-		recordVerifyRequest("token", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "database lookup failed"), nil
 	}
 
 	depStart = time.Now()
-	pdfBytes, err := getObjectBytes(r.Context(), s3Client, appCfg.MinioBucket, session.SignedS3Key)
+	pdfBytes, err := getObjectBytes(ctx, s3Client, appCfg.MinioBucket, session.SignedS3Key)
 	appmetrics.ObserveDependency("signer", "minio", "s3_get", depStart, err)
 	if err != nil {
-		result := verificationError("error", "failed to load signed PDF")
-		recordVerifyRequest("token", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "failed to load signed PDF"), nil
 	}
 
 	log.Printf("verify by token: token=%s signedKey=%s pdfSha=%s", logutil.MaskToken(token), session.SignedS3Key, sha256Hex(pdfBytes))
-	statusCode, verification, err := verifyStoredServicePDF(r.Context(), pdfBytes, token, session.SignedS3Key)
+	statusCode, verification, err := verifyStoredServicePDF(ctx, pdfBytes, token, session.SignedS3Key)
 	if err != nil {
 		log.Printf("pdf verification error: %v", err)
-		result := verificationError("error", "verification service failed")
-		recordVerifyRequest("token", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "verification service failed"), nil
 	}
-
-	recordVerifyRequest("token", verification)
-	writeVerificationJSON(w, statusCode, verification)
+	return statusCode, verification, pdfBytes
 }
 
 func handleVerifyByUploadToken(w http.ResponseWriter, r *http.Request, uploadToken string) {
-	waitCtx, cancel := context.WithTimeout(r.Context(), appCfg.DependencyTimeout)
+	statusCode, verification, pdfBytes := verifyByUploadToken(r.Context(), uploadToken, verifyTenant(r))
+	finishVerification(w, r, "upload", statusCode, verification, pdfBytes)
+}
+
+func verifyByUploadToken(ctx context.Context, uploadToken, tenant string) (int, VerificationResult, []byte) {
+	waitCtx, cancel := context.WithTimeout(ctx, appCfg.DependencyTimeout)
 	defer cancel()
 
 	waitStart := time.Now()
 	val, err := waitForVerifyUpload(waitCtx, uploadToken)
 	appmetrics.VerifyUploadWaitDuration.WithLabelValues(appmetrics.ResultFromErr(err)).Observe(time.Since(waitStart).Seconds())
 	if err != nil {
-		result := verificationError("error", "upload token not found or expired")
-		recordVerifyRequest("upload", result)
-		writeVerificationJSON(w, http.StatusNotFound, result)
-		return
+		return http.StatusNotFound, verificationError("error", "upload token not found or expired"), nil
 	}
 
 	var meta FileMeta
 	if err := json.Unmarshal([]byte(val), &meta); err != nil {
-		result := verificationError("error", "invalid upload metadata")
-		recordVerifyRequest("upload", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "invalid upload metadata"), nil
 	}
 	if strings.TrimSpace(meta.S3Key) == "" {
-		result := verificationError("error", "invalid upload metadata")
-		recordVerifyRequest("upload", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "invalid upload metadata"), nil
 	}
 
 	defer cleanupVerifyUpload(uploadToken, meta.S3Key)
 
 	depStart := time.Now()
-	pdfBytes, err := getObjectBytes(r.Context(), s3Client, appCfg.MinioBucket, meta.S3Key)
+	pdfBytes, err := getObjectBytes(ctx, s3Client, appCfg.MinioBucket, meta.S3Key)
 	appmetrics.ObserveDependency("signer", "minio", "s3_get", depStart, err)
 	if err != nil {
-		result := verificationError("error", "failed to load uploaded PDF")
-		recordVerifyRequest("upload", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "failed to load uploaded PDF"), nil
 	}
 
 	log.Printf("verify by upload token: uploadToken=%s objectKey=%s pdfSha=%s", logutil.MaskToken(uploadToken), meta.S3Key, sha256Hex(pdfBytes))
-	statusCode, verification, err := verifyServiceOwnedPDF(r.Context(), pdfBytes)
+	statusCode, verification, err := verifyServiceOwnedPDF(ctx, pdfBytes, tenant)
 	if err != nil {
 		log.Printf("pdf verification error: %v", err)
-		result := verificationError("error", "verification service failed")
-		recordVerifyRequest("upload", result)
-		writeVerificationJSON(w, http.StatusInternalServerError, result)
-		return
+		return http.StatusInternalServerError, verificationError("error", "verification service failed"), nil
 	}
-
-	recordVerifyRequest("upload", verification)
-	writeVerificationJSON(w, statusCode, verification)
+	return statusCode, verification, pdfBytes
 }
 
 func waitForVerifyUpload(ctx context.Context, uploadToken string) (string, error) {
-	const delay = 300 * time.Millisecond
-
-	var lastErr error
-	for {
-		depStart := time.Now()
-		val, err := redisDB.Get(ctx, "verify:"+uploadToken).Result()
-		appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
-		if err == nil {
-			return val, nil
-		}
-		lastErr = err
-		if err != nil && !errors.Is(err, redis.Nil) {
-			log.Printf("verify upload redis lookup failed for %s: %v", logutil.MaskToken(uploadToken), err)
-		}
-
-		select {
-		case <-ctx.Done():
-			if lastErr == nil {
-				lastErr = ctx.Err()
-			}
-			return "", lastErr
-		case <-time.After(delay):
-		}
-	}
+	return verifyUploads.Wait(ctx, uploadToken)
 }
 
 func generateCode() (string, error) {
@@ -1004,7 +1038,13 @@ func verifyPDFViaService(ctx context.Context, pdfVerifyURL string, pdfBytes []by
 	return resp.StatusCode, body, nil
 }
 
-func verifyServiceOwnedPDF(ctx context.Context, pdfBytes []byte) (int, VerificationResult, error) {
+func verifyServiceOwnedPDF(ctx context.Context, pdfBytes []byte, tenant string) (int, VerificationResult, error) {
+	return withVerifyCache(ctx, pdfBytes, "upload:"+tenant, func() (int, VerificationResult, error) {
+		return verifyRegistryPDF(ctx, pdfBytes, tenant)
+	})
+}
+
+func verifyRegistryPDF(ctx context.Context, pdfBytes []byte, tenant string) (int, VerificationResult, error) {
 	documentHash := sha256Hex(pdfBytes)
 	log.Printf("verify uploaded pdf: documentHash=%s", documentHash)
 
@@ -1015,40 +1055,41 @@ func verifyServiceOwnedPDF(ctx context.Context, pdfBytes []byte) (int, Verificat
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			log.Printf("verify uploaded pdf: no signed_documents match for hash=%s", documentHash)
-			return verifyUnregisteredPDF(ctx, pdfBytes)
+			return verifyUnregisteredPDF(ctx, pdfBytes, tenant)
 		}
 		return 0, VerificationResult{}, result.Error
 	}
 	log.Printf("verify uploaded pdf: matched signed_documents record token=%s signedKey=%s hash=%s", logutil.MaskToken(signedDoc.Token), signedDoc.SignedS3Key, documentHash)
 
-	return verifyViaPDFService(ctx, pdfBytes, true, "uploaded PDF matched signed_documents registry")
+	return verifyViaPDFService(ctx, pdfBytes, true, tenant, "uploaded PDF matched signed_documents registry")
 }
 
 func verifyStoredServicePDF(ctx context.Context, pdfBytes []byte, token, signedS3Key string) (int, VerificationResult, error) {
 	log.Printf("verify stored service pdf: token=%s signedKey=%s pdfSha=%s", logutil.MaskToken(token), signedS3Key, sha256Hex(pdfBytes))
-	return verifyViaPDFService(ctx, pdfBytes, true, "stored service PDF verified via token lookup")
+	return withVerifyCache(ctx, pdfBytes, "stored", func() (int, VerificationResult, error) {
+		return verifyViaPDFService(ctx, pdfBytes, true, "", "stored service PDF verified via token lookup")
+	})
 }
 
-func verifyViaPDFService(ctx context.Context, pdfBytes []byte, serviceOwned bool, logPrefix string) (int, VerificationResult, error) {
-	statusCode, respBody, err := verifyPDFViaService(ctx, derivePDFVerifyURL(appCfg.PDFSignURL), pdfBytes)
+func verifyViaPDFService(ctx context.Context, pdfBytes []byte, serviceOwned bool, tenant, logPrefix string) (int, VerificationResult, error) {
+	resp, engine, err := verifyWithEngine(ctx, pdfBytes)
+	var failure verifyFailure
+	if errors.As(err, &failure) {
+		return http.StatusInternalServerError, verificationError("error", failure.message), nil
+	}
 	if err != nil {
 		return 0, VerificationResult{}, err
 	}
-	if statusCode == http.StatusBadRequest {
-		return http.StatusInternalServerError, verificationError("error", "stored signed PDF could not be verified"), nil
-	}
-	if statusCode != http.StatusOK {
-		return http.StatusInternalServerError, verificationError("error", "verification service returned an unexpected response"), nil
-	}
 
-	var verification VerificationResult
-	if err := json.Unmarshal(respBody, &verification); err != nil {
-		return 0, VerificationResult{}, err
-	}
+	verification := resp.VerificationResult
+	verification.CertificateChain = resp.CertificateChain
 	verification.ServiceOwned = serviceOwned
+	verification.Engine = engine
+	verification.Signatures = evaluateSignatureChains(resp.Signatures, tenant, time.Now())
 	log.Printf(
-		"%s: status=%s signaturePresent=%t integrityValid=%t certSha=%v",
+		"%s: engine=%s status=%s signaturePresent=%t integrityValid=%t certSha=%v",
 		logPrefix,
+		engine,
 		verification.Status,
 		verification.SignaturePresent,
 		verification.IntegrityValid,
@@ -1057,20 +1098,63 @@ func verifyViaPDFService(ctx context.Context, pdfBytes []byte, serviceOwned bool
 	return http.StatusOK, verification, nil
 }
 
-func verifyUnregisteredPDF(ctx context.Context, pdfBytes []byte) (int, VerificationResult, error) {
-	statusCode, verification, err := verifyViaPDFService(ctx, pdfBytes, false, "verify uploaded pdf: unregistered artifact")
+func verifyUnregisteredPDF(ctx context.Context, pdfBytes []byte, tenant string) (int, VerificationResult, error) {
+	statusCode, verification, err := verifyViaPDFService(ctx, pdfBytes, false, tenant, "verify uploaded pdf: unregistered artifact")
 	if err != nil {
 		return 0, VerificationResult{}, err
 	}
 
-	if verification.Status == "verified" {
-		msg := "document is not signed by this service"
-		verification.Status = "unknown_document"
-		verification.ServiceOwned = false
-		verification.Error = &msg
+	return statusCode, applyTrustStore(verification, tenant, time.Now()), nil
+}
+
+// applyTrustStore decides what an intact signature from outside the registry
+// means: verified_external when its chain ends at a configured trust anchor,
+// unknown_document otherwise.
+func applyTrustStore(verification VerificationResult, tenant string, now time.Time) VerificationResult {
+	if verification.Status != "verified" {
+		return verification
+	}
+
+	msg := "document is not signed by this service"
+	if trustStore != nil {
+		chain := trustStore.Evaluate(verification.CertificateChain, tenant, now)
+		trusted := chain.Trusted
+		verification.Chain = &chain
+		verification.CertificateTrusted = &trusted
+		if trusted {
+			verification.Status = "verified_external"
+			return verification
+		}
+		log.Printf("verify uploaded pdf: chain not trusted tenant=%q: %s", tenant, chain.Error)
+		msg = "document is not signed by this service or a trusted CA"
 	}
+	verification.Status = "unknown_document"
+	verification.ServiceOwned = false
+	verification.Error = &msg
+	return verification
+}
 
-	return statusCode, verification, nil
+// checkVerifyOptions validates the query parameters shared by the single and
+// batch verify routes.
+func checkVerifyOptions(r *http.Request) error {
+	if wantsReceipt(r) && receiptKeys == nil {
+		return errors.New("verification receipts are not enabled")
+	}
+	return checkVerifyTenant(verifyTenant(r))
+}
+
+func verifyTenant(r *http.Request) string {
+	return strings.TrimSpace(r.URL.Query().Get("tenant"))
+}
+
+func checkVerifyTenant(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	if trustStore == nil {
+		return truststore.ErrUnknownTenant
+	}
+	return trustStore.CheckTenant(tenant)
 }
 
 func derivePDFVerifyURL(pdfSignURL string) string {
@@ -1161,6 +1245,8 @@ func signResult(statusCode int, err error) string {
 		return "not_found"
 	case http.StatusUnauthorized:
 		return "invalid_code"
+	case http.StatusGone:
+		return "voided"
 	case http.StatusForbidden:
 		if strings.Contains(strings.ToLower(err.Error()), "already signed") {
 			return "already_signed"
@@ -1,16 +1,36 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/linksign"
 	"github.com/yarlKot1904/signer/internal/mailer"
+	"github.com/yarlKot1904/signer/internal/pdfsig"
+	"github.com/yarlKot1904/signer/internal/receipt"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"github.com/yarlKot1904/signer/internal/truststore"
 )
 
 func TestHandleSignRequestSendsSignedDocumentNotification(t *testing.T) {
@@ -76,3 +96,900 @@ func TestHandleSignRequestSendsSignedDocumentNotification(t *testing.T) {
 		t.Fatalf("unexpected signed view url: %s", gotNotification.Variables["signed_view_url"])
 	}
 }
+
+func TestBuildSignedDocumentNotificationUsesSignedLinks(t *testing.T) {
+	previousCfg := appCfg
+	previousKeys := linkKeys
+	defer func() {
+		appCfg = previousCfg
+		linkKeys = previousKeys
+	}()
+	appCfg = &config.Config{PublicBaseURL: "http://localhost", SignedLinkTTL: 48 * time.Hour}
+	keys, err := linksign.ParseKeys([]string{"k1:0000000000000000000000000000000000000000000000000000000000000001"})
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	linkKeys = keys
+
+	req := buildSignedDocumentNotification("user@example.com", "abc-token", "/download/abc-token?signed=1", time.Now().Add(48*time.Hour))
+
+	for name, disposition := range map[string]linksign.Disposition{"signed_download_url": linksign.Attachment, "signed_view_url": linksign.Inline} {
+		u, err := url.Parse(req.Variables[name])
+		if err != nil || u.Path != "/link/abc-token" {
+			t.Fatalf("%s: unexpected url %q", name, req.Variables[name])
+		}
+		link, err := keys.Verify("abc-token", u.Query(), time.Now())
+		if err != nil {
+			t.Fatalf("%s: link does not verify: %v", name, err)
+		}
+		if link.Artifact != linksign.Signed || link.Disposition != disposition {
+			t.Fatalf("%s: unexpected link %+v", name, link)
+		}
+		if until := time.Until(link.ExpiresAt); until < 47*time.Hour || until > 48*time.Hour {
+			t.Fatalf("%s: unexpected expiry %s", name, link.ExpiresAt)
+		}
+	}
+}
+
+func TestBuildSignedDocumentNotificationFallsBackAfterLinkExpiry(t *testing.T) {
+	previousCfg := appCfg
+	previousKeys := linkKeys
+	defer func() {
+		appCfg = previousCfg
+		linkKeys = previousKeys
+	}()
+	appCfg = &config.Config{PublicBaseURL: "http://localhost", SignedLinkTTL: 48 * time.Hour}
+	keys, err := linksign.ParseKeys([]string{"k1:0000000000000000000000000000000000000000000000000000000000000001"})
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	linkKeys = keys
+
+	req := buildSignedDocumentNotification("user@example.com", "abc-token", "", time.Now().Add(-time.Minute))
+	if got := req.Variables["signed_download_url"]; got != "http://localhost/download/abc-token?signed=1" {
+		t.Fatalf("expected the plain download link, got %q", got)
+	}
+}
+
+func TestCapLinkExpiry(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-time.Hour)
+	tokenExpiry := now.Add(24 * time.Hour)
+
+	cases := []struct {
+		name      string
+		doc       Document
+		retention time.Duration
+		want      time.Time
+	}{
+		{"ttl", Document{CreatedAt: created}, 0, now.Add(720 * time.Hour)},
+		{"outlives token", Document{CreatedAt: created, ExpiresAt: &tokenExpiry}, 8760 * time.Hour, now.Add(720 * time.Hour)},
+		{"token expiry without retention", Document{CreatedAt: created, ExpiresAt: &tokenExpiry}, 0, tokenExpiry},
+		{"retention", Document{CreatedAt: created, ExpiresAt: &tokenExpiry}, 10 * time.Hour, created.Add(10 * time.Hour)},
+	}
+	for _, tc := range cases {
+		if got := capLinkExpiry(tc.doc, now, 720*time.Hour, tc.retention); !got.Equal(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReminderDueConditionRepeatsLastThreshold(t *testing.T) {
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	sql, args := reminderDueCondition(now, []time.Duration{4 * time.Hour, 20 * time.Hour}, 3)
+
+	if strings.Count(sql, "reminders_sent = ?") != 3 {
+		t.Fatalf("expected one clause per reminder, got %s", sql)
+	}
+	if strings.Count(sql, "notification_sent_at <= ?") != 2 || strings.Count(sql, "last_reminder_at <= ?") != 1 {
+		t.Fatalf("expected the repeated threshold to count from the last reminder, got %s", sql)
+	}
+	want := []any{
+		0, now.Add(-4 * time.Hour),
+		1, now.Add(-20 * time.Hour),
+		2, now.Add(-20 * time.Hour),
+	}
+	if len(args) != len(want) {
+		t.Fatalf("unexpected args: %v", args)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Fatalf("arg %d: got %v, want %v", i, args[i], want[i])
+		}
+	}
+
+	if sql, _ := reminderDueCondition(now, []time.Duration{time.Hour}, 0); sql != "1 = 0" {
+		t.Fatalf("expected no reminders to match nothing, got %s", sql)
+	}
+}
+
+func TestBuildSigningReminder(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{PublicBaseURL: "http://localhost"}
+
+	req := buildSigningReminder(SigningSession{Token: "abc-token", Email: "user@example.com"}, "654321", 2)
+
+	if req.Template != mailer.TemplateSigningReminder {
+		t.Fatalf("unexpected template: %s", req.Template)
+	}
+	if req.MessageID != "abc-token:reminder:2" {
+		t.Fatalf("unexpected message id: %s", req.MessageID)
+	}
+	if req.Variables["code"] != "654321" || req.Variables["reminder"] != "2" {
+		t.Fatalf("unexpected variables: %v", req.Variables)
+	}
+	if _, err := mailer.Render(req); err != nil {
+		t.Fatalf("reminder does not render: %v", err)
+	}
+}
+
+func TestValidateReminderThresholds(t *testing.T) {
+	if err := validateReminderThresholds([]time.Duration{4 * time.Hour, 20 * time.Hour}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := validateReminderThresholds([]time.Duration{20 * time.Hour, 4 * time.Hour}); err == nil {
+		t.Fatal("expected descending thresholds to be rejected")
+	}
+}
+
+func TestDocumentStatus(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	retention := 30 * 24 * time.Hour
+
+	if status, _ := documentStatus(Document{CreatedAt: created}, created.Add(48*time.Hour), retention); status != http.StatusOK {
+		t.Fatalf("expected token past its link expiry to stay verifiable, got %d", status)
+	}
+	if status, _ := documentStatus(Document{CreatedAt: created}, created.Add(retention), retention); status != http.StatusNotFound {
+		t.Fatalf("expected token past retention to be rejected, got %d", status)
+	}
+	revokedAt := created.Add(time.Hour)
+	if status, _ := documentStatus(Document{CreatedAt: created, RevokedAt: &revokedAt}, created.Add(2*time.Hour), retention); status != http.StatusGone {
+		t.Fatalf("expected revoked token to be gone, got %d", status)
+	}
+}
+
+func TestReadVerifyPDF(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{UploadMaxBytes: 32}
+
+	pdf := []byte("%PDF-1.7\n%%EOF")
+	readBody := func(mediaType string, body []byte, contentType string) ([]byte, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/verify", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		return readVerifyPDF(httptest.NewRecorder(), req, mediaType)
+	}
+
+	if got, err := readBody("application/pdf", pdf, "application/pdf"); err != nil || !bytes.Equal(got, pdf) {
+		t.Fatalf("unexpected raw body result: %q %v", got, err)
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("note", "ignored")
+	fw, _ := mw.CreateFormFile("file", "signed.pdf")
+	_, _ = fw.Write(pdf)
+	_ = mw.Close()
+	if got, err := readBody("multipart/form-data", form.Bytes(), mw.FormDataContentType()); err != nil || !bytes.Equal(got, pdf) {
+		t.Fatalf("unexpected multipart result: %q %v", got, err)
+	}
+
+	cases := []struct {
+		name   string
+		body   []byte
+		status int
+	}{
+		{"too large", append(append([]byte{}, pdf...), bytes.Repeat([]byte("x"), 40)...), http.StatusRequestEntityTooLarge},
+		{"not a pdf", []byte("hello"), http.StatusBadRequest},
+		{"empty", nil, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		_, err := readBody("application/pdf", tc.body, "application/pdf")
+		var apiErr apiError
+		if !errors.As(err, &apiErr) || apiErr.Status != tc.status {
+			t.Fatalf("%s: expected status %d, got %v", tc.name, tc.status, err)
+		}
+	}
+
+	form.Reset()
+	mw = multipart.NewWriter(&form)
+	_ = mw.WriteField("note", "no file")
+	_ = mw.Close()
+	if _, err := readBody("multipart/form-data", form.Bytes(), mw.FormDataContentType()); err == nil || err.Error() != "file part is required" {
+		t.Fatalf("expected missing file part to be rejected, got %v", err)
+	}
+}
+
+func TestHandleVerifyRequestRejectsNonPDFBody(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{UploadMaxBytes: 1024}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify", strings.NewReader("not a pdf"))
+	req.Header.Set("Content-Type", "application/pdf")
+	rec := httptest.NewRecorder()
+	handleVerifyRequest(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+	var result VerificationResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.Status != "error" {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+}
+
+func TestParseDocumentHash(t *testing.T) {
+	upper := strings.Repeat("AB", 32)
+	if hash, ok := parseDocumentHash(upper); !ok || hash != strings.ToLower(upper) {
+		t.Fatalf("expected uppercase hash to be normalised, got %q %t", hash, ok)
+	}
+	for _, raw := range []string{"", "abc", strings.Repeat("zz", 32), strings.Repeat("ab", 32) + "/x"} {
+		if _, ok := parseDocumentHash(raw); ok {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestHashRegistration(t *testing.T) {
+	signedAt := time.Date(2026, 3, 11, 10, 15, 30, 0, time.FixedZone("MSK", 3*60*60))
+	signedDoc := SignedDocument{
+		Token:         "secret-token",
+		SignedS3Key:   "signed/secret-token.pdf",
+		SignedPDFSHA:  strings.Repeat("ab", 32),
+		CertSHA:       strings.Repeat("cd", 32),
+		SignerSubject: "CN=user@example.com,O=CryptoSigner Demo",
+		SignedAt:      signedAt,
+	}
+
+	got := hashRegistration(signedDoc, Document{})
+	if got.SignerSubject != "CN=u***@e******.com,O=CryptoSigner Demo" {
+		t.Fatalf("unexpected subject: %s", got.SignerSubject)
+	}
+	if got.SignedAt != "2026-03-11T07:15:30Z" || got.LinkRevoked || !got.Registered {
+		t.Fatalf("unexpected registration: %+v", got)
+	}
+	body, _ := json.Marshal(got)
+	if strings.Contains(string(body), "secret-token") {
+		t.Fatalf("registration leaks the token: %s", body)
+	}
+
+	revokedAt := signedAt.Add(time.Hour)
+	if got := hashRegistration(signedDoc, Document{RevokedAt: &revokedAt}); !got.LinkRevoked {
+		t.Fatalf("expected the revoked link to be reported, got %+v", got)
+	}
+}
+
+func TestHandleVerifyByHashRejectsBadHash(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/verify/hash/not-a-hash", nil)
+	rec := httptest.NewRecorder()
+	handleVerifyByHash(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/verify/hash/"+strings.Repeat("ab", 32), nil)
+	rec = httptest.NewRecorder()
+	handleVerifyByHash(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestVerificationReceiptRoundTrip(t *testing.T) {
+	previousCfg, previousKeys := appCfg, receiptKeys
+	defer func() { appCfg, receiptKeys = previousCfg, previousKeys }()
+	appCfg = &config.Config{PublicBaseURL: "https://signer.example", JSONMaxBytes: 1 << 20}
+	keys, err := receipt.ParseKeys([]string{"r1:" + strings.Repeat("01", 32)})
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	receiptKeys = keys
+
+	pdfBytes := []byte("%PDF-1.7 test")
+	subject := "CN=user@example.com"
+	req := httptest.NewRequest(http.MethodPost, "/api/verify?receipt=true", nil)
+	rec := httptest.NewRecorder()
+	finishVerification(rec, req, "direct", http.StatusOK, VerificationResult{Status: "verified", ServiceOwned: true, SignerSubject: &subject}, pdfBytes)
+
+	var result VerificationResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.Receipt == nil {
+		t.Fatalf("expected a receipt, got %s", rec.Body.String())
+	}
+
+	body, _ := json.Marshal(ReceiptValidationRequest{Receipt: *result.Receipt})
+	req = httptest.NewRequest(http.MethodPost, "/api/verify/receipt", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handleValidateReceipt(rec, req)
+
+	var validation ReceiptValidation
+	if err := json.Unmarshal(rec.Body.Bytes(), &validation); err != nil || !validation.Valid {
+		t.Fatalf("expected a valid receipt, got %s", rec.Body.String())
+	}
+	if validation.DocumentSHA256 != sha256Hex(pdfBytes) || validation.Issuer != "https://signer.example" {
+		t.Fatalf("unexpected validation: %+v", validation)
+	}
+	var signed VerificationResult
+	if err := json.Unmarshal(validation.Verification, &signed); err != nil || signed.Status != "verified" || signed.Receipt != nil {
+		t.Fatalf("unexpected signed verification: %s", validation.Verification)
+	}
+
+	body, _ = json.Marshal(ReceiptValidationRequest{Receipt: *result.Receipt + "x"})
+	req = httptest.NewRequest(http.MethodPost, "/api/verify/receipt", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handleValidateReceipt(rec, req)
+	if err := json.Unmarshal(rec.Body.Bytes(), &validation); err != nil || validation.Valid {
+		t.Fatalf("expected a tampered receipt to be rejected, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleVerifyRequestRejectsReceiptWithoutKeys(t *testing.T) {
+	previousKeys := receiptKeys
+	defer func() { receiptKeys = previousKeys }()
+	receiptKeys = nil
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify?receipt=1", strings.NewReader(`{"token":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleVerifyRequest(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestApplyTrustStore(t *testing.T) {
+	previousStore := trustStore
+	defer func() { trustStore = previousStore }()
+
+	trustedPEM := testCertificatePEM(t, "partner@example.com")
+	otherPEM := testCertificatePEM(t, "stranger@example.com")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "partner.pem"), trustedPEM, 0o644); err != nil {
+		t.Fatalf("write anchor: %v", err)
+	}
+
+	trustStore = nil
+	got := applyTrustStore(VerificationResult{Status: "verified", CertificateChain: []string{certificateDER(t, trustedPEM)}}, "", time.Now())
+	if got.Status != "unknown_document" || got.CertificateTrusted != nil || got.Chain != nil {
+		t.Fatalf("expected unknown_document without a trust store, got %+v", got)
+	}
+
+	store, err := truststore.Load(dir)
+	if err != nil {
+		t.Fatalf("load trust store: %v", err)
+	}
+	trustStore = store
+
+	got = applyTrustStore(VerificationResult{Status: "verified", CertificateChain: []string{certificateDER(t, trustedPEM)}}, "", time.Now())
+	if got.Status != "verified_external" || got.CertificateTrusted == nil || !*got.CertificateTrusted || got.Chain == nil || len(got.Chain.Certificates) != 1 {
+		t.Fatalf("expected verified_external, got %+v", got)
+	}
+
+	got = applyTrustStore(VerificationResult{Status: "verified", CertificateChain: []string{certificateDER(t, otherPEM)}}, "", time.Now())
+	if got.Status != "unknown_document" || got.CertificateTrusted == nil || *got.CertificateTrusted || got.Chain.Error == "" {
+		t.Fatalf("expected untrusted chain to stay unknown_document, got %+v", got)
+	}
+
+	got = applyTrustStore(VerificationResult{Status: "invalid_signature", CertificateChain: []string{certificateDER(t, trustedPEM)}}, "", time.Now())
+	if got.Status != "invalid_signature" || got.Chain != nil {
+		t.Fatalf("expected invalid signatures to be left alone, got %+v", got)
+	}
+
+	if err := checkVerifyTenant("missing"); !errors.Is(err, truststore.ErrUnknownTenant) {
+		t.Fatalf("expected unknown tenant, got %v", err)
+	}
+}
+
+func testCertificatePEM(t *testing.T, email string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	certPEM, _, err := generateSelfSignedCertPEM(email, key)
+	if err != nil {
+		t.Fatalf("generate certificate: %v", err)
+	}
+	return certPEM
+}
+
+func certificateDER(t *testing.T, certPEM []byte) string {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("bad certificate PEM")
+	}
+	return base64.StdEncoding.EncodeToString(block.Bytes)
+}
+
+func TestValidateVerifyBatch(t *testing.T) {
+	if err := validateVerifyBatch([]VerifyRequest{{Token: "a"}, {UploadToken: "b"}}, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, items := range map[string][]VerifyRequest{
+		"empty":    nil,
+		"too many": {{Token: "a"}, {Token: "b"}, {Token: "c"}},
+		"neither":  {{Token: "a"}, {}},
+		"both":     {{Token: "a", UploadToken: "b"}},
+	} {
+		if err := validateVerifyBatch(items, 2); err == nil {
+			t.Fatalf("expected %s batch to be rejected", name)
+		}
+	}
+
+	items := []VerifyRequest{{Token: "  ", UploadToken: "x"}, {Token: " a "}}
+	if err := validateVerifyBatch(items, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if items[0].Token != "" || items[0].UploadToken != "x" || items[1].Token != "a" {
+		t.Fatalf("expected tokens to be trimmed, got %+v", items)
+	}
+}
+
+func TestHandleVerifyBatchStreamsEveryItem(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{JSONMaxBytes: 1 << 20, VerifyBatchWorkers: 2, VerifyBatchMaxItems: 10, VerifyBatchTimeout: time.Minute}
+
+	// A cancelled request makes every item fail fast without touching storage.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body := `{"items":[{"token":"a"},{"upload_token":"b"},{"token":"c"}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/batch", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	handleVerifyBatch(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	seen := map[int]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		var item VerifyBatchItem
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		if item.HTTPStatus != http.StatusGatewayTimeout || item.Result.Status != "error" {
+			t.Fatalf("unexpected item: %+v", item)
+		}
+		seen[item.Index] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected three distinct items, got %v", seen)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/verify/batch", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	handleVerifyBatch(rec, req)
+
+	var resp VerifyBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Items) != 3 {
+		t.Fatalf("unexpected body: %s", rec.Body.String())
+	}
+	for i, item := range resp.Items {
+		if item.Index != i {
+			t.Fatalf("expected items in request order, got %+v", resp.Items)
+		}
+	}
+	if resp.Items[1].UploadToken != "b" {
+		t.Fatalf("unexpected item: %+v", resp.Items[1])
+	}
+}
+
+func TestRunVerifyBatchRecoversPanics(t *testing.T) {
+	previousCfg, previousDB := appCfg, db
+	defer func() { appCfg, db = previousCfg, previousDB }()
+	// Without a database the token lookup panics on a nil *gorm.DB.
+	appCfg = &config.Config{DependencyTimeout: time.Second, DocumentRetention: time.Hour}
+	db = nil
+
+	req := httptest.NewRequest(http.MethodPost, "/api/verify/batch", nil)
+	var got []VerifyBatchItem
+	for item := range runVerifyBatch(context.Background(), req, []VerifyRequest{{Token: "a"}, {Token: "b"}}, 2) {
+		got = append(got, item)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected both items to finish, got %+v", got)
+	}
+	for _, item := range got {
+		if item.HTTPStatus != http.StatusInternalServerError || item.Result.Status != "error" {
+			t.Fatalf("expected the panic to become an item error, got %+v", item)
+		}
+	}
+}
+
+func TestVerifyUploadWaiterWakesOnNotification(t *testing.T) {
+	var mu sync.Mutex
+	stored := ""
+	lookups := 0
+	waiter := &verifyUploadWaiter{
+		recheck: time.Hour,
+		waiters: map[string]map[chan struct{}]struct{}{},
+		lookup: func(_ context.Context, uploadToken string) (string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			if stored == "" {
+				return "", redis.Nil
+			}
+			return stored, nil
+		},
+	}
+
+	done := make(chan string, 1)
+	go func() {
+		val, err := waiter.Wait(context.Background(), "upload-1")
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		done <- val
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		waiter.mu.Lock()
+		registered := len(waiter.waiters["upload-1"]) == 1
+		waiter.mu.Unlock()
+		mu.Lock()
+		looked := lookups > 0
+		mu.Unlock()
+		if registered && looked {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("waiter did not register")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	stored = `{"s3_key":"verify/a.pdf"}`
+	mu.Unlock()
+	waiter.notify("other-upload")
+	waiter.notify("upload-1")
+
+	select {
+	case val := <-done:
+		if val != `{"s3_key":"verify/a.pdf"}` {
+			t.Fatalf("unexpected metadata: %s", val)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter was not woken by the notification")
+	}
+	if len(waiter.waiters) != 0 {
+		t.Fatalf("expected waiter to unregister, got %v", waiter.waiters)
+	}
+}
+
+func TestVerifyUploadWaiterStopsAtDeadline(t *testing.T) {
+	waiter := &verifyUploadWaiter{
+		recheck: time.Hour,
+		waiters: map[string]map[chan struct{}]struct{}{},
+		lookup: func(context.Context, string) (string, error) {
+			return "", redis.Nil
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := waiter.Wait(ctx, "upload-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+}
+
+func TestVerifyCacheKey(t *testing.T) {
+	base := verifyCacheKey("abc", "upload:", 3, "none")
+	if base != "verify:result:v3:abc:upload::r3:tnone" {
+		t.Fatalf("unexpected key: %s", base)
+	}
+	for _, other := range []string{
+		verifyCacheKey("abc", "upload:acme", 3, "none"),
+		verifyCacheKey("abc", "stored", 3, "none"),
+		verifyCacheKey("abc", "upload:", 4, "none"),
+		verifyCacheKey("abc", "upload:", 3, "0123456789abcdef"),
+	} {
+		if other == base {
+			t.Fatalf("expected %s to differ from %s", other, base)
+		}
+	}
+}
+
+func TestVerifyCacheRetiresResultsOnRevoke(t *testing.T) {
+	previousCfg, previousRedis := appCfg, redisDB
+	defer func() { appCfg, redisDB = previousCfg, previousRedis }()
+	mr := miniredis.RunT(t)
+	redisDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer redisDB.Close()
+	appCfg = &config.Config{VerifyCacheTTL: time.Hour}
+
+	ctx := context.Background()
+	calls := 0
+	verify := func() (int, VerificationResult, error) {
+		calls++
+		return http.StatusOK, VerificationResult{Status: "verified", Engine: verifyEnginePDFSigner}, nil
+	}
+	pdf := []byte("%PDF-1.7 cached")
+	for range 2 {
+		if _, _, err := withVerifyCache(ctx, pdf, "stored", verify); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the second lookup to hit the cache, got %d calls", calls)
+	}
+
+	if err := tokenpolicy.Revoke(ctx, redisDB, "abc-token", time.Hour); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := withVerifyCache(ctx, pdf, "stored", verify); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected a revocation to retire the cached result, got %d calls", calls)
+	}
+}
+
+func TestCacheableVerification(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		result VerificationResult
+		want   bool
+	}{
+		{http.StatusOK, VerificationResult{Status: "verified", Engine: verifyEnginePDFSigner}, true},
+		{http.StatusOK, VerificationResult{Status: "invalid_signature", Engine: verifyEnginePDFSigner}, true},
+		{http.StatusOK, VerificationResult{Status: "verified", Engine: verifyEngineGo}, false},
+		{http.StatusOK, VerificationResult{Status: "error", Engine: verifyEnginePDFSigner}, false},
+		{http.StatusBadGateway, VerificationResult{Status: "verified", Engine: verifyEnginePDFSigner}, false},
+	} {
+		if got := cacheableVerification(tc.status, tc.result); got != tc.want {
+			t.Fatalf("cacheableVerification(%d, %+v) = %v, want %v", tc.status, tc.result, got, tc.want)
+		}
+	}
+}
+
+func TestWithVerifyCacheDisabled(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{VerifyCacheTTL: 0}
+
+	calls := 0
+	verify := func() (int, VerificationResult, error) {
+		calls++
+		return http.StatusOK, VerificationResult{Status: "verified"}, nil
+	}
+	for range 2 {
+		if status, result, err := withVerifyCache(context.Background(), []byte("%PDF-1.7"), "stored", verify); err != nil || status != http.StatusOK || result.Status != "verified" {
+			t.Fatalf("unexpected result: %d %+v %v", status, result, err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected every call to reach the verifier, got %d", calls)
+	}
+}
+
+func TestSignatureDetailsContract(t *testing.T) {
+	previousStore := trustStore
+	defer func() { trustStore = previousStore }()
+
+	trustedPEM := testCertificatePEM(t, "partner@example.com")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "partner.pem"), trustedPEM, 0o644); err != nil {
+		t.Fatalf("write anchor: %v", err)
+	}
+	store, err := truststore.Load(dir)
+	if err != nil {
+		t.Fatalf("load trust store: %v", err)
+	}
+
+	body := `{
+		"status": "verified", "signature_present": true, "integrity_valid": true,
+		"signatures": [
+			{"index": 0, "status": "verified", "integrity_valid": true, "byte_range": [0, 100, 200, 50],
+			 "covers_whole_document": false, "certificate_chain": ["` + certificateDER(t, trustedPEM) + `"]},
+			{"index": 1, "status": "invalid_signature", "integrity_valid": false, "byte_range": [0, 300, 400, 80],
+			 "covers_whole_document": true, "error": "Signature integrity check failed"}
+		]
+	}`
+	var resp pdfVerifyResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("decode pdfsigner response: %v", err)
+	}
+
+	trustStore = nil
+	if got := evaluateSignatureChains(resp.Signatures, "", time.Now()); len(got) != 2 || got[0].Chain != nil || got[0].CertificateTrusted != nil {
+		t.Fatalf("expected no chain status without a trust store, got %+v", got)
+	}
+
+	trustStore = store
+	got := evaluateSignatureChains(resp.Signatures, "", time.Now())
+	if len(got) != 2 || got[0].CertificateTrusted == nil || !*got[0].CertificateTrusted || got[0].Chain == nil {
+		t.Fatalf("expected the first signature to be trusted, got %+v", got[0])
+	}
+	if got[0].CoversWholeDocument || len(got[0].ByteRange) != 4 || got[0].ByteRange[3] != 50 {
+		t.Fatalf("unexpected byte range details: %+v", got[0])
+	}
+	if got[1].Chain != nil || !got[1].CoversWholeDocument || got[1].Error == nil {
+		t.Fatalf("expected the second signature without a chain, got %+v", got[1])
+	}
+
+	verification := VerificationResult{Status: "verified", Signatures: got}
+	v1 := httptest.NewRequest(http.MethodPost, "/api/verify", nil)
+	if out := verificationForAPI(v1, verification); out.Signatures != nil {
+		t.Fatalf("expected v1 responses to omit signatures, got %+v", out.Signatures)
+	}
+	v2 := httptest.NewRequest(http.MethodPost, verifyV2Path, nil)
+	if out := verificationForAPI(v2, verification); len(out.Signatures) != 2 {
+		t.Fatalf("expected v2 responses to keep signatures, got %+v", out.Signatures)
+	}
+}
+
+func TestVerifyFallsBackToGoEngine(t *testing.T) {
+	previousCfg, previousClient := appCfg, httpClient
+	defer func() { appCfg, httpClient = previousCfg, previousClient }()
+	httpClient = http.DefaultClient
+
+	pdfsignerStatus := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pdfsignerStatus != http.StatusOK {
+			http.Error(w, "unavailable", pdfsignerStatus)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"status": "unsigned", "signature_present": false, "integrity_valid": false, "signatures": []any{}})
+	}))
+	defer server.Close()
+
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n%%EOF\n")
+	appCfg = &config.Config{PDFSignURL: server.URL + "/sign", VerifyEngine: verifyEnginePDFSigner}
+
+	status, got, err := verifyViaPDFService(context.Background(), pdf, false, "", "test")
+	if err != nil || status != http.StatusOK || got.Engine != verifyEngineGo || got.Status != "unsigned" {
+		t.Fatalf("expected the Go verifier to answer, got %d %+v %v", status, got, err)
+	}
+
+	pdfsignerStatus = http.StatusBadRequest
+	status, got, _ = verifyViaPDFService(context.Background(), pdf, false, "", "test")
+	if status != http.StatusInternalServerError || got.Status != "error" || got.Engine != "" {
+		t.Fatalf("expected pdfsigner's rejection to stand, got %d %+v", status, got)
+	}
+
+	pdfsignerStatus = http.StatusOK
+	for _, engine := range []string{verifyEnginePDFSigner, verifyEngineCrossCheck} {
+		appCfg.VerifyEngine = engine
+		status, got, err = verifyViaPDFService(context.Background(), pdf, false, "", "test")
+		if err != nil || status != http.StatusOK || got.Engine != verifyEnginePDFSigner {
+			t.Fatalf("%s: expected pdfsigner to answer, got %d %+v %v", engine, status, got, err)
+		}
+	}
+
+	server.Close()
+	appCfg.VerifyEngine = verifyEngineGo
+	status, got, err = verifyViaPDFService(context.Background(), pdf, false, "", "test")
+	if err != nil || status != http.StatusOK || got.Engine != verifyEngineGo {
+		t.Fatalf("expected the Go engine without pdfsigner, got %d %+v %v", status, got, err)
+	}
+
+	if err := validateVerifyEngine("pdfbox"); err == nil {
+		t.Fatal("expected an unknown engine to be rejected")
+	}
+}
+
+func TestDescribeGoSignatureStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status string
+		msg    string
+	}{
+		{pdfsig.ErrUnsupportedAlgorithm, "error", "Unsupported signature algorithm"},
+		{pdfsig.ErrUnsupportedContent, "error", "Unsupported CMS signature content"},
+		{pdfsig.ErrDigestMismatch, "invalid_signature", "Signature integrity check failed"},
+	} {
+		got := describeGoSignature(pdfsig.Signature{Err: tc.err})
+		if got.Status != tc.status || got.Error == nil || *got.Error != tc.msg {
+			t.Fatalf("%v: expected %s %q, got %+v", tc.err, tc.status, tc.msg, got.SignatureDetail)
+		}
+	}
+}
+
+func TestSignPDFWithGoEngine(t *testing.T) {
+	previousCfg := appCfg
+	defer func() { appCfg = previousCfg }()
+	appCfg = &config.Config{SignEngine: signEngineGo, VerifyEngine: verifyEngineGo}
+
+	certPEM, keyPEM := testSigningMaterial(t)
+	signed, err := signPDF(context.Background(), testUnsignedPDF(), certPEM, keyPEM, "doc-1")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	status, got, err := verifyViaPDFService(context.Background(), signed, false, "", "test")
+	block, _ := pem.Decode(certPEM)
+	if err != nil || status != http.StatusOK || got.Status != "verified" || !got.IntegrityValid {
+		t.Fatalf("expected the Go-signed PDF to verify, got %d %+v %v", status, got, err)
+	}
+	if got.CertificateSHA256 == nil || *got.CertificateSHA256 != sha256Hex(block.Bytes) || got.SignerCN == nil || *got.SignerCN != "user@example.com" {
+		t.Fatalf("expected the signing certificate to be reported, got %+v", got)
+	}
+
+	if err := validateSignEngine("itext"); err == nil {
+		t.Fatal("expected an unknown engine to be rejected")
+	}
+}
+
+// TestGoSignedPDFPassesPDFSigner sends a Go-signed PDF to a running pdfsigner,
+// so the Go engine's output is checked by PDFBox rather than by itself.
+func TestGoSignedPDFPassesPDFSigner(t *testing.T) {
+	signURL := os.Getenv("SIGNER_TEST_PDFSIGNER_URL")
+	if signURL == "" {
+		t.Skip("SIGNER_TEST_PDFSIGNER_URL not set")
+	}
+	previousCfg, previousClient := appCfg, httpClient
+	defer func() { appCfg, httpClient = previousCfg, previousClient }()
+	appCfg = &config.Config{PDFSignURL: signURL, VerifyEngine: verifyEnginePDFSigner}
+	httpClient = http.DefaultClient
+
+	certPEM, keyPEM := testSigningMaterial(t)
+	signed, err := signPDFInGo(testUnsignedPDF(), certPEM, keyPEM, "doc-1", time.Now())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	remote, err := verifyPDFRemote(context.Background(), signed)
+	if err != nil {
+		t.Fatalf("pdfsigner verify: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if remote.Status != "verified" || !remote.SignaturePresent || !remote.IntegrityValid || remote.SigningTime == nil {
+		t.Fatalf("expected pdfsigner to accept the Go signature, got %+v", remote.VerificationResult)
+	}
+	if stringValue(remote.SignerCN) != "user@example.com" || stringValue(remote.CertificateSHA256) != sha256Hex(block.Bytes) || len(remote.CertificateChain) != 1 {
+		t.Fatalf("expected pdfsigner to report the signing certificate, got %+v", remote.VerificationResult)
+	}
+	if len(remote.Signatures) != 1 || !remote.Signatures[0].CoversWholeDocument {
+		t.Fatalf("expected one signature over the whole file, got %+v", remote.Signatures)
+	}
+
+	local, err := verifyPDFInGo(signed)
+	if err != nil || !verificationsAgree(remote, local) {
+		t.Fatalf("expected both engines to agree, got pdfsigner %+v go %+v %v", remote.VerificationResult, local.VerificationResult, err)
+	}
+}
+
+func testUnsignedPDF() []byte {
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.7\n")
+	var offsets []int
+	for i, obj := range []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+	} {
+		offsets = append(offsets, doc.Len())
+		doc.WriteString(strconv.Itoa(i+1) + " 0 obj\n" + obj + "\nendobj\n")
+	}
+	xref := doc.Len()
+	doc.WriteString("xref\n0 4\n0000000000 65535 f\r\n")
+	for _, off := range offsets {
+		doc.WriteString(fmt.Sprintf("%010d 00000 n\r\n", off))
+	}
+	doc.WriteString("trailer\n<< /Size 4 /Root 1 0 R >>\nstartxref\n" + strconv.Itoa(xref) + "\n%%EOF\n")
+	return doc.Bytes()
+}
+
+func testSigningMaterial(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	certPEM, keyPEM, err := generateSelfSignedCertPEM("user@example.com", priv)
+	if err != nil {
+		t.Fatalf("generate certificate: %v", err)
+	}
+	return certPEM, keyPEM
+}
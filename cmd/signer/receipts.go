@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/receipt"
+)
+
+type ReceiptValidationRequest struct {
+	Receipt string `json:"receipt"`
+}
+
+type ReceiptValidation struct {
+	Valid          bool            `json:"valid"`
+	Issuer         string          `json:"issuer,omitempty"`
+	IssuedAt       string          `json:"issued_at,omitempty"`
+	DocumentSHA256 string          `json:"document_sha256,omitempty"`
+	Verification   json.RawMessage `json:"verification,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+func wantsReceipt(r *http.Request) bool {
+	want, _ := strconv.ParseBool(r.URL.Query().Get("receipt"))
+	return want
+}
+
+// finishVerification records and writes a verification outcome, signing a
+// receipt over it first when the caller asked for one.
+func finishVerification(w http.ResponseWriter, r *http.Request, mode string, statusCode int, verification VerificationResult, pdfBytes []byte) {
+	statusCode, verification = attachReceipt(r, statusCode, verificationForAPI(r, verification), pdfBytes)
+	recordVerifyRequest(mode, verification)
+	writeVerificationJSON(w, statusCode, verification)
+}
+
+func attachReceipt(r *http.Request, statusCode int, verification VerificationResult, pdfBytes []byte) (int, VerificationResult) {
+	if statusCode != http.StatusOK || !wantsReceipt(r) {
+		return statusCode, verification
+	}
+	token, err := issueReceipt(verification, sha256Hex(pdfBytes), time.Now())
+	appmetrics.VerifyReceipts.WithLabelValues("issue", appmetrics.ResultFromErr(err)).Inc()
+	if err != nil {
+		log.Printf("verification receipt signing failed: %v", err)
+		return http.StatusInternalServerError, verificationError("error", "failed to sign verification receipt")
+	}
+	verification.Receipt = &token
+	return statusCode, verification
+}
+
+func issueReceipt(verification VerificationResult, documentHash string, now time.Time) (string, error) {
+	verification.Receipt = nil
+	body, err := json.Marshal(verification)
+	if err != nil {
+		return "", err
+	}
+	return receiptKeys.Sign(receipt.Claims{
+		Issuer:         appCfg.PublicBaseURL,
+		IssuedAt:       now.Unix(),
+		DocumentSHA256: documentHash,
+		Verification:   body,
+	})
+}
+
+func handleValidateReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReceiptValidationRequest
+	if err := decodeJSONBody(w, r, &req); err != nil || strings.TrimSpace(req.Receipt) == "" {
+		appmetrics.VerifyReceipts.WithLabelValues("validate", "bad_request").Inc()
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "receipt is required"})
+		return
+	}
+
+	claims, err := receiptKeys.Verify(req.Receipt)
+	if err != nil {
+		appmetrics.VerifyReceipts.WithLabelValues("validate", "invalid").Inc()
+		writeJSON(w, http.StatusOK, ReceiptValidation{Valid: false, Error: err.Error()})
+		return
+	}
+
+	appmetrics.VerifyReceipts.WithLabelValues("validate", "success").Inc()
+	writeJSON(w, http.StatusOK, ReceiptValidation{
+		Valid:          true,
+		Issuer:         claims.Issuer,
+		IssuedAt:       time.Unix(claims.IssuedAt, 0).UTC().Format(time.RFC3339),
+		DocumentSHA256: claims.DocumentSHA256,
+		Verification:   claims.Verification,
+	})
+}
+
+func handleReceiptKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, receiptKeys.JWKS())
+}
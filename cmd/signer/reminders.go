@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/logutil"
+	"github.com/yarlKot1904/signer/internal/mailer"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const reminderBatch = 50
+
+type reminderClaim struct {
+	session      SigningSession
+	code         string
+	previousHash string
+	newHash      string
+	number       int
+}
+
+func runReminderLoop(appCtx context.Context) {
+	if appCfg.ReminderMax < 1 || len(appCfg.ReminderThresholds) == 0 || appCfg.ReminderInterval <= 0 {
+		log.Println("Signing reminders disabled")
+		return
+	}
+
+	ticker := time.NewTicker(appCfg.ReminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-appCtx.Done():
+			return
+		case <-ticker.C:
+		}
+		sendDueReminders(appCtx)
+	}
+}
+
+func sendDueReminders(appCtx context.Context) {
+	for i := 0; i < reminderBatch && appCtx.Err() == nil; i++ {
+		opCtx, cancel := context.WithTimeout(appCtx, appCfg.DependencyTimeout)
+		sent, err := sendNextReminder(opCtx, time.Now().UTC())
+		cancel()
+		if err != nil {
+			if appCtx.Err() == nil {
+				log.Printf("Signing reminder failed: %v", err)
+			}
+			return
+		}
+		if !sent {
+			return
+		}
+	}
+}
+
+func sendNextReminder(ctx context.Context, now time.Time) (bool, error) {
+	claim, err := claimDueReminder(ctx, now)
+	if err != nil {
+		appmetrics.SigningReminders.WithLabelValues("error").Inc()
+		return false, err
+	}
+	if claim == nil {
+		return false, nil
+	}
+
+	if err := notifyMailerFunc(ctx, buildSigningReminder(claim.session, claim.code, claim.number)); err != nil {
+		appmetrics.SigningReminders.WithLabelValues("error").Inc()
+		releaseReminder(ctx, claim)
+		return false, fmt.Errorf("dispatch reminder %d for token=%s: %w", claim.number, logutil.MaskToken(claim.session.Token), err)
+	}
+
+	appmetrics.SigningReminders.WithLabelValues("success").Inc()
+	log.Printf("Signing reminder %d sent: token=%s recipient=%s", claim.number, logutil.MaskToken(claim.session.Token), logutil.MaskEmail(claim.session.Email))
+	return true, nil
+}
+
+func claimDueReminder(ctx context.Context, now time.Time) (*reminderClaim, error) {
+	var claim *reminderClaim
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session SigningSession
+		dueSQL, dueArgs := reminderDueCondition(now, appCfg.ReminderThresholds, appCfg.ReminderMax)
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("notification_sent_at IS NOT NULL AND signed_at IS NULL AND voided_at IS NULL AND is_used = ? AND attempts < ?", false, MaxAttempts).
+			Where(dueSQL, dueArgs...).
+			Order("notification_sent_at").
+			Limit(1).
+			Find(&session)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		code, err := generateCode()
+		if err != nil {
+			return err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+
+		number := session.RemindersSent + 1
+		err = tx.Model(&SigningSession{}).
+			Where("token = ?", session.Token).
+			Updates(map[string]any{
+				"code_hash":        string(hash),
+				"reminders_sent":   number,
+				"last_reminder_at": now,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		claim = &reminderClaim{
+			session:      session,
+			code:         code,
+			previousHash: session.CodeHash,
+			newHash:      string(hash),
+			number:       number,
+		}
+		return nil
+	})
+	return claim, err
+}
+
+func releaseReminder(ctx context.Context, claim *reminderClaim) {
+	result := db.WithContext(context.WithoutCancel(ctx)).
+		Model(&SigningSession{}).
+		Where("token = ? AND code_hash = ? AND reminders_sent = ?", claim.session.Token, claim.newHash, claim.number).
+		Updates(map[string]any{
+			"code_hash":        claim.previousHash,
+			"reminders_sent":   claim.number - 1,
+			"last_reminder_at": claim.session.LastReminderAt,
+		})
+	if result.Error != nil {
+		log.Printf("Reminder release failed for token=%s: %v", logutil.MaskToken(claim.session.Token), result.Error)
+	}
+}
+
+// reminderDueCondition matches sessions whose next reminder is due. Reminder n
+// is sent once the original notification is older than thresholds[n]; when max
+// exceeds the configured list, each further reminder waits for the last
+// threshold to pass since the previous reminder.
+func reminderDueCondition(now time.Time, thresholds []time.Duration, maxReminders int) (string, []any) {
+	clauses := make([]string, 0, maxReminders)
+	args := make([]any, 0, maxReminders*2)
+	for n := 0; n < maxReminders; n++ {
+		if n < len(thresholds) {
+			clauses = append(clauses, "(reminders_sent = ? AND notification_sent_at <= ?)")
+			args = append(args, n, now.Add(-thresholds[n]))
+			continue
+		}
+		clauses = append(clauses, "(reminders_sent = ? AND last_reminder_at <= ?)")
+		args = append(args, n, now.Add(-thresholds[len(thresholds)-1]))
+	}
+	if len(clauses) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func buildSigningReminder(session SigningSession, code string, number int) mailer.SendRequest {
+	req := buildSigningNotification(TaskMessage{Token: session.Token, Email: session.Email, S3Key: session.S3Key}, code)
+	req.Template = mailer.TemplateSigningReminder
+	req.MessageID = session.Token + ":reminder:" + strconv.Itoa(number)
+	req.Variables["reminder"] = strconv.Itoa(number)
+	return req
+}
+
+func validateReminderThresholds(thresholds []time.Duration) error {
+	for i, threshold := range thresholds {
+		if threshold <= 0 || (i > 0 && threshold < thresholds[i-1]) {
+			return fmt.Errorf("REMINDER_THRESHOLDS must be positive and ascending, got %v", thresholds)
+		}
+	}
+	return nil
+}
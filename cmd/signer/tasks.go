@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/queue"
+)
+
+const dlqDepthInterval = 30 * time.Second
+
+func runDLQDepthLoop(appCtx context.Context, tasks queue.Queue) {
+	ticker := time.NewTicker(dlqDepthInterval)
+	defer ticker.Stop()
+
+	for {
+		opCtx, cancel := context.WithTimeout(appCtx, appCfg.DependencyTimeout)
+		depth, err := tasks.DeadLetterDepth(opCtx)
+		cancel()
+		if err != nil {
+			if appCtx.Err() == nil {
+				log.Printf("DLQ depth check failed: %v", err)
+			}
+		} else {
+			appmetrics.TaskDLQDepth.Set(float64(depth))
+		}
+
+		select {
+		case <-appCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+type VerifyBatchRequest struct {
+	Items []VerifyRequest `json:"items"`
+}
+
+type VerifyBatchItem struct {
+	Index       int                `json:"index"`
+	Token       string             `json:"token,omitempty"`
+	UploadToken string             `json:"upload_token,omitempty"`
+	HTTPStatus  int                `json:"http_status"`
+	Result      VerificationResult `json:"result"`
+}
+
+type VerifyBatchResponse struct {
+	Items []VerifyBatchItem `json:"items"`
+}
+
+// handleVerifyBatch verifies many tokens and upload tokens with at most
+// VERIFY_BATCH_WORKERS items in flight. A client that accepts NDJSON gets one
+// line per item as soon as it finishes; everyone else gets a single JSON
+// document in request order once the whole batch is done.
+func handleVerifyBatch(w http.ResponseWriter, r *http.Request) {
+	format := "json"
+	if acceptsNDJSON(r) {
+		format = "ndjson"
+	}
+	result := "bad_request"
+	defer func() {
+		appmetrics.VerifyBatchRequests.WithLabelValues(format, result).Inc()
+	}()
+
+	if r.Method != http.MethodPost {
+		result = "method_not_allowed"
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := checkVerifyOptions(r); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var req VerifyBatchRequest
+	if err := decodeJSONBody(w, r, &req); err != nil {
+		status, message := http.StatusBadRequest, "bad json"
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			status, message = apiErr.Status, apiErr.Message
+		}
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	if err := validateVerifyBatch(req.Items, appCfg.VerifyBatchMaxItems); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	result = "success"
+	appmetrics.VerifyBatchItems.Observe(float64(len(req.Items)))
+
+	ctx, cancel := context.WithTimeout(r.Context(), appCfg.VerifyBatchTimeout)
+	defer cancel()
+	// The server-wide write timeout is sized for single requests.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(appCfg.VerifyBatchTimeout + appCfg.ShutdownTimeout))
+
+	results := runVerifyBatch(ctx, r, req.Items, appCfg.VerifyBatchWorkers)
+
+	if format == "ndjson" {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		enc := json.NewEncoder(w)
+		for item := range results {
+			if err := enc.Encode(item); err != nil {
+				cancel()
+				continue
+			}
+			_ = rc.Flush()
+		}
+		return
+	}
+
+	resp := VerifyBatchResponse{Items: make([]VerifyBatchItem, len(req.Items))}
+	for item := range results {
+		resp.Items[item.Index] = item
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// validateVerifyBatch trims the tokens in place, so the workers pick the mode
+// from the same values that were validated.
+func validateVerifyBatch(items []VerifyRequest, maxItems int) error {
+	if len(items) == 0 {
+		return errors.New("items is required")
+	}
+	if maxItems > 0 && len(items) > maxItems {
+		return fmt.Errorf("a batch may contain at most %d items", maxItems)
+	}
+	for i := range items {
+		items[i].Token = strings.TrimSpace(items[i].Token)
+		items[i].UploadToken = strings.TrimSpace(items[i].UploadToken)
+		if (items[i].Token == "") == (items[i].UploadToken == "") {
+			return fmt.Errorf("item %d: exactly one of token or upload_token is required", i)
+		}
+	}
+	return nil
+}
+
+// runVerifyBatch fans items out to a fixed number of workers. The returned
+// channel yields every item exactly once, in completion order, and is closed
+// when the batch is done.
+func runVerifyBatch(ctx context.Context, r *http.Request, items []VerifyRequest, workers int) <-chan VerifyBatchItem {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	jobs := make(chan int)
+	results := make(chan VerifyBatchItem, len(items))
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- verifyBatchItemSafely(ctx, r, i, items[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range items {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// verifyBatchItemSafely turns a panic into an error for that item alone. The
+// workers run outside the handler goroutine, where net/http's recovery does
+// not reach, so one bad document would otherwise take the process down.
+func verifyBatchItemSafely(ctx context.Context, r *http.Request, index int, item VerifyRequest) (out VerifyBatchItem) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("verify batch item %d panicked: %v\n%s", index, p, debug.Stack())
+			verification := verificationError("error", "verification failed")
+			recordVerifyRequest("", verification)
+			out = VerifyBatchItem{Index: index, Token: item.Token, UploadToken: item.UploadToken, HTTPStatus: http.StatusInternalServerError, Result: verification}
+		}
+	}()
+	return verifyBatchItem(ctx, r, index, item)
+}
+
+func verifyBatchItem(ctx context.Context, r *http.Request, index int, item VerifyRequest) VerifyBatchItem {
+	out := VerifyBatchItem{Index: index, Token: item.Token, UploadToken: item.UploadToken}
+	mode := "token"
+	if item.Token == "" {
+		mode = "upload"
+	}
+
+	var (
+		statusCode   int
+		verification VerificationResult
+		pdfBytes     []byte
+	)
+	switch {
+	case ctx.Err() != nil:
+		statusCode, verification = http.StatusGatewayTimeout, verificationError("error", "batch deadline exceeded")
+	case mode == "token":
+		statusCode, verification, pdfBytes = verifyByToken(ctx, item.Token)
+	default:
+		statusCode, verification, pdfBytes = verifyByUploadToken(ctx, item.UploadToken, verifyTenant(r))
+	}
+	statusCode, verification = attachReceipt(r, statusCode, verificationForAPI(r, verification), pdfBytes)
+	recordVerifyRequest(mode, verification)
+
+	out.HTTPStatus = statusCode
+	out.Result = verification
+	return out
+}
+
+func acceptsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
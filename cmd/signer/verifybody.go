@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+)
+
+const (
+	verifyFilePart          = "file"
+	verifyMultipartOverhead = 64 << 10
+	pdfHeaderWindow         = 1024
+)
+
+// handleVerifyByBody verifies a PDF sent directly in the request, either as
+// the whole application/pdf body or as the "file" part of a multipart form.
+// The bytes stay in memory and are never written to MinIO.
+func handleVerifyByBody(w http.ResponseWriter, r *http.Request, mediaType string) {
+	pdfBytes, err := readVerifyPDF(w, r, mediaType)
+	if err != nil {
+		status := http.StatusBadRequest
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			status = apiErr.Status
+		}
+		result := verificationError("error", err.Error())
+		recordVerifyRequest("direct", result)
+		writeVerificationJSON(w, status, result)
+		return
+	}
+
+	log.Printf("verify by direct upload: size=%d pdfSha=%s", len(pdfBytes), sha256Hex(pdfBytes))
+	statusCode, verification, err := verifyServiceOwnedPDF(r.Context(), pdfBytes, verifyTenant(r))
+	if err != nil {
+		log.Printf("pdf verification error: %v", err)
+		result := verificationError("error", "verification service failed")
+		recordVerifyRequest("direct", result)
+		writeVerificationJSON(w, http.StatusInternalServerError, result)
+		return
+	}
+
+	finishVerification(w, r, "direct", statusCode, verification, pdfBytes)
+}
+
+func readVerifyPDF(w http.ResponseWriter, r *http.Request, mediaType string) ([]byte, error) {
+	limit := appCfg.UploadMaxBytes
+	if mediaType == "multipart/form-data" {
+		r.Body = http.MaxBytesReader(w, r.Body, limit+verifyMultipartOverhead)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return nil, apiError{Status: http.StatusBadRequest, Message: "bad multipart body"}
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil, apiError{Status: http.StatusBadRequest, Message: "file part is required"}
+			}
+			if err != nil {
+				return nil, bodyReadError(err, "bad multipart body")
+			}
+			if part.FormName() != verifyFilePart {
+				_ = part.Close()
+				continue
+			}
+			data, err := readPDFPart(part, limit)
+			_ = part.Close()
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limit+1)
+	return readPDFPart(r.Body, limit)
+}
+
+func readPDFPart(body io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, bodyReadError(err, "bad file body")
+	}
+	if int64(len(data)) > limit {
+		return nil, apiError{Status: http.StatusRequestEntityTooLarge, Message: "file too large"}
+	}
+	if len(data) == 0 {
+		return nil, apiError{Status: http.StatusBadRequest, Message: "file is empty"}
+	}
+	if !bytes.Contains(data[:min(len(data), pdfHeaderWindow)], []byte("%PDF-")) {
+		return nil, apiError{Status: http.StatusBadRequest, Message: "file is not a PDF"}
+	}
+	return data, nil
+}
+
+func bodyReadError(err error, message string) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return apiError{Status: http.StatusRequestEntityTooLarge, Message: "file too large"}
+	}
+	return apiError{Status: http.StatusBadRequest, Message: message}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+)
+
+// verifyCacheKeyPrefix carries a schema version; bump it when
+// VerificationResult gains fields so older entries are not served.
+const verifyCacheKeyPrefix = "verify:result:v3:"
+
+// withVerifyCache returns the cached result for pdfBytes under scope, or runs
+// verify and caches what it found. Keys carry the revocation counter and the
+// trust store version, so a revocation or a new set of anchors stops reading
+// the older entries and leaves them to expire.
+func withVerifyCache(ctx context.Context, pdfBytes []byte, scope string, verify func() (int, VerificationResult, error)) (int, VerificationResult, error) {
+	if appCfg.VerifyCacheTTL <= 0 || redisDB == nil {
+		return verify()
+	}
+
+	depStart := time.Now()
+	revocations, err := tokenpolicy.RevocationVersion(ctx, redisDB)
+	appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
+	if err != nil {
+		log.Printf("verify cache: revocation version lookup failed: %v", err)
+		appmetrics.VerifyCacheLookups.WithLabelValues("error").Inc()
+		return verify()
+	}
+	key := verifyCacheKey(sha256Hex(pdfBytes), scope, revocations, trustStoreVersion())
+
+	depStart = time.Now()
+	raw, err := redisDB.Get(ctx, key).Bytes()
+	appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
+	switch {
+	case err == nil:
+		var cached VerificationResult
+		if err := json.Unmarshal(raw, &cached); err == nil {
+			appmetrics.VerifyCacheLookups.WithLabelValues("hit").Inc()
+			return http.StatusOK, cached, nil
+		}
+		log.Printf("verify cache: dropping unreadable entry %s", key)
+		appmetrics.VerifyCacheLookups.WithLabelValues("error").Inc()
+	case errors.Is(err, redis.Nil):
+		appmetrics.VerifyCacheLookups.WithLabelValues("miss").Inc()
+	default:
+		log.Printf("verify cache: lookup failed: %v", err)
+		appmetrics.VerifyCacheLookups.WithLabelValues("error").Inc()
+	}
+
+	statusCode, verification, err := verify()
+	if err != nil || !cacheableVerification(statusCode, verification) {
+		return statusCode, verification, err
+	}
+	body, err := json.Marshal(verification)
+	if err != nil {
+		return statusCode, verification, nil
+	}
+	depStart = time.Now()
+	err = redisDB.Set(ctx, key, body, appCfg.VerifyCacheTTL).Err()
+	appmetrics.ObserveDependency("signer", "redis", "redis_set", depStart, err)
+	if err != nil {
+		log.Printf("verify cache: store failed: %v", err)
+	}
+	return statusCode, verification, nil
+}
+
+// cacheableVerification keeps only pdfsigner's answers. Go verifier results
+// are cheap to recompute, and a fallback result must not outlive the outage
+// that produced it.
+func cacheableVerification(statusCode int, verification VerificationResult) bool {
+	return statusCode == http.StatusOK && verification.Status != "error" && verification.Engine == verifyEnginePDFSigner
+}
+
+func verifyCacheKey(documentHash, scope string, revocations int64, trustVersion string) string {
+	return fmt.Sprintf("%s%s:%s:r%d:t%s", verifyCacheKeyPrefix, documentHash, scope, revocations, trustVersion)
+}
+
+func trustStoreVersion() string {
+	if trustStore == nil {
+		return "none"
+	}
+	return trustStore.Version()
+}
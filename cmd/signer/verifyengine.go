@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/pdfsig"
+)
+
+const (
+	verifyEnginePDFSigner  = "pdfsigner"
+	verifyEngineGo         = "go"
+	verifyEngineCrossCheck = "crosscheck"
+)
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// verifyFailure is an answer that ends verification with an error result.
+// Retryable failures mean pdfsigner itself is unhealthy, so the Go verifier
+// may still answer.
+type verifyFailure struct {
+	message   string
+	retryable bool
+}
+
+func (f verifyFailure) Error() string {
+	return f.message
+}
+
+func validateVerifyEngine(engine string) error {
+	switch engine {
+	case verifyEnginePDFSigner, verifyEngineGo, verifyEngineCrossCheck:
+		return nil
+	}
+	return fmt.Errorf("VERIFY_ENGINE must be %s, %s or %s, got %q", verifyEnginePDFSigner, verifyEngineGo, verifyEngineCrossCheck, engine)
+}
+
+// verifyWithEngine returns the pdfsigner-shaped result for pdfBytes and the
+// engine that produced it. In the default mode the Go verifier only answers
+// when pdfsigner cannot; in crosscheck mode it also runs on every success and
+// disagreements are logged.
+func verifyWithEngine(ctx context.Context, pdfBytes []byte) (pdfVerifyResponse, string, error) {
+	if appCfg.VerifyEngine == verifyEngineGo {
+		resp, err := verifyPDFInGo(pdfBytes)
+		return resp, verifyEngineGo, err
+	}
+
+	resp, err := verifyPDFRemote(ctx, pdfBytes)
+	var failure verifyFailure
+	if errors.As(err, &failure) && !failure.retryable {
+		return resp, verifyEnginePDFSigner, err
+	}
+	if err != nil {
+		log.Printf("pdfsigner verification failed, falling back to the Go verifier: %v", err)
+		resp, err = verifyPDFInGo(pdfBytes)
+		appmetrics.VerifyEngineFallbacks.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
+		return resp, verifyEngineGo, err
+	}
+
+	if appCfg.VerifyEngine == verifyEngineCrossCheck {
+		crossCheckVerification(pdfBytes, resp)
+	}
+	return resp, verifyEnginePDFSigner, nil
+}
+
+func verifyPDFRemote(ctx context.Context, pdfBytes []byte) (pdfVerifyResponse, error) {
+	var resp pdfVerifyResponse
+	statusCode, respBody, err := verifyPDFViaService(ctx, derivePDFVerifyURL(appCfg.PDFSignURL), pdfBytes)
+	if err != nil {
+		return resp, err
+	}
+	if statusCode == http.StatusBadRequest {
+		return resp, verifyFailure{message: "stored signed PDF could not be verified"}
+	}
+	if statusCode != http.StatusOK {
+		return resp, verifyFailure{message: "verification service returned an unexpected response", retryable: true}
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// verifyPDFInGo builds the same response pdfsigner would: the top-level fields
+// describe the first signature and every signature is listed.
+func verifyPDFInGo(pdfBytes []byte) (pdfVerifyResponse, error) {
+	sigs, err := pdfsig.Verify(pdfBytes)
+	if err != nil {
+		return pdfVerifyResponse{}, verifyFailure{message: "stored signed PDF could not be verified"}
+	}
+
+	resp := pdfVerifyResponse{
+		VerificationResult: VerificationResult{Status: "unsigned"},
+		Signatures:         make([]pdfSignature, 0, len(sigs)),
+	}
+	for _, sig := range sigs {
+		resp.Signatures = append(resp.Signatures, describeGoSignature(sig))
+	}
+	if len(resp.Signatures) == 0 {
+		return resp, nil
+	}
+
+	first := resp.Signatures[0]
+	resp.VerificationResult = VerificationResult{
+		Status:                first.Status,
+		SignaturePresent:      true,
+		IntegrityValid:        first.IntegrityValid,
+		SignerSubject:         first.SignerSubject,
+		SignerCN:              first.SignerCN,
+		SigningTime:           first.SigningTime,
+		CertificateSelfSigned: first.CertificateSelfSigned,
+		CertificateSHA256:     first.CertificateSHA256,
+		Error:                 first.Error,
+	}
+	resp.CertificateChain = first.CertificateChain
+	return resp, nil
+}
+
+func describeGoSignature(sig pdfsig.Signature) pdfSignature {
+	detail := SignatureDetail{
+		Index:               sig.Index,
+		Status:              "verified",
+		IntegrityValid:      sig.IntegrityValid,
+		ByteRange:           sig.ByteRange,
+		CoversWholeDocument: sig.CoversWholeDocument,
+	}
+	if !sig.IntegrityValid {
+		// Signatures the Go verifier cannot check are not evidence of
+		// tampering, so they are reported as errors rather than invalid.
+		detail.Status = "invalid_signature"
+		if errors.Is(sig.Err, pdfsig.ErrUnsupportedAlgorithm) || errors.Is(sig.Err, pdfsig.ErrUnsupportedContent) {
+			detail.Status = "error"
+		}
+		msg := goVerifyMessage(sig.Err)
+		detail.Error = &msg
+	}
+	if sig.SigningTime != nil {
+		signingTime := sig.SigningTime.UTC().Format(time.RFC3339)
+		detail.SigningTime = &signingTime
+	}
+
+	var chain []string
+	if cert := sig.Signer; cert != nil {
+		subject := cert.Subject.String()
+		selfSigned := isSelfSigned(cert)
+		certHash := sha256Hex(cert.Raw)
+		detail.SignerSubject = &subject
+		detail.SignerCN = signerCN(cert)
+		detail.CertificateSelfSigned = &selfSigned
+		detail.CertificateSHA256 = &certHash
+		for _, c := range sig.Certificates {
+			chain = append(chain, base64.StdEncoding.EncodeToString(c.Raw))
+		}
+	}
+	return pdfSignature{SignatureDetail: detail, CertificateChain: chain}
+}
+
+// goVerifyMessage uses pdfsigner's wording so results read the same whichever
+// engine produced them.
+func goVerifyMessage(err error) string {
+	switch {
+	case errors.Is(err, pdfsig.ErrDigestMismatch), errors.Is(err, pdfsig.ErrBadSignature):
+		return "Signature integrity check failed"
+	case errors.Is(err, pdfsig.ErrMalformedCMS):
+		return "Malformed CMS signature content"
+	case errors.Is(err, pdfsig.ErrNoSignerInfo):
+		return "No signer info present"
+	case errors.Is(err, pdfsig.ErrSignerNotFound):
+		return "Signer certificate not found"
+	case errors.Is(err, pdfsig.ErrUnsupportedAlgorithm):
+		return "Unsupported signature algorithm"
+	case errors.Is(err, pdfsig.ErrUnsupportedContent):
+		return "Unsupported CMS signature content"
+	case err != nil:
+		return err.Error()
+	}
+	return "Signature integrity check failed"
+}
+
+func signerCN(cert *x509.Certificate) *string {
+	cn := cert.Subject.CommonName
+	if !strings.Contains(cn, "@") {
+		if email := emailPattern.FindString(cert.Subject.String()); email != "" {
+			cn = email
+		}
+	}
+	if cn == "" {
+		return nil
+	}
+	return &cn
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func crossCheckVerification(pdfBytes []byte, remote pdfVerifyResponse) {
+	local, err := verifyPDFInGo(pdfBytes)
+	result := "match"
+	switch {
+	case err != nil:
+		result = "error"
+		log.Printf("verify crosscheck: Go verifier failed: %v", err)
+	case !verificationsAgree(remote, local):
+		result = "mismatch"
+		log.Printf("verify crosscheck: engines disagree for pdfSha=%s: pdfsigner=%s go=%s signatures=%d/%d",
+			sha256Hex(pdfBytes), remote.Status, local.Status, len(remote.Signatures), len(local.Signatures))
+	}
+	appmetrics.VerifyCrossChecks.WithLabelValues(result).Inc()
+}
+
+func verificationsAgree(a, b pdfVerifyResponse) bool {
+	if a.Status != b.Status || a.IntegrityValid != b.IntegrityValid || len(a.Signatures) != len(b.Signatures) {
+		return false
+	}
+	for i := range a.Signatures {
+		x, y := a.Signatures[i], b.Signatures[i]
+		if x.Status != y.Status || x.CoversWholeDocument != y.CoversWholeDocument || stringValue(x.CertificateSHA256) != stringValue(y.CertificateSHA256) {
+			return false
+		}
+	}
+	return true
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"gorm.io/gorm"
+)
+
+const verifyHashPathPrefix = "/api/verify/hash/"
+
+// HashRegistration is the public view of a signed_documents row. It leaves out
+// the token and storage keys and masks the signer's email address.
+// LinkRevoked reports the revocation of the document's download token, not of
+// the signing certificate.
+type HashRegistration struct {
+	Registered        bool   `json:"registered"`
+	SHA256            string `json:"sha256"`
+	SignerSubject     string `json:"signer_subject,omitempty"`
+	SignedAt          string `json:"signed_at,omitempty"`
+	CertificateSHA256 string `json:"certificate_sha256,omitempty"`
+	LinkRevoked       bool   `json:"link_revoked,omitempty"`
+}
+
+func handleVerifyByHash(w http.ResponseWriter, r *http.Request) {
+	result := "error"
+	defer func() {
+		appmetrics.VerifyHashLookups.WithLabelValues(result).Inc()
+	}()
+
+	if r.Method != http.MethodGet {
+		result = "method_not_allowed"
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hash, ok := parseDocumentHash(strings.TrimPrefix(r.URL.Path, verifyHashPathPrefix))
+	if !ok {
+		result = "bad_request"
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sha256 must be 64 hex characters"})
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(r.Context(), appCfg.DependencyTimeout)
+	defer cancel()
+
+	retryAfter, err := allowHashLookup(opCtx, trustedProxies.ClientIP(r), time.Now())
+	if err != nil {
+		log.Printf("verify by hash rate limit check failed: %v", err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "rate limit check failed"})
+		return
+	}
+	if retryAfter > 0 {
+		result = "rate_limited"
+		w.Header().Set("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many requests"})
+		return
+	}
+
+	var signedDoc SignedDocument
+	depStart := time.Now()
+	err = db.WithContext(opCtx).First(&signedDoc, "signed_pdfsha = ?", hash).Error
+	appmetrics.ObserveDependency("signer", "postgres", "signed_document_lookup", depStart, err)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		result = "not_found"
+		writeJSON(w, http.StatusNotFound, HashRegistration{SHA256: hash})
+		return
+	}
+	if err != nil {
+		log.Printf("verify by hash lookup failed: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "registry lookup failed"})
+		return
+	}
+
+	var doc Document
+	depStart = time.Now()
+	err = db.WithContext(opCtx).First(&doc, "token = ?", signedDoc.Token).Error
+	appmetrics.ObserveDependency("signer", "postgres", "document_lookup", depStart, err)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("verify by hash document lookup failed for token=%s: %v", logutil.MaskToken(signedDoc.Token), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "registry lookup failed"})
+		return
+	}
+
+	resp := hashRegistration(signedDoc, doc)
+	result = "valid"
+	if resp.LinkRevoked {
+		result = "link_revoked"
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func hashRegistration(signedDoc SignedDocument, doc Document) HashRegistration {
+	return HashRegistration{
+		Registered:        true,
+		SHA256:            signedDoc.SignedPDFSHA,
+		SignerSubject:     maskSubject(signedDoc.SignerSubject),
+		SignedAt:          signedDoc.SignedAt.UTC().Format(time.RFC3339),
+		CertificateSHA256: signedDoc.CertSHA,
+		LinkRevoked:       doc.RevokedAt != nil,
+	}
+}
+
+func parseDocumentHash(raw string) (string, bool) {
+	hash := strings.ToLower(strings.TrimSpace(raw))
+	if len(hash) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// maskSubject hides the address in the CN and emailAddress attributes of a
+// certificate subject, keeping the rest readable.
+func maskSubject(subject string) string {
+	parts := strings.Split(subject, ",")
+	for i, part := range parts {
+		attr, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(strings.TrimSpace(attr)) {
+		case "CN", "E", "EMAILADDRESS", "1.2.840.113549.1.9.1":
+			parts[i] = attr + "=" + logutil.MaskEmail(value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// allowHashLookup counts lookups per client address in a fixed window. It
+// returns how long the client has to wait when the window is used up.
+func allowHashLookup(ctx context.Context, ip string, now time.Time) (time.Duration, error) {
+	limit := appCfg.VerifyHashRateLimit
+	window := appCfg.VerifyHashRateWindow
+	if limit <= 0 || window <= 0 {
+		return 0, nil
+	}
+
+	windowStart := now.Truncate(window)
+	key := "ratelimit:verify_hash:" + ip + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	var count *redis.IntCmd
+	depStart := time.Now()
+	_, err := redisDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, window)
+		return nil
+	})
+	appmetrics.ObserveDependency("signer", "redis", "rate_limit_incr", depStart, err)
+	if err != nil {
+		return 0, err
+	}
+	if count.Val() > int64(limit) {
+		retryAfter := windowStart.Add(window).Sub(now)
+		if retryAfter < time.Second {
+			retryAfter = time.Second
+		}
+		return retryAfter, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// verifyV2Path serves the same inputs as /api/verify and adds a signatures
+// array with one entry per signature dictionary in the PDF.
+const verifyV2Path = "/api/v2/verify"
+
+func wantsSignatureDetails(r *http.Request) bool {
+	return r.URL.Path == verifyV2Path
+}
+
+// verificationForAPI drops the per-signature details from v1 responses, which
+// keep their single-signature shape.
+func verificationForAPI(r *http.Request, verification VerificationResult) VerificationResult {
+	if !wantsSignatureDetails(r) {
+		verification.Signatures = nil
+	}
+	return verification
+}
+
+// evaluateSignatureChains checks each signer certificate chain against the
+// trust store. Without a trust store the chain fields stay empty.
+func evaluateSignatureChains(signatures []pdfSignature, tenant string, now time.Time) []SignatureDetail {
+	out := make([]SignatureDetail, 0, len(signatures))
+	for _, signature := range signatures {
+		detail := signature.SignatureDetail
+		if trustStore != nil && len(signature.CertificateChain) > 0 {
+			chain := trustStore.Evaluate(signature.CertificateChain, tenant, now)
+			trusted := chain.Trusted
+			detail.Chain = &chain
+			detail.CertificateTrusted = &trusted
+		}
+		out = append(out, detail)
+	}
+	return out
+}
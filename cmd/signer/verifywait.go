@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+)
+
+const (
+	// verifyReadyChannel carries the upload token after the uploader has
+	// stored verify:<token>.
+	verifyReadyChannel = "verify:ready"
+	// verifyRecheckInterval bounds the wait when a notification is lost, for
+	// example while the subscription reconnects.
+	verifyRecheckInterval = 2 * time.Second
+)
+
+// verifyUploadWaiter holds one Redis subscription for the whole process and
+// wakes the requests waiting on the upload token named in each message.
+type verifyUploadWaiter struct {
+	rdb     *redis.Client
+	lookup  func(ctx context.Context, uploadToken string) (string, error)
+	recheck time.Duration
+
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+var verifyUploads *verifyUploadWaiter
+
+func newVerifyUploadWaiter(rdb *redis.Client) *verifyUploadWaiter {
+	w := &verifyUploadWaiter{
+		rdb:     rdb,
+		recheck: verifyRecheckInterval,
+		waiters: map[string]map[chan struct{}]struct{}{},
+	}
+	w.lookup = w.get
+	return w
+}
+
+func (w *verifyUploadWaiter) Run(ctx context.Context) {
+	pubsub := w.rdb.Subscribe(ctx, verifyReadyChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			w.notify(msg.Payload)
+		}
+	}
+}
+
+// Wait returns the verify:<token> metadata once the uploader has stored it. It
+// registers for the notification before the first read, so a message published
+// between the two cannot be missed.
+func (w *verifyUploadWaiter) Wait(ctx context.Context, uploadToken string) (string, error) {
+	ready := w.register(uploadToken)
+	defer w.unregister(uploadToken, ready)
+
+	ticker := time.NewTicker(w.recheck)
+	defer ticker.Stop()
+
+	wakeup := "initial"
+	var lastErr error
+	for {
+		val, err := w.lookup(ctx, uploadToken)
+		if err == nil {
+			appmetrics.VerifyUploadWakeups.WithLabelValues(wakeup).Inc()
+			return val, nil
+		}
+		lastErr = err
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("verify upload redis lookup failed for %s: %v", logutil.MaskToken(uploadToken), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if lastErr == nil || errors.Is(lastErr, redis.Nil) {
+				lastErr = ctx.Err()
+			}
+			return "", lastErr
+		case <-ready:
+			wakeup = "notification"
+		case <-ticker.C:
+			wakeup = "recheck"
+		}
+	}
+}
+
+func (w *verifyUploadWaiter) get(ctx context.Context, uploadToken string) (string, error) {
+	depStart := time.Now()
+	val, err := w.rdb.Get(ctx, "verify:"+uploadToken).Result()
+	appmetrics.ObserveDependency("signer", "redis", "redis_get", depStart, err)
+	return val, err
+}
+
+func (w *verifyUploadWaiter) register(uploadToken string) chan struct{} {
+	ready := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiters[uploadToken] == nil {
+		w.waiters[uploadToken] = map[chan struct{}]struct{}{}
+	}
+	w.waiters[uploadToken][ready] = struct{}{}
+	return ready
+}
+
+func (w *verifyUploadWaiter) unregister(uploadToken string, ready chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.waiters[uploadToken], ready)
+	if len(w.waiters[uploadToken]) == 0 {
+		delete(w.waiters, uploadToken)
+	}
+}
+
+func (w *verifyUploadWaiter) notify(uploadToken string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ready := range w.waiters[uploadToken] {
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+	}
+}
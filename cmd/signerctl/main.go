@@ -0,0 +1,732 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/infra"
+	"github.com/yarlKot1904/signer/internal/linksign"
+	"github.com/yarlKot1904/signer/internal/queue"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	verifyCleanupZSetKey = "verify:cleanup"
+	defaultListLimit     = 20
+	defaultReplayLimit   = 10
+	defaultAccessLimit   = 50
+	maxOTPAttempts       = 3
+)
+
+const usage = `Usage: signerctl <command> [arguments]
+
+Commands:
+  session inspect <token>          show a signing session and its signed documents
+  session reset-attempts <token>   clear failed OTP attempts
+  session resend-otp <token>       issue a new OTP and send the signing email again
+  session void <token>             block signing and revoke the download token
+  token revoke <token>             revoke the download and view links of a token
+  document accesses [-limit N] [-before ID] <token>
+                                   show the download access history of a token
+  link issue [-signed] [-inline] [-ttl D] <token>
+                                   print a signed download link valid for D
+  dlq list [-limit N]              show dead-lettered signing tasks
+  dlq replay [-limit N]            move dead-lettered tasks back onto signer.tasks
+  signed lookup <sha256>           find a signed document by signed PDF hash
+  verify cleanup                   delete expired verify uploads now
+
+Connections are configured with the same environment variables as the services.
+`
+
+type Document struct {
+	Token     string `gorm:"primaryKey"`
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+type SigningSession struct {
+	Token              string `gorm:"primaryKey"`
+	Email              string
+	S3Key              string
+	IsUsed             bool
+	CreatedAt          time.Time
+	Attempts           int
+	SignedS3Key        string
+	SignedAt           *time.Time
+	NotificationSentAt *time.Time
+	VoidedAt           *time.Time
+	RemindersSent      int
+	LastReminderAt     *time.Time
+}
+
+type SignedDocument struct {
+	ID            uint `gorm:"primaryKey"`
+	Token         string
+	SignedS3Key   string
+	SignedPDFSHA  string `gorm:"column:signed_pdfsha"`
+	CertSHA       string
+	SignerSubject string
+	SignedAt      time.Time
+	CreatedAt     time.Time
+}
+
+type DownloadAccess struct {
+	ID          uint `gorm:"primaryKey"`
+	Token       string
+	Route       string
+	Artifact    string
+	Disposition string
+	ClientIP    string `gorm:"column:client_ip"`
+	UserAgent   string
+	Status      int
+	BytesSent   int64
+	Result      string
+	CreatedAt   time.Time
+}
+
+type TaskMessage struct {
+	Token string `json:"token"`
+	Email string `json:"email"`
+	S3Key string `json:"s3_key"`
+}
+
+type app struct {
+	cfg *config.Config
+	out io.Writer
+
+	db    *gorm.DB
+	rdb   *redis.Client
+	tasks queue.Queue
+	s3    *s3.Client
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Config error:", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DependencyTimeout)
+	defer cancel()
+
+	a := &app{cfg: cfg, out: os.Stdout}
+	err = a.run(ctx, os.Args[1:])
+	a.close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "signerctl:", err)
+		os.Exit(1)
+	}
+}
+
+func (a *app) run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		fmt.Fprint(a.out, usage)
+		return errors.New("missing command")
+	}
+
+	group, cmd, rest := args[0], args[1], args[2:]
+	switch group + " " + cmd {
+	case "session inspect":
+		return a.sessionInspect(ctx, rest)
+	case "session reset-attempts":
+		return a.sessionResetAttempts(ctx, rest)
+	case "session resend-otp":
+		return a.sessionResendOTP(ctx, rest)
+	case "session void":
+		return a.sessionVoid(ctx, rest)
+	case "token revoke":
+		return a.tokenRevoke(ctx, rest)
+	case "document accesses":
+		return a.documentAccesses(ctx, rest)
+	case "link issue":
+		return a.linkIssue(rest)
+	case "dlq list":
+		return a.dlqList(ctx, rest)
+	case "dlq replay":
+		return a.dlqReplay(ctx, rest)
+	case "signed lookup":
+		return a.signedLookup(ctx, rest)
+	case "verify cleanup":
+		return a.verifyCleanup(ctx, rest)
+	default:
+		fmt.Fprint(a.out, usage)
+		return fmt.Errorf("unknown command %q", group+" "+cmd)
+	}
+}
+
+func (a *app) sessionInspect(ctx context.Context, args []string) error {
+	token, err := singleArg(args, "token")
+	if err != nil {
+		return err
+	}
+	session, err := a.loadSession(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	rdb, err := a.redis()
+	if err != nil {
+		return err
+	}
+	docTTL, err := rdb.TTL(ctx, tokenpolicy.MetaKey(token)).Result()
+	if err != nil {
+		return fmt.Errorf("redis ttl: %w", err)
+	}
+	downloads, err := tokenpolicy.Downloads(ctx, rdb, token)
+	if err != nil {
+		return fmt.Errorf("redis downloads: %w", err)
+	}
+	revoked, err := tokenpolicy.IsRevoked(ctx, rdb, token)
+	if err != nil {
+		return fmt.Errorf("redis revoked: %w", err)
+	}
+
+	var docs []Document
+	if err := a.db.WithContext(ctx).Where("token = ?", token).Limit(1).Find(&docs).Error; err != nil {
+		return fmt.Errorf("document record: %w", err)
+	}
+	var doc Document
+	if len(docs) > 0 {
+		doc = docs[0]
+	}
+
+	var signed []SignedDocument
+	if err := a.db.WithContext(ctx).Where("token = ?", token).Order("signed_at").Find(&signed).Error; err != nil {
+		return fmt.Errorf("signed documents: %w", err)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "token\t%s\n", session.Token)
+	fmt.Fprintf(w, "email\t%s\n", session.Email)
+	fmt.Fprintf(w, "s3_key\t%s\n", session.S3Key)
+	fmt.Fprintf(w, "status\t%s\n", sessionStatus(session))
+	fmt.Fprintf(w, "attempts\t%d\n", session.Attempts)
+	fmt.Fprintf(w, "created_at\t%s\n", formatTime(&session.CreatedAt))
+	fmt.Fprintf(w, "notification_sent_at\t%s\n", formatTime(session.NotificationSentAt))
+	fmt.Fprintf(w, "reminders_sent\t%d\n", session.RemindersSent)
+	fmt.Fprintf(w, "last_reminder_at\t%s\n", formatTime(session.LastReminderAt))
+	fmt.Fprintf(w, "signed_at\t%s\n", formatTime(session.SignedAt))
+	fmt.Fprintf(w, "signed_s3_key\t%s\n", orDash(session.SignedS3Key))
+	fmt.Fprintf(w, "voided_at\t%s\n", formatTime(session.VoidedAt))
+	fmt.Fprintf(w, "document_record\t%t\n", len(docs) > 0)
+	fmt.Fprintf(w, "link_expires_at\t%s\n", formatTime(doc.ExpiresAt))
+	fmt.Fprintf(w, "document_revoked_at\t%s\n", formatTime(doc.RevokedAt))
+	fmt.Fprintf(w, "redis_token_ttl\t%s\n", formatTTL(docTTL))
+	fmt.Fprintf(w, "token_downloads\t%d\n", downloads)
+	fmt.Fprintf(w, "token_revoked\t%t\n", revoked)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, doc := range signed {
+		fmt.Fprintf(a.out, "\nsigned document %d\n", doc.ID)
+		w = tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "  signed_pdf_sha256\t%s\n", doc.SignedPDFSHA)
+		fmt.Fprintf(w, "  signed_s3_key\t%s\n", doc.SignedS3Key)
+		fmt.Fprintf(w, "  signer_subject\t%s\n", doc.SignerSubject)
+		fmt.Fprintf(w, "  signed_at\t%s\n", formatTime(&doc.SignedAt))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *app) sessionResetAttempts(ctx context.Context, args []string) error {
+	token, err := singleArg(args, "token")
+	if err != nil {
+		return err
+	}
+	session, err := a.loadSession(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err := a.db.WithContext(ctx).Model(&SigningSession{}).Where("token = ?", token).Update("attempts", 0).Error; err != nil {
+		return fmt.Errorf("reset attempts: %w", err)
+	}
+	fmt.Fprintf(a.out, "Attempts reset for %s (was %d)\n", token, session.Attempts)
+	return nil
+}
+
+func (a *app) sessionResendOTP(ctx context.Context, args []string) error {
+	token, err := singleArg(args, "token")
+	if err != nil {
+		return err
+	}
+	session, err := a.loadSession(ctx, token)
+	if err != nil {
+		return err
+	}
+	if status := sessionStatus(session); status == "voided" || status == "signed" {
+		return fmt.Errorf("session is %s; OTP not resent", status)
+	}
+
+	body, err := json.Marshal(TaskMessage{Token: session.Token, Email: session.Email, S3Key: session.S3Key})
+	if err != nil {
+		return err
+	}
+	tasks, err := a.queue(ctx)
+	if err != nil {
+		return err
+	}
+
+	res := a.db.WithContext(ctx).Model(&SigningSession{}).
+		Where("token = ? AND is_used = ? AND voided_at IS NULL", token, false).
+		Updates(map[string]any{"notification_sent_at": nil, "reminders_sent": 0})
+	if res.Error != nil {
+		return fmt.Errorf("clear notification state: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("session changed concurrently; OTP not resent")
+	}
+	if err := tasks.Publish(ctx, body); err != nil {
+		return fmt.Errorf("publish task: %w", err)
+	}
+	fmt.Fprintf(a.out, "OTP resend queued for %s on %s\n", token, tasks.Name())
+	return nil
+}
+
+func (a *app) sessionVoid(ctx context.Context, args []string) error {
+	token, err := singleArg(args, "token")
+	if err != nil {
+		return err
+	}
+	session, err := a.loadSession(ctx, token)
+	if err != nil {
+		return err
+	}
+	if session.IsUsed {
+		return errors.New("session is already signed")
+	}
+
+	now := time.Now().UTC()
+	if session.VoidedAt == nil {
+		if err := a.db.WithContext(ctx).Model(&SigningSession{}).
+			Where("token = ? AND voided_at IS NULL", token).
+			Update("voided_at", &now).Error; err != nil {
+			return fmt.Errorf("void session: %w", err)
+		}
+	}
+	if err := a.revokeDocument(ctx, token, now); err != nil {
+		return err
+	}
+
+	rdb, err := a.redis()
+	if err != nil {
+		return err
+	}
+	if err := rdb.Del(ctx, tokenpolicy.MetaKey(token)).Err(); err != nil {
+		return fmt.Errorf("remove download token: %w", err)
+	}
+	fmt.Fprintf(a.out, "Session %s voided\n", token)
+	return nil
+}
+
+func (a *app) tokenRevoke(ctx context.Context, args []string) error {
+	token, err := singleArg(args, "token")
+	if err != nil {
+		return err
+	}
+	if err := a.revokeDocument(ctx, token, time.Now().UTC()); err != nil {
+		return err
+	}
+	rdb, err := a.redis()
+	if err != nil {
+		return err
+	}
+	if err := tokenpolicy.Revoke(ctx, rdb, token, a.cfg.TokenMaxTTL); err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	fmt.Fprintf(a.out, "Token %s revoked\n", token)
+	return nil
+}
+
+// revokeDocument marks the durable document record so the downloader does not
+// restore the token into Redis after the cache entry is removed.
+func (a *app) revokeDocument(ctx context.Context, token string, now time.Time) error {
+	err := a.db.WithContext(ctx).Model(&Document{}).
+		Where("token = ? AND revoked_at IS NULL", token).
+		Update("revoked_at", &now).Error
+	if err != nil {
+		return fmt.Errorf("revoke document record: %w", err)
+	}
+	return nil
+}
+
+// documentAccesses reads download_accesses for any token, including documents
+// uploaded through tus, which have no API key that could read them.
+func (a *app) documentAccesses(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("document accesses", flag.ContinueOnError)
+	fs.SetOutput(a.out)
+	limit := fs.Int("limit", defaultAccessLimit, "maximum entries to show")
+	before := fs.Uint("before", 0, "show only entries with a lower id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	token, err := singleArg(fs.Args(), "token")
+	if err != nil {
+		return err
+	}
+	if *limit < 1 {
+		return errors.New("limit must be positive")
+	}
+
+	db, err := a.postgres()
+	if err != nil {
+		return err
+	}
+	query := db.WithContext(ctx).Where("token = ?", token)
+	if *before > 0 {
+		query = query.Where("id < ?", *before)
+	}
+	var accesses []DownloadAccess
+	if err := query.Order("id DESC").Limit(*limit).Find(&accesses).Error; err != nil {
+		return fmt.Errorf("access history: %w", err)
+	}
+	return printAccesses(a.out, token, accesses, *limit)
+}
+
+func printAccesses(out io.Writer, token string, accesses []DownloadAccess, limit int) error {
+	if len(accesses) == 0 {
+		fmt.Fprintf(out, "No recorded accesses for %s\n", token)
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tAT\tROUTE\tARTIFACT\tDISPOSITION\tSTATUS\tBYTES\tRESULT\tCLIENT_IP\tUSER_AGENT")
+	for _, e := range accesses {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", e.ID, formatTime(&e.CreatedAt), e.Route, e.Artifact, e.Disposition,
+			e.Status, e.BytesSent, e.Result, orDash(e.ClientIP), truncate(orDash(e.UserAgent), 60))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(accesses) == limit {
+		fmt.Fprintf(out, "More entries: -before %d\n", accesses[len(accesses)-1].ID)
+	}
+	return nil
+}
+
+func (a *app) linkIssue(args []string) error {
+	fs := flag.NewFlagSet("link issue", flag.ContinueOnError)
+	fs.SetOutput(a.out)
+	signed := fs.Bool("signed", false, "link to the signed PDF instead of the original")
+	inline := fs.Bool("inline", false, "open the PDF in the browser instead of downloading it")
+	ttl := fs.Duration("ttl", a.cfg.SignedLinkTTL, "link lifetime")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	token, err := singleArg(fs.Args(), "token")
+	if err != nil {
+		return err
+	}
+	if *ttl <= 0 {
+		return errors.New("-ttl must be positive")
+	}
+	keys, err := linksign.ParseKeys(a.cfg.LinkSigningKeys)
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return errors.New("LINK_SIGNING_KEYS is not set")
+	}
+
+	link := linksign.Link{
+		Token:       token,
+		Artifact:    linksign.Original,
+		Disposition: linksign.Attachment,
+		ExpiresAt:   time.Now().UTC().Add(*ttl),
+	}
+	if *signed {
+		link.Artifact = linksign.Signed
+	}
+	if *inline {
+		link.Disposition = linksign.Inline
+	}
+	baseURL := strings.TrimRight(strings.TrimSpace(a.cfg.PublicBaseURL), "/")
+	fmt.Fprintf(a.out, "%s%s\n", baseURL, keys.Path(link))
+	fmt.Fprintf(a.out, "expires_at\t%s\n", link.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+func (a *app) dlqList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dlq list", flag.ContinueOnError)
+	fs.SetOutput(a.out)
+	limit := fs.Int("limit", defaultListLimit, "maximum messages to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tasks, err := a.queue(ctx)
+	if err != nil {
+		return err
+	}
+	letters, err := tasks.DeadLetters(ctx, *limit)
+	if err != nil {
+		return fmt.Errorf("list dead letters: %w", err)
+	}
+	if len(letters) == 0 {
+		fmt.Fprintf(a.out, "%s is empty\n", queue.DeadLetterName(tasks.Name()))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tATTEMPTS\tDEAD_LETTERED_AT\tTOKEN\tBODY")
+	for _, letter := range letters {
+		var task TaskMessage
+		_ = json.Unmarshal(letter.Body, &task)
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", letter.ID, letter.Attempts, orDash(letter.DeadLetteredAt), orDash(task.Token), truncate(string(letter.Body), 120))
+	}
+	return w.Flush()
+}
+
+func (a *app) dlqReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dlq replay", flag.ContinueOnError)
+	fs.SetOutput(a.out)
+	limit := fs.Int("limit", defaultReplayLimit, "maximum messages to replay")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *limit < 1 {
+		return errors.New("limit must be positive")
+	}
+
+	tasks, err := a.queue(ctx)
+	if err != nil {
+		return err
+	}
+	replayed, err := tasks.ReplayDeadLetters(ctx, *limit)
+	fmt.Fprintf(a.out, "Replayed %d message(s) onto %s\n", replayed, tasks.Name())
+	if err != nil {
+		return fmt.Errorf("replay dead letters: %w", err)
+	}
+	return nil
+}
+
+func (a *app) signedLookup(ctx context.Context, args []string) error {
+	hash, err := singleArg(args, "sha256")
+	if err != nil {
+		return err
+	}
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if len(hash) != 64 {
+		return errors.New("sha256 must be 64 hex characters")
+	}
+
+	db, err := a.postgres()
+	if err != nil {
+		return err
+	}
+	var doc SignedDocument
+	res := db.WithContext(ctx).First(&doc, "signed_pdfsha = ?", hash)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("no signed document with sha256 %s", hash)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("lookup: %w", res.Error)
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "id\t%d\n", doc.ID)
+	fmt.Fprintf(w, "token\t%s\n", doc.Token)
+	fmt.Fprintf(w, "signed_s3_key\t%s\n", doc.SignedS3Key)
+	fmt.Fprintf(w, "cert_sha256\t%s\n", doc.CertSHA)
+	fmt.Fprintf(w, "signer_subject\t%s\n", doc.SignerSubject)
+	fmt.Fprintf(w, "signed_at\t%s\n", formatTime(&doc.SignedAt))
+	return w.Flush()
+}
+
+func (a *app) verifyCleanup(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("verify cleanup takes no arguments")
+	}
+	rdb, err := a.redis()
+	if err != nil {
+		return err
+	}
+	s3Client, err := a.s3Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys, err := rdb.ZRangeByScore(ctx, verifyCleanupZSetKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("scan verify cleanup set: %w", err)
+	}
+
+	deleted, failed := 0, 0
+	for _, key := range keys {
+		if err := infra.DeleteObject(ctx, s3Client, a.cfg.MinioBucket, key); err != nil {
+			fmt.Fprintf(a.out, "failed %s: %v\n", key, err)
+			failed++
+			continue
+		}
+		_ = infra.DeleteObject(ctx, s3Client, a.cfg.MinioBucket, key+".info")
+		if err := rdb.ZRem(ctx, verifyCleanupZSetKey, key).Err(); err != nil {
+			fmt.Fprintf(a.out, "deleted %s but could not untrack it: %v\n", key, err)
+		}
+		deleted++
+	}
+	fmt.Fprintf(a.out, "Deleted %d expired verify object(s), %d failed\n", deleted, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d verify object(s) could not be deleted", failed)
+	}
+	return nil
+}
+
+func (a *app) loadSession(ctx context.Context, token string) (*SigningSession, error) {
+	db, err := a.postgres()
+	if err != nil {
+		return nil, err
+	}
+	var session SigningSession
+	res := db.WithContext(ctx).First(&session, "token = ?", token)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("no signing session for token %s", token)
+	}
+	if res.Error != nil {
+		return nil, fmt.Errorf("load session: %w", res.Error)
+	}
+	return &session, nil
+}
+
+func (a *app) postgres() (*gorm.DB, error) {
+	if a.db != nil {
+		return a.db, nil
+	}
+	if a.cfg.DBDSN == "" {
+		return nil, errors.New("DB_DSN is required")
+	}
+	db, err := gorm.Open(postgres.Open(a.cfg.DBDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("connect postgres: %w", err)
+	}
+	a.db = db
+	return db, nil
+}
+
+func (a *app) redis() (*redis.Client, error) {
+	if a.rdb != nil {
+		return a.rdb, nil
+	}
+	if a.cfg.RedisAddr == "" {
+		return nil, errors.New("REDIS_ADDR is required")
+	}
+	rdb, err := infra.NewRedisClient(a.cfg.RedisAddr)
+	if err != nil {
+		return nil, fmt.Errorf("connect redis: %w", err)
+	}
+	a.rdb = rdb
+	return rdb, nil
+}
+
+func (a *app) queue(ctx context.Context) (queue.Queue, error) {
+	if a.tasks != nil {
+		return a.tasks, nil
+	}
+	var rdb *redis.Client
+	if strings.EqualFold(strings.TrimSpace(a.cfg.TaskQueueBackend), queue.BackendRedis) {
+		var err error
+		if rdb, err = a.redis(); err != nil {
+			return nil, err
+		}
+	}
+	tasks, err := queue.New(ctx, "signerctl", a.cfg, rdb)
+	if err != nil {
+		return nil, fmt.Errorf("connect task queue: %w", err)
+	}
+	a.tasks = tasks
+	return tasks, nil
+}
+
+func (a *app) s3Client(ctx context.Context) (*s3.Client, error) {
+	if a.s3 != nil {
+		return a.s3, nil
+	}
+	client, err := infra.NewS3Client(ctx, a.cfg.MinioEndpoint, a.cfg.MinioID, a.cfg.MinioSecret, a.cfg.MinioRegion)
+	if err != nil {
+		return nil, fmt.Errorf("connect s3: %w", err)
+	}
+	a.s3 = client
+	return client, nil
+}
+
+func (a *app) close() {
+	if a.tasks != nil {
+		_ = a.tasks.Close()
+	}
+	if a.rdb != nil {
+		_ = a.rdb.Close()
+	}
+	if a.db != nil {
+		if sqlDB, err := a.db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}
+}
+
+func singleArg(args []string, name string) (string, error) {
+	if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+		return "", fmt.Errorf("expected exactly one <%s> argument", name)
+	}
+	return strings.TrimSpace(args[0]), nil
+}
+
+func sessionStatus(s *SigningSession) string {
+	switch {
+	case s.VoidedAt != nil:
+		return "voided"
+	case s.IsUsed:
+		return "signed"
+	case s.Attempts >= maxOTPAttempts:
+		return "blocked"
+	default:
+		return "pending"
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatTTL(ttl time.Duration) string {
+	if ttl < 0 {
+		return "missing"
+	}
+	return ttl.Round(time.Second).String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
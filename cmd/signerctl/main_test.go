@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/linksign"
+)
+
+func TestSessionStatus(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		session SigningSession
+		want    string
+	}{
+		{session: SigningSession{}, want: "pending"},
+		{session: SigningSession{Attempts: maxOTPAttempts}, want: "blocked"},
+		{session: SigningSession{IsUsed: true}, want: "signed"},
+		{session: SigningSession{IsUsed: true, VoidedAt: &now}, want: "voided"},
+	}
+	for _, tc := range cases {
+		if got := sessionStatus(&tc.session); got != tc.want {
+			t.Fatalf("expected %s, got %s for %+v", tc.want, got, tc.session)
+		}
+	}
+}
+
+func TestRunRejectsUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	a := &app{cfg: &config.Config{}, out: &out}
+
+	err := a.run(context.Background(), []string{"session", "explode", "tok"})
+	if err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected unknown command error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Usage: signerctl") {
+		t.Fatalf("expected usage output, got %q", out.String())
+	}
+}
+
+func TestSignedLookupValidatesHash(t *testing.T) {
+	a := &app{cfg: &config.Config{}, out: &bytes.Buffer{}}
+
+	err := a.run(context.Background(), []string{"signed", "lookup", "abc"})
+	if err == nil || !strings.Contains(err.Error(), "64 hex") {
+		t.Fatalf("expected hash validation error, got %v", err)
+	}
+}
+
+func TestPrintAccesses(t *testing.T) {
+	var out bytes.Buffer
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	accesses := []DownloadAccess{
+		{ID: 9, Route: "/download/{token}", Artifact: "signed", Disposition: "attachment", Status: 200, BytesSent: 1024, Result: "success", ClientIP: "203.0.113.7", CreatedAt: at},
+		{ID: 4, Route: "/link/{token}", Artifact: "original", Disposition: "inline", Status: 410, Result: "expired", CreatedAt: at},
+	}
+	if err := printAccesses(&out, "abc-token", accesses, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "ID") {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 10 || fields[0] != "9" || fields[1] != "2026-05-01T12:00:00Z" || fields[8] != "203.0.113.7" {
+		t.Fatalf("unexpected row: %q", lines[1])
+	}
+	if lines[3] != "More entries: -before 4" {
+		t.Fatalf("expected a next page hint, got %q", lines[3])
+	}
+
+	out.Reset()
+	if err := printAccesses(&out, "abc-token", nil, 50); err != nil || !strings.Contains(out.String(), "No recorded accesses") {
+		t.Fatalf("unexpected empty output: %q %v", out.String(), err)
+	}
+}
+
+func TestDocumentAccessesValidatesArguments(t *testing.T) {
+	a := &app{cfg: &config.Config{}, out: &bytes.Buffer{}}
+
+	if err := a.run(context.Background(), []string{"document", "accesses"}); err == nil || !strings.Contains(err.Error(), "<token>") {
+		t.Fatalf("expected a missing token error, got %v", err)
+	}
+	if err := a.run(context.Background(), []string{"document", "accesses", "-limit", "0", "abc-token"}); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("expected a limit error, got %v", err)
+	}
+	if err := a.run(context.Background(), []string{"document", "accesses", "abc-token"}); err == nil || !strings.Contains(err.Error(), "DB_DSN") {
+		t.Fatalf("expected DB_DSN to be required, got %v", err)
+	}
+}
+
+func TestLinkIssue(t *testing.T) {
+	var out bytes.Buffer
+	keys := []string{"k1:0000000000000000000000000000000000000000000000000000000000000001"}
+	a := &app{cfg: &config.Config{PublicBaseURL: "http://localhost/", LinkSigningKeys: keys}, out: &out}
+
+	if err := a.run(context.Background(), []string{"link", "issue", "-signed", "-ttl", "2h", "abc-token"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(strings.SplitN(out.String(), "\n", 2)[0])
+	if err != nil || u.Host != "localhost" || u.Path != "/link/abc-token" {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+	ks, _ := linksign.ParseKeys(keys)
+	link, err := ks.Verify("abc-token", u.Query(), time.Now())
+	if err != nil || link.Artifact != linksign.Signed || link.Disposition != linksign.Attachment {
+		t.Fatalf("unexpected link %+v: %v", link, err)
+	}
+
+	a.cfg.LinkSigningKeys = nil
+	if err := a.run(context.Background(), []string{"link", "issue", "abc-token"}); err == nil {
+		t.Fatal("expected missing keys to be reported")
+	}
+}
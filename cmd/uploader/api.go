@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/queue"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+)
+
+const (
+	apiDocumentFilePart     = "file"
+	apiDocumentMetadataPart = "metadata"
+	apiIdempotencyTTL       = 24 * time.Hour
+	apiIdempotencyPending   = "pending"
+	apiIdempotencyClaimTTL  = 5 * time.Minute
+)
+
+type APIKey struct {
+	ID         uint      `gorm:"primaryKey"`
+	Name       string    `gorm:"not null"`
+	KeyHash    string    `gorm:"uniqueIndex;not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+type DocumentRequest struct {
+	Recipient string          `json:"recipient"`
+	Filename  string          `json:"filename"`
+	Options   DocumentOptions `json:"options"`
+}
+
+type DocumentOptions struct {
+	IdempotencyKey string `json:"idempotency_key"`
+	MaxDownloads   int    `json:"max_downloads"`
+	ViewOnly       bool   `json:"view_only"`
+	ExpiresIn      string `json:"expires_in"`
+}
+
+type DocumentResponse struct {
+	Token       string     `json:"token"`
+	SessionID   string     `json:"session_id"`
+	SignURL     string     `json:"sign_url"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ViewURL     string     `json:"view_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e apiError) Error() string {
+	return e.Message
+}
+
+func handleCreateDocument(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg *config.Config,
+	s3Client *s3.Client,
+	rdb *redis.Client,
+	tasks queue.Queue,
+) {
+	result := "error"
+	defer func() {
+		appmetrics.APIDocumentRequests.WithLabelValues(result).Inc()
+	}()
+
+	if r.Method != http.MethodPost {
+		result = "bad_request"
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if db == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "API access is not configured"})
+		return
+	}
+	key, err := authenticateAPIKey(r)
+	if err != nil {
+		result = "unauthorized"
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key lookup failed"})
+		return
+	}
+
+	req, pdfBytes, partFilename, err := readDocumentRequest(w, r, cfg)
+	if err != nil {
+		result = "bad_request"
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			if apiErr.Status == http.StatusRequestEntityTooLarge {
+				result = "too_large"
+			}
+			writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad request"})
+		return
+	}
+
+	recipient, err := mail.ParseAddress(strings.TrimSpace(req.Recipient))
+	if err != nil {
+		result = "bad_request"
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "recipient must be a valid email address"})
+		return
+	}
+	filename := strings.TrimSpace(req.Filename)
+	if filename == "" {
+		filename = partFilename
+	}
+	policy, err := documentPolicy(req.Options, cfg)
+	if err != nil {
+		result = "bad_request"
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(r.Context(), cfg.DependencyTimeout)
+	defer cancel()
+
+	idempotencyKey := ""
+	if req.Options.IdempotencyKey != "" {
+		idempotencyKey = apiIdempotencyRedisKey(key.ID, req.Options.IdempotencyKey)
+		previous, claimed, err := claimIdempotencyKey(opCtx, rdb, idempotencyKey)
+		switch {
+		case err != nil:
+			log.Printf("API idempotency lookup failed for key=%d: %v", key.ID, err)
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "idempotency lookup failed"})
+			return
+		case previous != nil:
+			result = "duplicate"
+			writeJSON(w, http.StatusOK, previous)
+			return
+		case !claimed:
+			result = "duplicate"
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "a request with this idempotency_key is still in progress"})
+			return
+		}
+		// Any failure below releases the key so the client can retry.
+		defer func() {
+			if result != "success" {
+				releaseIdempotencyKey(rdb, idempotencyKey)
+			}
+		}()
+	}
+
+	stagingKey := uuid.New().String()
+	depStart := time.Now()
+	_, err = s3Client.PutObject(opCtx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.MinioBucket),
+		Key:         aws.String(stagingKey),
+		Body:        bytes.NewReader(pdfBytes),
+		ContentType: aws.String("application/pdf"),
+	})
+	appmetrics.ObserveDependency("uploader", "minio", "s3_put", depStart, err)
+	if err != nil {
+		log.Printf("API document store failed for key=%d: %v", key.ID, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to store document"})
+		return
+	}
+	appmetrics.UploadBytes.Observe(float64(len(pdfBytes)))
+
+	token, err := finalizeSigningUpload(opCtx, s3Client, cfg.MinioBucket, rdb, tasks, signingUpload{
+		StorageKey: stagingKey,
+		Email:      recipient.Address,
+		Filename:   filename,
+		APIKeyID:   key.ID,
+		Policy:     policy,
+	})
+	if errors.Is(err, errNotPDF) {
+		result = "invalid"
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file is not a PDF"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to submit document"})
+		return
+	}
+
+	escapedToken := url.PathEscape(token)
+	resp := DocumentResponse{
+		Token:     token,
+		SessionID: token,
+		SignURL:   joinPublicURL(cfg.PublicBaseURL, "/sign.html?token="+url.QueryEscape(token)),
+		ViewURL:   joinPublicURL(cfg.PublicBaseURL, "/view/"+escapedToken),
+		ExpiresAt: policy.ExpiresAt,
+	}
+	if !policy.ViewOnly {
+		resp.DownloadURL = joinPublicURL(cfg.PublicBaseURL, "/download/"+escapedToken)
+	}
+
+	if idempotencyKey != "" {
+		if data, err := json.Marshal(resp); err == nil {
+			depStart = time.Now()
+			err = rdb.Set(opCtx, idempotencyKey, data, apiIdempotencyTTL).Err()
+			appmetrics.ObserveDependency("uploader", "redis", "redis_set", depStart, err)
+			if err != nil {
+				log.Printf("API idempotency store failed for token=%s: %v", logutil.MaskToken(token), err)
+			}
+		}
+	}
+
+	result = "success"
+	log.Printf("API document submitted: apiKey=%s token=%s recipient=%s", key.Name, logutil.MaskToken(token), logutil.MaskEmail(recipient.Address))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// claimIdempotencyKey reserves key with a pending marker before the document
+// is created, so concurrent requests with the same key cannot both create
+// one. A finished request's response is returned instead of a claim; a
+// request still in progress yields neither.
+func claimIdempotencyKey(ctx context.Context, rdb *redis.Client, key string) (*DocumentResponse, bool, error) {
+	depStart := time.Now()
+	claimed, err := rdb.SetNX(ctx, key, apiIdempotencyPending, apiIdempotencyClaimTTL).Result()
+	appmetrics.ObserveDependency("uploader", "redis", "redis_setnx", depStart, err)
+	if err != nil || claimed {
+		return nil, claimed, err
+	}
+
+	depStart = time.Now()
+	cached, err := rdb.Get(ctx, key).Result()
+	appmetrics.ObserveDependency("uploader", "redis", "redis_get", depStart, err)
+	if errors.Is(err, redis.Nil) || cached == apiIdempotencyPending {
+		// Still running, or it failed and released the key a moment ago; in
+		// both cases the client should retry.
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var previous DocumentResponse
+	if err := json.Unmarshal([]byte(cached), &previous); err != nil {
+		return nil, false, err
+	}
+	return &previous, false, nil
+}
+
+func releaseIdempotencyKey(rdb *redis.Client, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	depStart := time.Now()
+	err := rdb.Del(ctx, key).Err()
+	appmetrics.ObserveDependency("uploader", "redis", "redis_del", depStart, err)
+	if err != nil {
+		log.Printf("API idempotency release failed: %v", err)
+	}
+}
+
+func handleRevokeDocument(w http.ResponseWriter, r *http.Request, cfg *config.Config, rdb *redis.Client) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/documents/"), "/revoke")
+	if !ok || token == "" || strings.Contains(token, "/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if db == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "API access is not configured"})
+		return
+	}
+
+	key, err := authenticateAPIKey(r)
+	if err != nil {
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key lookup failed"})
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(r.Context(), cfg.DependencyTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	depStart := time.Now()
+	res := db.WithContext(opCtx).Model(&Document{}).
+		Where("token = ? AND api_key_id = ?", token, key.ID).
+		Update("revoked_at", gorm.Expr("COALESCE(revoked_at, ?)", now))
+	appmetrics.ObserveDependency("uploader", "postgres", "document_revoke", depStart, res.Error)
+	if res.Error != nil {
+		log.Printf("Revoke update failed for token=%s: %v", logutil.MaskToken(token), res.Error)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "document lookup failed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "document not found"})
+		return
+	}
+
+	depStart = time.Now()
+	err = tokenpolicy.Revoke(opCtx, rdb, token, cfg.TokenMaxTTL)
+	appmetrics.ObserveDependency("uploader", "redis", "token_revoke", depStart, err)
+	if err != nil {
+		log.Printf("Revoke failed for token=%s: %v", logutil.MaskToken(token), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "revoke failed"})
+		return
+	}
+
+	log.Printf("API document link revoked: apiKey=%s token=%s", key.Name, logutil.MaskToken(token))
+	writeJSON(w, http.StatusOK, map[string]string{"token": token, "status": "revoked"})
+}
+
+func documentPolicy(opts DocumentOptions, cfg *config.Config) (tokenpolicy.Policy, error) {
+	expiresIn, err := tokenpolicy.ParseExpiresIn(opts.ExpiresIn)
+	if err != nil {
+		return tokenpolicy.Policy{}, err
+	}
+	return tokenpolicy.New(opts.MaxDownloads, opts.ViewOnly, expiresIn, time.Now(), cfg.TokenMaxTTL)
+}
+
+func readDocumentRequest(w http.ResponseWriter, r *http.Request, cfg *config.Config) (DocumentRequest, []byte, string, error) {
+	var req DocumentRequest
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "unsupported content type"}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.UploadMaxBytes+cfg.JSONMaxBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "bad multipart body"}
+	}
+
+	var pdfBytes []byte
+	var partFilename string
+	seenMetadata := false
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return req, nil, "", apiError{Status: http.StatusRequestEntityTooLarge, Message: "request too large"}
+			}
+			return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "bad multipart body"}
+		}
+
+		switch part.FormName() {
+		case apiDocumentMetadataPart:
+			dec := json.NewDecoder(io.LimitReader(part, cfg.JSONMaxBytes))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil {
+				return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "bad metadata json"}
+			}
+			seenMetadata = true
+		case apiDocumentFilePart:
+			data, err := io.ReadAll(io.LimitReader(part, cfg.UploadMaxBytes+1))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					return req, nil, "", apiError{Status: http.StatusRequestEntityTooLarge, Message: "file too large"}
+				}
+				return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "bad file part"}
+			}
+			if int64(len(data)) > cfg.UploadMaxBytes {
+				return req, nil, "", apiError{Status: http.StatusRequestEntityTooLarge, Message: "file too large"}
+			}
+			pdfBytes = data
+			partFilename = part.FileName()
+		}
+		_ = part.Close()
+	}
+
+	if !seenMetadata {
+		return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "metadata part is required"}
+	}
+	if len(pdfBytes) == 0 {
+		return req, nil, "", apiError{Status: http.StatusBadRequest, Message: "file part is required"}
+	}
+	return req, pdfBytes, partFilename, nil
+}
+
+func authenticateAPIKey(r *http.Request) (*APIKey, error) {
+	rawKey := strings.TrimSpace(r.Header.Get("X-API-Key"))
+	if rawKey == "" {
+		authz := strings.TrimSpace(r.Header.Get("Authorization"))
+		if len(authz) > len("Bearer ") && strings.EqualFold(authz[:len("Bearer ")], "Bearer ") {
+			rawKey = strings.TrimSpace(authz[len("Bearer "):])
+		}
+	}
+	if rawKey == "" {
+		return nil, apiError{Status: http.StatusUnauthorized, Message: "API key required"}
+	}
+
+	var key APIKey
+	depStart := time.Now()
+	res := db.WithContext(r.Context()).First(&key, "key_hash = ? AND revoked_at IS NULL", hashAPIKey(rawKey))
+	appmetrics.ObserveDependency("uploader", "postgres", "api_key_lookup", depStart, res.Error)
+	if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+		return nil, apiError{Status: http.StatusUnauthorized, Message: "invalid API key"}
+	}
+	if res.Error != nil {
+		log.Printf("API key lookup failed: %v", res.Error)
+		return nil, res.Error
+	}
+
+	now := time.Now().UTC()
+	if err := db.WithContext(r.Context()).Model(&APIKey{}).Where("id = ?", key.ID).Update("last_used_at", &now).Error; err != nil {
+		log.Printf("API key last_used_at update failed for key=%d: %v", key.ID, err)
+	}
+	return &key, nil
+}
+
+func hashAPIKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiIdempotencyRedisKey(apiKeyID uint, idempotencyKey string) string {
+	sum := sha256.Sum256([]byte(idempotencyKey))
+	return "api:idempotency:" + strconv.FormatUint(uint64(apiKeyID), 10) + ":" + hex.EncodeToString(sum[:])
+}
+
+func joinPublicURL(baseURL, path string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if baseURL == "" {
+		baseURL = "http://signer.local"
+	}
+	if strings.HasPrefix(path, "/") {
+		return baseURL + path
+	}
+	return baseURL + "/" + path
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(payload)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/config"
+)
+
+func TestReadDocumentRequest(t *testing.T) {
+	cfg := &config.Config{UploadMaxBytes: 1024, JSONMaxBytes: 1024}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("metadata", `{"recipient":"user@example.com","options":{"idempotency_key":"abc"}}`); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+	part, err := w.CreateFormFile("file", "contract.pdf")
+	if err != nil {
+		t.Fatalf("create file part: %v", err)
+	}
+	_, _ = part.Write([]byte("%PDF-1.7 test"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("close multipart: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/documents", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	docReq, pdfBytes, filename, err := readDocumentRequest(httptest.NewRecorder(), req, cfg)
+	if err != nil {
+		t.Fatalf("read document request: %v", err)
+	}
+	if docReq.Recipient != "user@example.com" {
+		t.Fatalf("unexpected recipient: %s", docReq.Recipient)
+	}
+	if docReq.Options.IdempotencyKey != "abc" {
+		t.Fatalf("unexpected idempotency key: %s", docReq.Options.IdempotencyKey)
+	}
+	if filename != "contract.pdf" {
+		t.Fatalf("unexpected filename: %s", filename)
+	}
+	if string(pdfBytes) != "%PDF-1.7 test" {
+		t.Fatalf("unexpected file bytes: %q", pdfBytes)
+	}
+}
+
+func TestReadDocumentRequestRejectsOversizedFile(t *testing.T) {
+	cfg := &config.Config{UploadMaxBytes: 8, JSONMaxBytes: 1024}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("metadata", `{"recipient":"user@example.com"}`)
+	part, _ := w.CreateFormFile("file", "contract.pdf")
+	_, _ = part.Write([]byte("%PDF-1.7 too large"))
+	_ = w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/documents", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	_, _, _, err := readDocumentRequest(httptest.NewRecorder(), req, cfg)
+	var apiErr apiError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 error, got %v", err)
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	got := hashAPIKey("secret")
+	want := "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+	if got != want {
+		t.Fatalf("unexpected hash: %s", got)
+	}
+}
+
+func TestDocumentPolicy(t *testing.T) {
+	cfg := &config.Config{TokenMaxTTL: 72 * time.Hour}
+
+	policy, err := documentPolicy(DocumentOptions{MaxDownloads: 2, ViewOnly: true, ExpiresIn: "48h"}, cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy.MaxDownloads != 2 || !policy.ViewOnly || policy.ExpiresAt == nil {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	if time.Until(*policy.ExpiresAt) < 47*time.Hour {
+		t.Fatalf("unexpected expiry: %s", policy.ExpiresAt)
+	}
+
+	if _, err := documentPolicy(DocumentOptions{ExpiresIn: "96h"}, cfg); err == nil {
+		t.Fatal("expected expiry above TOKEN_MAX_TTL to be rejected")
+	}
+}
+
+func TestHandleRevokeDocumentRejectsBadPath(t *testing.T) {
+	cfg := &config.Config{DependencyTimeout: time.Second}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/documents/abc/download", nil)
+	rec := httptest.NewRecorder()
+	handleRevokeDocument(rec, req, cfg, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestAccessPage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/documents/token/accesses?limit=20&before=99", nil)
+	limit, before, err := accessPage(req)
+	if err != nil || limit != 20 || before != 99 {
+		t.Fatalf("unexpected page: %d %d %v", limit, before, err)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/documents/token/accesses", nil)
+	if limit, before, err := accessPage(req); err != nil || limit != defaultAccessLimit || before != 0 {
+		t.Fatalf("unexpected defaults: %d %d %v", limit, before, err)
+	}
+
+	for _, query := range []string{"limit=0", "limit=501", "limit=many", "before=-1"} {
+		req = httptest.NewRequest(http.MethodGet, "/api/documents/token/accesses?"+query, nil)
+		if _, _, err := accessPage(req); err == nil {
+			t.Fatalf("expected %s to be rejected", query)
+		}
+	}
+}
+
+func TestHandleDocumentAccessesRejectsBadRequests(t *testing.T) {
+	cfg := &config.Config{}
+
+	rec := httptest.NewRecorder()
+	handleDocumentAccesses(rec, httptest.NewRequest(http.MethodPost, "/api/documents/token/accesses", nil), cfg)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status for POST: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleDocumentAccesses(rec, httptest.NewRequest(http.MethodGet, "/api/documents/a/b/accesses", nil), cfg)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unexpected status for nested path: %d", rec.Code)
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	addr := os.Getenv("UPLOADER_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("UPLOADER_TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+	ctx := context.Background()
+	key := apiIdempotencyRedisKey(1, "test-"+time.Now().Format(time.RFC3339Nano))
+	defer rdb.Del(ctx, key)
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			previous, claimed, err := claimIdempotencyKey(ctx, rdb, key)
+			if err != nil || previous != nil {
+				t.Errorf("unexpected claim result %+v %v", previous, err)
+			}
+			if claimed {
+				claims.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if claims.Load() != 1 {
+		t.Fatalf("expected exactly one concurrent claim, got %d", claims.Load())
+	}
+
+	if err := rdb.Set(ctx, key, `{"token":"abc"}`, time.Minute).Err(); err != nil {
+		t.Fatalf("store response: %v", err)
+	}
+	previous, claimed, err := claimIdempotencyKey(ctx, rdb, key)
+	if err != nil || claimed || previous == nil || previous.Token != "abc" {
+		t.Fatalf("expected the stored response, got %+v %t %v", previous, claimed, err)
+	}
+
+	releaseIdempotencyKey(rdb, key)
+	if _, claimed, err := claimIdempotencyKey(ctx, rdb, key); err != nil || !claimed {
+		t.Fatalf("expected a released key to be claimable, got %t %v", claimed, err)
+	}
+}
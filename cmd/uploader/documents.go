@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	documentBackfillBatch = 500
+	defaultAccessLimit    = 100
+	maxAccessLimit        = 500
+)
+
+type Document struct {
+	Token        string `gorm:"primaryKey"`
+	OriginalName string `gorm:"not null"`
+	S3Key        string `gorm:"not null"`
+	MimeType     string `gorm:"not null"`
+	OwnerEmail   string
+	APIKeyID     uint `gorm:"index"`
+	MaxDownloads int  `gorm:"default:0"`
+	ViewOnly     bool `gorm:"default:false"`
+	ExpiresAt    *time.Time
+	RevokedAt    *time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	// DownloadsUsed and MeteredBytes are written by the downloader from the
+	// Redis counters of limited tokens.
+	DownloadsUsed int   `gorm:"not null;default:0"`
+	MeteredBytes  int64 `gorm:"not null;default:0"`
+}
+
+// DownloadAccess mirrors the access log table written by the downloader.
+type DownloadAccess struct {
+	ID          uint      `json:"id"`
+	Token       string    `json:"-"`
+	Route       string    `json:"route"`
+	Artifact    string    `json:"artifact"`
+	Disposition string    `json:"disposition"`
+	ClientIP    string    `gorm:"column:client_ip" json:"client_ip"`
+	UserAgent   string    `json:"user_agent"`
+	Status      int       `json:"status"`
+	BytesSent   int64     `json:"bytes_sent"`
+	Result      string    `json:"result"`
+	CreatedAt   time.Time `json:"at"`
+}
+
+type AccessHistoryResponse struct {
+	Token      string           `json:"token"`
+	Accesses   []DownloadAccess `json:"accesses"`
+	NextBefore uint             `json:"next_before,omitempty"`
+}
+
+func newDocument(token string, meta FileMeta) Document {
+	return Document{
+		Token:        token,
+		OriginalName: meta.OriginalName,
+		S3Key:        meta.S3Key,
+		MimeType:     meta.MimeType,
+		OwnerEmail:   meta.OwnerEmail,
+		APIKeyID:     meta.APIKeyID,
+		MaxDownloads: meta.MaxDownloads,
+		ViewOnly:     meta.ViewOnly,
+		ExpiresAt:    meta.ExpiresAt,
+	}
+}
+
+// backfillDocuments creates document records for uploads recorded in the
+// outbox before the documents table existed. The outbox keeps rows for a week,
+// which covers every token that can still be live in Redis.
+func backfillDocuments(ctx context.Context) {
+	var entries []OutboxEntry
+	err := db.WithContext(ctx).
+		Where("NOT EXISTS (SELECT 1 FROM documents WHERE documents.token = outbox_entries.token)").
+		Order("id").
+		Limit(documentBackfillBatch).
+		Find(&entries).Error
+	if err != nil {
+		log.Printf("Document backfill lookup failed: %v", err)
+		return
+	}
+
+	created := 0
+	for _, entry := range entries {
+		var meta FileMeta
+		if err := json.Unmarshal([]byte(entry.DocMeta), &meta); err != nil {
+			log.Printf("Document backfill skipped token=%s: %v", logutil.MaskToken(entry.Token), err)
+			continue
+		}
+		doc := newDocument(entry.Token, meta)
+		doc.CreatedAt = entry.CreatedAt
+		if doc.ExpiresAt == nil {
+			expiresAt := entry.CreatedAt.Add(tokenpolicy.DefaultTTL)
+			doc.ExpiresAt = &expiresAt
+		}
+		if err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&doc).Error; err != nil {
+			log.Printf("Document backfill failed token=%s: %v", logutil.MaskToken(entry.Token), err)
+			continue
+		}
+		created++
+	}
+	if created > 0 {
+		log.Printf("Document backfill created %d records from the outbox", created)
+	}
+}
+
+func handleDocumentAccesses(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/documents/"), "/accesses")
+	if !ok || token == "" || strings.Contains(token, "/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if db == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "API access is not configured"})
+		return
+	}
+	limit, before, err := accessPage(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	key, err := authenticateAPIKey(r)
+	if err != nil {
+		var apiErr apiError
+		if errors.As(err, &apiErr) {
+			writeJSON(w, apiErr.Status, map[string]string{"error": apiErr.Message})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "API key lookup failed"})
+		return
+	}
+
+	opCtx, cancel := context.WithTimeout(r.Context(), cfg.DependencyTimeout)
+	defer cancel()
+
+	var doc Document
+	depStart := time.Now()
+	err = db.WithContext(opCtx).First(&doc, "token = ? AND api_key_id = ?", token, key.ID).Error
+	appmetrics.ObserveDependency("uploader", "postgres", "document_lookup", depStart, err)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "document not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Access history lookup failed for token=%s: %v", logutil.MaskToken(token), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "document lookup failed"})
+		return
+	}
+
+	query := db.WithContext(opCtx).Where("token = ?", token)
+	if before > 0 {
+		query = query.Where("id < ?", before)
+	}
+	accesses := []DownloadAccess{}
+	depStart = time.Now()
+	err = query.Order("id DESC").Limit(limit).Find(&accesses).Error
+	appmetrics.ObserveDependency("uploader", "postgres", "access_log_lookup", depStart, err)
+	if err != nil {
+		log.Printf("Access history query failed for token=%s: %v", logutil.MaskToken(token), err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "access history lookup failed"})
+		return
+	}
+
+	resp := AccessHistoryResponse{Token: token, Accesses: accesses}
+	if len(accesses) == limit {
+		resp.NextBefore = accesses[len(accesses)-1].ID
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func accessPage(r *http.Request) (int, uint, error) {
+	limit := defaultAccessLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAccessLimit {
+			return 0, 0, errors.New("limit must be between 1 and " + strconv.Itoa(maxAccessLimit))
+		}
+		limit = n
+	}
+	var before uint
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("before must be an access id")
+		}
+		before = uint(n)
+	}
+	return limit, before, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -24,8 +26,10 @@ import (
 	"github.com/yarlKot1904/signer/internal/infra"
 	"github.com/yarlKot1904/signer/internal/logutil"
 	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
-
-	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/yarlKot1904/signer/internal/queue"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 type FileMeta struct {
@@ -33,6 +37,8 @@ type FileMeta struct {
 	S3Key        string `json:"s3_key"`
 	MimeType     string `json:"mime_type"`
 	OwnerEmail   string `json:"owner_email"`
+	APIKeyID     uint   `json:"api_key_id,omitempty"`
+	tokenpolicy.Policy
 }
 
 type TaskMessage struct {
@@ -41,13 +47,27 @@ type TaskMessage struct {
 	S3Key string `json:"s3_key"`
 }
 
+type signingUpload struct {
+	StorageKey string
+	Email      string
+	Filename   string
+	HasInfo    bool
+	APIKeyID   uint
+	Policy     tokenpolicy.Policy
+}
+
 const (
 	verifyUploadTTL       = time.Hour
 	verifyCleanupZSetKey  = "verify:cleanup"
+	verifyReadyChannel    = "verify:ready"
 	verifyCleanupInterval = time.Minute
 	verifyObjectPrefix    = "verify/"
 )
 
+var errNotPDF = errors.New("uploaded file is not a PDF")
+
+var db *gorm.DB
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
@@ -73,39 +93,41 @@ func main() {
 		}
 	}()
 
+	if cfg.DBDSN == "" {
+		log.Fatal("Config error: DB_DSN is required for the upload outbox")
+	}
+	db, err = gorm.Open(postgres.Open(cfg.DBDSN), &gorm.Config{})
+	if err != nil {
+		log.Fatal("DB connect failed:", err)
+	}
+	if err := db.AutoMigrate(&APIKey{}, &OutboxEntry{}, &Document{}); err != nil {
+		log.Fatal("Migration failed:", err)
+	}
+	backfillCtx, cancelBackfill := context.WithTimeout(appCtx, cfg.DependencyTimeout)
+	backfillDocuments(backfillCtx)
+	cancelBackfill()
+
 	store := s3store.New(cfg.MinioBucket, s3Client)
 	composer := handler.NewStoreComposer()
 	store.UseIn(composer)
 
-	rabbitConn, err := amqp.Dial(cfg.RabbitURL)
+	tasks, err := queue.New(appCtx, "uploader", cfg, redisClient)
 	if err != nil {
-		log.Fatal("RabbitMQ connect failed:", err)
-	}
-	defer rabbitConn.Close()
-
-	rabbitCh, err := rabbitConn.Channel()
-	if err != nil {
-		log.Fatal("RabbitMQ channel failed:", err)
-	}
-	defer rabbitCh.Close()
-
-	q, err := rabbitCh.QueueDeclare(
-		"signer.tasks",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Task queue connect failed:", err)
 	}
+	defer tasks.Close()
 
 	tusHandler, err := handler.NewHandler(handler.Config{
 		BasePath:              "/files/",
 		StoreComposer:         composer,
 		NotifyCompleteUploads: true,
 		MaxSize:               cfg.UploadMaxBytes,
+		PreUploadCreateCallback: func(hook handler.HookEvent) (handler.HTTPResponse, handler.FileInfoChanges, error) {
+			if _, err := tokenpolicy.FromMetadata(hook.Upload.MetaData, time.Now(), cfg.TokenMaxTTL); err != nil {
+				return handler.HTTPResponse{}, handler.FileInfoChanges{}, handler.NewError("ERR_INVALID_POLICY", err.Error(), http.StatusBadRequest)
+			}
+			return handler.HTTPResponse{}, handler.FileInfoChanges{}, nil
+		},
 	})
 	if err != nil {
 		log.Fatal("Tusd handler error:", err)
@@ -121,13 +143,30 @@ func main() {
 		log.Fatal("Verify tusd handler error:", err)
 	}
 
-	go handleUploadLoop(appCtx, cfg, tusHandler.CompleteUploads, s3Client, redisClient, rabbitCh, q.Name)
+	go handleUploadLoop(appCtx, cfg, tusHandler.CompleteUploads, s3Client, redisClient, tasks)
+	go runOutboxRelay(appCtx, cfg, redisClient, tasks)
 	go handleVerifyUploadLoop(appCtx, cfg, verifyTusHandler.CompleteUploads, s3Client, redisClient)
 	go runVerifyCleanupLoop(appCtx, cfg, s3Client, redisClient)
 
 	mux := http.NewServeMux()
 	mux.Handle("/files/", appmetrics.InstrumentHandler("uploader", "/files/", http.StripPrefix("/files/", tusHandler)))
 	mux.Handle("/verify-files/", appmetrics.InstrumentHandler("uploader", "/verify-files/", http.StripPrefix("/verify-files/", verifyTusHandler)))
+	mux.HandleFunc("/api/documents", appmetrics.InstrumentHandlerFunc("uploader", "/api/documents", func(w http.ResponseWriter, r *http.Request) {
+		handleCreateDocument(w, r, cfg, s3Client, redisClient, tasks)
+	}))
+	revokeHandler := appmetrics.InstrumentHandlerFunc("uploader", "/api/documents/{token}/revoke", func(w http.ResponseWriter, r *http.Request) {
+		handleRevokeDocument(w, r, cfg, redisClient)
+	})
+	accessesHandler := appmetrics.InstrumentHandlerFunc("uploader", "/api/documents/{token}/accesses", func(w http.ResponseWriter, r *http.Request) {
+		handleDocumentAccesses(w, r, cfg)
+	})
+	mux.HandleFunc("/api/documents/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/accesses") {
+			accessesHandler(w, r)
+			return
+		}
+		revokeHandler(w, r)
+	})
 	mux.HandleFunc("/health", appmetrics.InstrumentHandlerFunc("uploader", "/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		_, _ = w.Write([]byte(`{"status":"ok"}`))
@@ -164,8 +203,7 @@ func handleUploadLoop(
 	events <-chan handler.HookEvent,
 	s3Client *s3.Client,
 	rdb *redis.Client,
-	rabbitCh *amqp.Channel,
-	queueName string,
+	tasks queue.Queue,
 ) {
 	for {
 		select {
@@ -175,7 +213,7 @@ func handleUploadLoop(
 			if !ok {
 				return
 			}
-			handleUploadComplete(appCtx, cfg, event, s3Client, cfg.MinioBucket, rdb, rabbitCh, queueName)
+			handleUploadComplete(appCtx, cfg, event, s3Client, cfg.MinioBucket, rdb, tasks)
 		}
 	}
 }
@@ -207,8 +245,7 @@ func handleUploadComplete(
 	s3Client *s3.Client,
 	bucket string,
 	rdb *redis.Client,
-	rabbitCh *amqp.Channel,
-	queueName string,
+	tasks queue.Queue,
 ) {
 	start := time.Now()
 	result := "error"
@@ -230,35 +267,71 @@ func handleUploadComplete(
 	opCtx, cancel := context.WithTimeout(appCtx, cfg.DependencyTimeout)
 	defer cancel()
 
+	policy, err := tokenpolicy.FromMetadata(event.Upload.MetaData, time.Now(), cfg.TokenMaxTTL)
+	if err != nil {
+		result = "invalid"
+		log.Printf("Rejected upload with invalid policy: uploadID=%s: %v", event.Upload.ID, err)
+		if err := deleteUploadArtifacts(opCtx, s3Client, bucket, storageKey); err != nil {
+			log.Printf("Failed to delete rejected upload %s: %v", storageKey, err)
+		}
+		return
+	}
+
+	_, err = finalizeSigningUpload(opCtx, s3Client, bucket, rdb, tasks, signingUpload{
+		StorageKey: storageKey,
+		Email:      event.Upload.MetaData["userEmail"],
+		Filename:   event.Upload.MetaData["filename"],
+		HasInfo:    true,
+		Policy:     policy,
+	})
+	if errors.Is(err, errNotPDF) {
+		result = "invalid"
+		return
+	}
+	if err != nil {
+		return
+	}
+	result = "success"
+}
+
+func finalizeSigningUpload(
+	ctx context.Context,
+	s3Client *s3.Client,
+	bucket string,
+	rdb *redis.Client,
+	tasks queue.Queue,
+	upload signingUpload,
+) (string, error) {
+	storageKey := upload.StorageKey
+
 	depStart := time.Now()
-	isPDF, err := isPDFObject(opCtx, s3Client, bucket, storageKey)
+	isPDF, err := isPDFObject(ctx, s3Client, bucket, storageKey)
 	appmetrics.ObserveDependency("uploader", "minio", "s3_get", depStart, err)
 	if err != nil {
 		log.Printf("Upload PDF validation failed for %s: %v", storageKey, err)
-		return
+		return "", err
 	}
 	if !isPDF {
-		result = "invalid"
 		log.Printf("Rejected non-PDF upload: key=%s", storageKey)
-		if err := deleteUploadArtifacts(opCtx, s3Client, bucket, storageKey); err != nil {
+		if err := deleteUploadArtifacts(ctx, s3Client, bucket, storageKey); err != nil {
 			log.Printf("Failed to delete rejected upload %s: %v", storageKey, err)
 		}
-		return
+		return "", errNotPDF
 	}
 
-	email := event.Upload.MetaData["userEmail"]
-	filename := event.Upload.MetaData["filename"]
+	email := upload.Email
+	filename := upload.Filename
 	if filename == "" {
 		filename = "document.pdf"
 	}
 
 	depStart = time.Now()
-	finalKey, err := moveUploadedObject(opCtx, s3Client, bucket, storageKey, "")
+	finalKey, err := moveUploadedObject(ctx, s3Client, bucket, storageKey, "", upload.HasInfo)
 	appmetrics.UploadS3Move.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
 	appmetrics.ObserveDependency("uploader", "minio", "s3_move", depStart, err)
 	if err != nil {
 		log.Printf("Error moving signing upload in S3: %v", err)
-		return
+		return "", err
 	}
 
 	downloadToken := uuid.New().String()
@@ -267,26 +340,16 @@ func handleUploadComplete(
 		S3Key:        finalKey,
 		MimeType:     "application/pdf",
 		OwnerEmail:   email,
+		APIKeyID:     upload.APIKeyID,
+		Policy:       upload.Policy,
 	}
 
 	data, err := json.Marshal(meta)
 	if err != nil {
 		log.Printf("Error marshaling upload metadata for %s: %v", finalKey, err)
-		_ = deleteUploadArtifacts(opCtx, s3Client, bucket, finalKey)
-		return
-	}
-
-	tokenTTL := 24 * time.Hour
-	depStart = time.Now()
-	err = rdb.Set(opCtx, "doc:"+downloadToken, data, tokenTTL).Err()
-	appmetrics.ObserveDependency("uploader", "redis", "redis_set", depStart, err)
-	appmetrics.TokenWrite.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
-	if err != nil {
-		log.Printf("Error saving to Redis: %v", err)
-		_ = deleteUploadArtifacts(opCtx, s3Client, bucket, finalKey)
-		return
+		_ = deleteUploadArtifacts(ctx, s3Client, bucket, finalKey)
+		return "", err
 	}
-	appmetrics.TokenTTLSeconds.Observe(tokenTTL.Seconds())
 
 	task := TaskMessage{
 		Token: downloadToken,
@@ -296,33 +359,35 @@ func handleUploadComplete(
 	taskJSON, err := json.Marshal(task)
 	if err != nil {
 		log.Printf("Failed to marshal task for %s: %v", logutil.MaskToken(downloadToken), err)
-		_ = rdb.Del(opCtx, "doc:"+downloadToken).Err()
-		_ = deleteUploadArtifacts(opCtx, s3Client, bucket, finalKey)
-		return
+		_ = deleteUploadArtifacts(ctx, s3Client, bucket, finalKey)
+		return "", err
 	}
 
+	entry := OutboxEntry{
+		Token:         downloadToken,
+		Queue:         tasks.Name(),
+		DocMeta:       string(data),
+		Payload:       string(taskJSON),
+		NextAttemptAt: time.Now().UTC(),
+	}
+	doc := newDocument(downloadToken, meta)
 	depStart = time.Now()
-	err = rabbitCh.PublishWithContext(opCtx,
-		"",
-		queueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        taskJSON,
-		},
-	)
-	appmetrics.ObserveDependency("uploader", "rabbitmq", "publish", depStart, err)
-	appmetrics.RabbitMQPublish.WithLabelValues(queueName, appmetrics.ResultFromErr(err)).Inc()
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&doc).Error; err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+	appmetrics.ObserveDependency("uploader", "postgres", "outbox_insert", depStart, err)
 	if err != nil {
-		log.Printf("Failed to publish task: %v", err)
-		_ = rdb.Del(opCtx, "doc:"+downloadToken).Err()
-		_ = deleteUploadArtifacts(opCtx, s3Client, bucket, finalKey)
-		return
+		log.Printf("Failed to record upload in outbox for %s: %v", logutil.MaskToken(downloadToken), err)
+		_ = deleteUploadArtifacts(ctx, s3Client, bucket, finalKey)
+		return "", err
 	}
+	wakeOutboxRelay()
 
-	result = "success"
 	log.Printf("Upload complete: file=%s email=%s finalKey=%s token=%s links=prepared", filename, logutil.MaskEmail(email), finalKey, logutil.MaskToken(downloadToken))
+	return downloadToken, nil
 }
 
 func handleVerifyUploadComplete(
@@ -373,7 +438,7 @@ func handleVerifyUploadComplete(
 	}
 
 	depStart = time.Now()
-	finalKey, err := moveUploadedObject(opCtx, s3Client, bucket, storageKey, verifyObjectPrefix)
+	finalKey, err := moveUploadedObject(opCtx, s3Client, bucket, storageKey, verifyObjectPrefix, true)
 	appmetrics.UploadS3Move.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
 	appmetrics.ObserveDependency("uploader", "minio", "s3_move", depStart, err)
 	if err != nil {
@@ -415,12 +480,20 @@ func handleVerifyUploadComplete(
 	if err != nil {
 		log.Printf("Warning: could not schedule verify cleanup for %s: %v", finalKey, err)
 	}
+	// The signer is usually already waiting for this token; without the
+	// message it only notices the metadata on its slow recheck.
+	depStart = time.Now()
+	err = rdb.Publish(opCtx, verifyReadyChannel, verifyToken).Err()
+	appmetrics.ObserveDependency("uploader", "redis", "redis_publish", depStart, err)
+	if err != nil {
+		log.Printf("Warning: could not publish verify upload completion for %s: %v", logutil.MaskToken(verifyToken), err)
+	}
 
 	result = "success"
 	log.Printf("Stored verify upload: token=%s key=%s", logutil.MaskToken(verifyToken), finalKey)
 }
 
-func moveUploadedObject(ctx context.Context, s3Client *s3.Client, bucket, oldKey, keyPrefix string) (string, error) {
+func moveUploadedObject(ctx context.Context, s3Client *s3.Client, bucket, oldKey, keyPrefix string, hasInfo bool) (string, error) {
 	now := time.Now().UTC()
 	newKey := fmt.Sprintf("%s%d/%02d/%s", keyPrefix, now.Year(), int(now.Month()), oldKey)
 
@@ -428,6 +501,9 @@ func moveUploadedObject(ctx context.Context, s3Client *s3.Client, bucket, oldKey
 		return "", err
 	}
 	log.Printf("Moved object in S3 from %s to %s", oldKey, newKey)
+	if !hasInfo {
+		return newKey, nil
+	}
 
 	oldInfoKey := oldKey + ".info"
 	newInfoKey := newKey + ".info"
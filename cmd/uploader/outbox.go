@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/logutil"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+	"github.com/yarlKot1904/signer/internal/queue"
+	"github.com/yarlKot1904/signer/internal/tokenpolicy"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxPollInterval   = 2 * time.Second
+	outboxBatchSize      = 50
+	outboxMaxBackoff     = 5 * time.Minute
+	outboxRetention      = 7 * 24 * time.Hour
+	outboxPruneInterval  = time.Hour
+	outboxClaimLease     = time.Minute
+	outboxLastErrorLimit = 512
+)
+
+type OutboxEntry struct {
+	ID            uint64 `gorm:"primaryKey"`
+	Token         string `gorm:"uniqueIndex;not null"`
+	Queue         string `gorm:"not null"`
+	DocMeta       string `gorm:"not null"`
+	Payload       string `gorm:"not null"`
+	Attempts      int    `gorm:"default:0"`
+	LastError     string
+	NextAttemptAt time.Time  `gorm:"index;not null"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+	SentAt        *time.Time `gorm:"index"`
+}
+
+var outboxWake = make(chan struct{}, 1)
+
+func wakeOutboxRelay() {
+	select {
+	case outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func runOutboxRelay(appCtx context.Context, cfg *config.Config, rdb *redis.Client, tasks queue.Queue) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	deliver := func(ctx context.Context, entry *OutboxEntry) error {
+		return deliverOutboxEntry(ctx, rdb, tasks, entry)
+	}
+
+	for {
+		for {
+			relayed, err := relayOutboxBatch(appCtx, cfg.DependencyTimeout, deliver)
+			if err != nil {
+				log.Printf("Outbox relay batch failed: %v", err)
+				break
+			}
+			if relayed < outboxBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastPrune) >= outboxPruneInterval {
+			opCtx, cancel := context.WithTimeout(appCtx, cfg.DependencyTimeout)
+			pruneOutbox(opCtx)
+			refreshOutboxPending(opCtx)
+			cancel()
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-appCtx.Done():
+			return
+		case <-outboxWake:
+		case <-ticker.C:
+			opCtx, cancel := context.WithTimeout(appCtx, cfg.DependencyTimeout)
+			refreshOutboxPending(opCtx)
+			cancel()
+		}
+	}
+}
+
+// relayOutboxBatch returns the number of entries it claimed. Publishing
+// happens after the claim commits, so no row lock or transaction is held
+// across network calls.
+func relayOutboxBatch(appCtx context.Context, timeout time.Duration, deliver func(context.Context, *OutboxEntry) error) (int, error) {
+	claimCtx, cancel := context.WithTimeout(appCtx, timeout)
+	entries, err := claimOutboxBatch(claimCtx, outboxBatchSize)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+	relayOutboxEntries(appCtx, timeout, entries, deliver, recordOutboxResult)
+	return len(entries), nil
+}
+
+// claimOutboxBatch leases due entries by moving next_attempt_at past
+// outboxClaimLease. Other relays skip leased rows, and an entry whose relay
+// dies mid-batch becomes due again once the lease runs out.
+func claimOutboxBatch(ctx context.Context, limit int) ([]OutboxEntry, error) {
+	var entries []OutboxEntry
+	depStart := time.Now()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("sent_at IS NULL AND next_attempt_at <= ?", now).
+			Order("id").
+			Limit(limit).
+			Find(&entries).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		ids := make([]uint64, len(entries))
+		for i := range entries {
+			ids[i] = entries[i].ID
+		}
+		return tx.Model(&OutboxEntry{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(outboxClaimLease)).Error
+	})
+	appmetrics.ObserveDependency("uploader", "postgres", "outbox_claim", depStart, err)
+	return entries, err
+}
+
+// relayOutboxEntries delivers and records each entry under its own timeout,
+// so a slow publish only delays the entries after it and never undoes the
+// ones already sent. A failed record leaves the entry leased; it is sent
+// again when the lease runs out.
+func relayOutboxEntries(
+	appCtx context.Context,
+	timeout time.Duration,
+	entries []OutboxEntry,
+	deliver func(context.Context, *OutboxEntry) error,
+	record func(context.Context, *OutboxEntry, error) error,
+) {
+	for i := range entries {
+		if appCtx.Err() != nil {
+			return
+		}
+		entry := &entries[i]
+		opCtx, cancel := context.WithTimeout(appCtx, timeout)
+		deliverErr := deliver(opCtx, entry)
+		cancel()
+		switch {
+		case errors.Is(deliverErr, errOutboxExpired):
+			appmetrics.OutboxRelay.WithLabelValues("expired").Inc()
+			entry.LastError = deliverErr.Error()
+			log.Printf("Outbox entry dropped for token=%s: %v", logutil.MaskToken(entry.Token), deliverErr)
+		case deliverErr != nil:
+			appmetrics.OutboxRelay.WithLabelValues("error").Inc()
+			entry.Attempts++
+			entry.LastError = truncateError(deliverErr, outboxLastErrorLimit)
+			entry.NextAttemptAt = time.Now().UTC().Add(outboxBackoff(entry.Attempts))
+			log.Printf("Outbox relay failed for token=%s attempt=%d: %v", logutil.MaskToken(entry.Token), entry.Attempts, deliverErr)
+		default:
+			appmetrics.OutboxRelay.WithLabelValues("success").Inc()
+			log.Printf("Signing task published: token=%s queue=%s", logutil.MaskToken(entry.Token), entry.Queue)
+		}
+		opCtx, cancel = context.WithTimeout(appCtx, timeout)
+		if err := record(opCtx, entry, deliverErr); err != nil {
+			log.Printf("Outbox state update failed for token=%s: %v", logutil.MaskToken(entry.Token), err)
+		}
+		cancel()
+	}
+}
+
+func recordOutboxResult(ctx context.Context, entry *OutboxEntry, deliverErr error) error {
+	updates := map[string]interface{}{
+		"attempts":        entry.Attempts,
+		"last_error":      entry.LastError,
+		"next_attempt_at": entry.NextAttemptAt,
+	}
+	// Expired entries are closed like sent ones, so the relay stops picking
+	// them up and the prune removes them; last_error tells them apart.
+	if deliverErr == nil || errors.Is(deliverErr, errOutboxExpired) {
+		now := time.Now().UTC()
+		updates = map[string]interface{}{"sent_at": &now, "last_error": entry.LastError}
+	}
+	depStart := time.Now()
+	err := db.WithContext(ctx).Model(entry).Updates(updates).Error
+	appmetrics.ObserveDependency("uploader", "postgres", "outbox_update", depStart, err)
+	return err
+}
+
+// errOutboxExpired marks an entry whose token expired before it could be
+// relayed. Publishing it would bring doc:<token> back for a dead link.
+var errOutboxExpired = errors.New("token expired before relay")
+
+func deliverOutboxEntry(ctx context.Context, rdb *redis.Client, tasks queue.Queue, entry *OutboxEntry) error {
+	ttl := tokenpolicy.DefaultTTL - time.Since(entry.CreatedAt)
+	var meta FileMeta
+	if err := json.Unmarshal([]byte(entry.DocMeta), &meta); err == nil {
+		ttl = meta.TTL(time.Now(), entry.CreatedAt)
+	}
+	if ttl <= 0 {
+		return errOutboxExpired
+	}
+
+	depStart := time.Now()
+	err := rdb.Set(ctx, tokenpolicy.MetaKey(entry.Token), entry.DocMeta, ttl).Err()
+	appmetrics.ObserveDependency("uploader", "redis", "redis_set", depStart, err)
+	appmetrics.TokenWrite.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
+	if err != nil {
+		return fmt.Errorf("store token metadata: %w", err)
+	}
+	appmetrics.TokenTTLSeconds.Observe(ttl.Seconds())
+
+	depStart = time.Now()
+	err = tasks.Publish(ctx, []byte(entry.Payload))
+	appmetrics.ObserveDependency("uploader", tasks.Backend(), "publish", depStart, err)
+	appmetrics.TaskPublish.WithLabelValues(tasks.Backend(), entry.Queue, appmetrics.ResultFromErr(err)).Inc()
+	if err != nil {
+		return fmt.Errorf("publish task: %w", err)
+	}
+	return nil
+}
+
+func pruneOutbox(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-outboxRetention)
+	depStart := time.Now()
+	res := db.WithContext(ctx).Where("sent_at IS NOT NULL AND sent_at < ?", cutoff).Delete(&OutboxEntry{})
+	appmetrics.ObserveDependency("uploader", "postgres", "outbox_prune", depStart, res.Error)
+	if res.Error != nil {
+		log.Printf("Outbox prune failed: %v", res.Error)
+		return
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("Outbox pruned %d sent entries", res.RowsAffected)
+	}
+}
+
+func refreshOutboxPending(ctx context.Context) {
+	var pending int64
+	if err := db.WithContext(ctx).Model(&OutboxEntry{}).Where("sent_at IS NULL").Count(&pending).Error; err != nil {
+		log.Printf("Outbox pending count failed: %v", err)
+		return
+	}
+	appmetrics.OutboxPending.Set(float64(pending))
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := time.Second << min(attempts-1, 16)
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+	return backoff
+}
+
+func truncateError(err error, limit int) string {
+	msg := err.Error()
+	if len(msg) > limit {
+		return msg[:limit]
+	}
+	return msg
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestRelayOutboxEntries(t *testing.T) {
+	entries := []OutboxEntry{{ID: 1, Token: "a"}, {ID: 2, Token: "b", Attempts: 2}, {ID: 3, Token: "c"}}
+	deliver := func(ctx context.Context, entry *OutboxEntry) error {
+		switch entry.Token {
+		case "b":
+			return errors.New("broker unavailable")
+		case "c":
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+	results := map[string]error{}
+	record := func(ctx context.Context, entry *OutboxEntry, err error) error {
+		if ctx.Err() != nil {
+			t.Errorf("record for %s got an expired context", entry.Token)
+		}
+		results[entry.Token] = err
+		return nil
+	}
+
+	before := time.Now().UTC()
+	relayOutboxEntries(context.Background(), 20*time.Millisecond, entries, deliver, record)
+
+	if len(results) != 3 || results["a"] != nil {
+		t.Fatalf("expected every entry to be recorded and a to be sent, got %v", results)
+	}
+	if results["b"] == nil || entries[1].Attempts != 3 || entries[1].LastError != "broker unavailable" {
+		t.Fatalf("expected b to be rescheduled, got %+v", entries[1])
+	}
+	if !entries[1].NextAttemptAt.After(before.Add(outboxBackoff(3) - time.Second)) {
+		t.Fatalf("expected b to back off, got next attempt %v", entries[1].NextAttemptAt)
+	}
+	if !errors.Is(results["c"], context.DeadlineExceeded) || entries[2].Attempts != 1 {
+		t.Fatalf("expected c to time out on its own deadline, got %v %+v", results["c"], entries[2])
+	}
+	if entries[0].Attempts != 0 {
+		t.Fatalf("expected a to be untouched by later failures, got %+v", entries[0])
+	}
+}
+
+func TestRelayOutboxEntriesStopsOnShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	delivered := 0
+	deliver := func(context.Context, *OutboxEntry) error {
+		delivered++
+		cancel()
+		return nil
+	}
+	record := func(context.Context, *OutboxEntry, error) error { return nil }
+
+	relayOutboxEntries(ctx, time.Second, []OutboxEntry{{Token: "a"}, {Token: "b"}}, deliver, record)
+	if delivered != 1 {
+		t.Fatalf("expected the relay to stop after shutdown, delivered %d", delivered)
+	}
+}
+
+func TestRelayOutboxEntriesDropsExpiredTokens(t *testing.T) {
+	entries := []OutboxEntry{
+		{Token: "old", DocMeta: `{"s3_key":"k"}`, CreatedAt: time.Now().Add(-25 * time.Hour)},
+		{Token: "past", DocMeta: `{"s3_key":"k","expires_at":"2020-01-01T00:00:00Z"}`, CreatedAt: time.Now()},
+	}
+	deliver := func(ctx context.Context, entry *OutboxEntry) error {
+		return deliverOutboxEntry(ctx, nil, nil, entry)
+	}
+	results := map[string]error{}
+	record := func(_ context.Context, entry *OutboxEntry, err error) error {
+		results[entry.Token] = err
+		return nil
+	}
+
+	relayOutboxEntries(context.Background(), time.Second, entries, deliver, record)
+
+	for i, entry := range entries {
+		if !errors.Is(results[entry.Token], errOutboxExpired) {
+			t.Fatalf("expected %s to be dropped, got %v", entry.Token, results[entry.Token])
+		}
+		if entries[i].Attempts != 0 || entries[i].LastError == "" {
+			t.Fatalf("expected %s to be closed without a retry, got %+v", entry.Token, entries[i])
+		}
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{0: time.Second, 1: time.Second, 3: 4 * time.Second, 40: outboxMaxBackoff} {
+		if got := outboxBackoff(attempts); got != want {
+			t.Fatalf("outboxBackoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestClaimOutboxBatch(t *testing.T) {
+	dsn := os.Getenv("UPLOADER_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("UPLOADER_TEST_DB_DSN not set")
+	}
+	var err error
+	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer func() { db = nil }()
+	if err := db.AutoMigrate(&OutboxEntry{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	token := "outbox-test-" + time.Now().Format(time.RFC3339Nano)
+	entry := OutboxEntry{Token: token, Queue: "q", DocMeta: "{}", Payload: "{}", NextAttemptAt: time.Now().UTC().Add(-time.Second)}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	defer db.Delete(&OutboxEntry{}, entry.ID)
+
+	claimed, err := claimOutboxBatch(ctx, 1000)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	found := false
+	for _, e := range claimed {
+		found = found || e.ID == entry.ID
+	}
+	if !found {
+		t.Fatal("expected the due entry to be claimed")
+	}
+	again, err := claimOutboxBatch(ctx, 1000)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	for _, e := range again {
+		if e.ID == entry.ID {
+			t.Fatal("expected a leased entry to be skipped")
+		}
+	}
+
+	if err := recordOutboxResult(ctx, &entry, nil); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	var stored OutboxEntry
+	if err := db.First(&stored, entry.ID).Error; err != nil || stored.SentAt == nil {
+		t.Fatalf("expected the entry to be marked sent, got %+v %v", stored, err)
+	}
+}
@@ -0,0 +1,73 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Proxies lists the networks whose forwarding headers are believed. A request
+// from anywhere else is identified by its TCP peer address, so clients that
+// reach a service directly cannot pick their own address.
+type Proxies []netip.Prefix
+
+// ParseProxies reads CIDR ranges or single addresses. It returns nil, which
+// trusts no proxy, when none are configured.
+func ParseProxies(entries []string) (Proxies, error) {
+	var proxies Proxies
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an address or CIDR range", entry)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return proxies, nil
+}
+
+// ClientIP prefers the address set by a trusted gateway. nginx and Traefik
+// both overwrite X-Real-IP; for X-Forwarded-For only the entry appended by
+// the nearest proxy is used, since earlier ones come from the client.
+func (p Proxies) ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !p.trusted(peer) {
+		return peer
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		parts := strings.Split(forwarded, ",")
+		if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+			return ip
+		}
+	}
+	return peer
+}
+
+func (p Proxies) trusted(peer string) bool {
+	addr, err := netip.ParseAddr(peer)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", " 192.0.2.1 ", ""})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	cases := []struct {
+		name    string
+		proxies Proxies
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"real ip from proxy", proxies, "10.1.2.3:5000", map[string]string{"X-Real-IP": "203.0.113.7", "X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"nearest forwarded hop", proxies, "192.0.2.1:5000", map[string]string{"X-Forwarded-For": "10.9.9.9, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy without headers", proxies, "10.1.2.3:5000", nil, "10.1.2.3"},
+		{"direct client", proxies, "198.51.100.9:5000", map[string]string{"X-Real-IP": "203.0.113.7"}, "198.51.100.9"},
+		{"no trusted proxies", nil, "10.1.2.3:5000", map[string]string{"X-Real-IP": "203.0.113.7"}, "10.1.2.3"},
+		{"mapped ipv4 peer", proxies, "[::ffff:10.1.2.3]:5000", map[string]string{"X-Real-IP": "203.0.113.7"}, "203.0.113.7"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		if got := tc.proxies.ClientIP(req); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	if proxies, err := ParseProxies(nil); err != nil || proxies != nil {
+		t.Fatalf("expected no proxies, got %v %v", proxies, err)
+	}
+	if _, err := ParseProxies([]string{"gateway"}); err == nil {
+		t.Fatal("expected a hostname to be rejected")
+	}
+}
@@ -12,7 +12,8 @@ type Config struct {
 	MinioSecret   string `envconfig:"MINIO_SECRET"`
 	MinioBucket   string `envconfig:"MINIO_BUCKET" default:"docs-storage"`
 
-	MinioRegion string `envconfig:"MINIO_REGION" default:"us-east-1"`
+	MinioRegion         string `envconfig:"MINIO_REGION" default:"us-east-1"`
+	MinioPublicEndpoint string `envconfig:"MINIO_PUBLIC_ENDPOINT"`
 
 	RedisAddr   string `envconfig:"REDIS_ADDR"`
 	HTTPPort    string `envconfig:"HTTP_PORT" default:"8080"`
@@ -22,6 +23,7 @@ type Config struct {
 	DBDSN     string `envconfig:"DB_DSN"`
 
 	PDFSignURL      string `envconfig:"PDFSIGN_URL"`
+	SignEngine      string `envconfig:"SIGN_ENGINE" default:"pdfsigner"`
 	MailerURL       string `envconfig:"MAILER_URL"`
 	PublicBaseURL   string `envconfig:"PUBLIC_BASE_URL" default:"http://signer.local"`
 	MasterKeyHex    string `envconfig:"MASTER_KEY_HEX"`
@@ -43,6 +45,40 @@ type Config struct {
 	DependencyTimeout     time.Duration `envconfig:"DEPENDENCY_TIMEOUT" default:"30s"`
 	PDFSignTimeout        time.Duration `envconfig:"PDFSIGN_TIMEOUT" default:"60s"`
 
+	TaskQueueBackend string        `envconfig:"TASK_QUEUE_BACKEND" default:"rabbitmq"`
+	TaskClaimIdle    time.Duration `envconfig:"TASK_CLAIM_IDLE" default:"5m"`
+	TaskMaxAttempts  int           `envconfig:"TASK_MAX_ATTEMPTS" default:"6"`
+	TaskWorkers      int           `envconfig:"TASK_WORKERS" default:"4"`
+	TaskPrefetch     int           `envconfig:"TASK_PREFETCH" default:"8"`
+
+	ReminderThresholds []time.Duration `envconfig:"REMINDER_THRESHOLDS" default:"4h,20h"`
+	ReminderMax        int             `envconfig:"REMINDER_MAX" default:"2"`
+	ReminderInterval   time.Duration   `envconfig:"REMINDER_INTERVAL" default:"5m"`
+
+	DownloadRedirect bool          `envconfig:"DOWNLOAD_REDIRECT" default:"false"`
+	ViewRedirect     bool          `envconfig:"VIEW_REDIRECT" default:"false"`
+	PresignTTL       time.Duration `envconfig:"PRESIGN_TTL" default:"5m"`
+	TokenMaxTTL      time.Duration `envconfig:"TOKEN_MAX_TTL" default:"168h"`
+
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
+
+	DocumentRetention time.Duration `envconfig:"DOCUMENT_RETENTION" default:"8760h"`
+	LinkSigningKeys   []string      `envconfig:"LINK_SIGNING_KEYS"`
+	SignedLinkTTL     time.Duration `envconfig:"SIGNED_LINK_TTL" default:"720h"`
+
+	VerifyHashRateLimit  int           `envconfig:"VERIFY_HASH_RATE_LIMIT" default:"30"`
+	VerifyHashRateWindow time.Duration `envconfig:"VERIFY_HASH_RATE_WINDOW" default:"1m"`
+	ReceiptSigningKeys   []string      `envconfig:"RECEIPT_SIGNING_KEYS"`
+	TrustStoreDir        string        `envconfig:"TRUST_STORE_DIR"`
+	VerifyBatchWorkers   int           `envconfig:"VERIFY_BATCH_WORKERS" default:"4"`
+	VerifyBatchMaxItems  int           `envconfig:"VERIFY_BATCH_MAX_ITEMS" default:"500"`
+	VerifyBatchTimeout   time.Duration `envconfig:"VERIFY_BATCH_TIMEOUT" default:"10m"`
+	VerifyCacheTTL       time.Duration `envconfig:"VERIFY_CACHE_TTL" default:"1h"`
+	VerifyEngine         string        `envconfig:"VERIFY_ENGINE" default:"pdfsigner"`
+
+	AccessLogBatch         int           `envconfig:"ACCESS_LOG_BATCH" default:"200"`
+	AccessLogFlushInterval time.Duration `envconfig:"ACCESS_LOG_FLUSH_INTERVAL" default:"2s"`
+
 	UploadMaxBytes int64 `envconfig:"UPLOAD_MAX_BYTES" default:"10485760"`
 	JSONMaxBytes   int64 `envconfig:"JSON_MAX_BYTES" default:"1048576"`
 }
@@ -0,0 +1,356 @@
+package infra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+)
+
+const (
+	rabbitMinBackoff = 500 * time.Millisecond
+	rabbitMaxBackoff = 30 * time.Second
+)
+
+var ErrRabbitMQClosed = errors.New("rabbitmq connection manager closed")
+
+type RabbitTopology func(ch *amqp.Channel) error
+
+type RabbitMQ struct {
+	service  string
+	url      string
+	topology RabbitTopology
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.RWMutex
+	closed    bool
+	conn      *amqp.Connection
+	pubCh     *amqp.Channel
+	connected chan struct{}
+}
+
+func NewRabbitMQ(ctx context.Context, service, url string, topology RabbitTopology) (*RabbitMQ, error) {
+	managerCtx, cancel := context.WithCancel(context.Background())
+	r := &RabbitMQ{
+		service:   service,
+		url:       url,
+		topology:  topology,
+		ctx:       managerCtx,
+		cancel:    cancel,
+		connected: make(chan struct{}),
+	}
+
+	if err := r.connectWithBackoff(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	go r.supervise()
+	return r, nil
+}
+
+// Close stops the reconnect loop. A connect that is still dialing when Close
+// runs closes its connection instead of publishing it.
+func (r *RabbitMQ) Close() error {
+	r.cancel()
+
+	r.mu.Lock()
+	r.closed = true
+	conn := r.conn
+	r.conn = nil
+	r.pubCh = nil
+	r.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+func (r *RabbitMQ) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	_, ch, err := r.waitConnected(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("broker did not acknowledge publish to %q", key)
+	}
+	return nil
+}
+
+func (r *RabbitMQ) WithChannel(ctx context.Context, fn func(ch *amqp.Channel) error) error {
+	conn, _, err := r.waitConnected(ctx)
+	if err != nil {
+		return err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+func (r *RabbitMQ) QueueDepth(ctx context.Context, queue string) (int, error) {
+	depth := 0
+	err := r.WithChannel(ctx, func(ch *amqp.Channel) error {
+		q, err := ch.QueueDeclarePassive(queue, true, false, false, false, nil)
+		depth = q.Messages
+		return err
+	})
+	return depth, err
+}
+
+type ConsumeOptions struct {
+	Prefetch int
+	Workers  int
+}
+
+func (r *RabbitMQ) Consume(ctx context.Context, queue string, opts ConsumeOptions, handler func(amqp.Delivery)) error {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Prefetch < opts.Workers {
+		opts.Prefetch = opts.Workers
+	}
+
+	backoff := rabbitMinBackoff
+	for {
+		conn, _, err := r.waitConnected(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		ch, deliveries, err := r.subscribe(conn, queue, opts.Prefetch)
+		if err != nil {
+			log.Printf("%s RabbitMQ subscribe to %s failed: %v", r.service, queue, err)
+			if !sleepContext(ctx, backoff) {
+				return nil
+			}
+			backoff = nextBackoff(backoff)
+			continue
+		}
+		backoff = rabbitMinBackoff
+		log.Printf("%s RabbitMQ consumer subscribed to %s (workers=%d prefetch=%d)", r.service, queue, opts.Workers, opts.Prefetch)
+
+		if done := r.drain(ctx, deliveries, opts.Workers, handler); done {
+			_ = ch.Close()
+			return nil
+		}
+		log.Printf("%s RabbitMQ consumer channel for %s closed, resubscribing", r.service, queue)
+	}
+}
+
+func (r *RabbitMQ) subscribe(conn *amqp.Connection, queue string, prefetch int) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		_ = ch.Close()
+		return nil, nil, err
+	}
+	deliveries, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err != nil {
+		_ = ch.Close()
+		return nil, nil, err
+	}
+	return ch, deliveries, nil
+}
+
+func (r *RabbitMQ) drain(ctx context.Context, deliveries <-chan amqp.Delivery, workers int, handler func(amqp.Delivery)) bool {
+	jobs := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for delivery := range jobs {
+				handler(delivery)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-r.ctx.Done():
+			return true
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return false
+			}
+			select {
+			case jobs <- delivery:
+			case <-ctx.Done():
+				_ = delivery.Nack(false, true)
+				return true
+			case <-r.ctx.Done():
+				return true
+			}
+		}
+	}
+}
+
+func (r *RabbitMQ) waitConnected(ctx context.Context) (*amqp.Connection, *amqp.Channel, error) {
+	for {
+		r.mu.RLock()
+		conn, ch, ready := r.conn, r.pubCh, r.connected
+		r.mu.RUnlock()
+
+		if conn != nil && !conn.IsClosed() {
+			return conn, ch, nil
+		}
+
+		wait := ready
+		if conn != nil {
+			wait = nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-r.ctx.Done():
+			return nil, nil, ErrRabbitMQClosed
+		case <-wait:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func (r *RabbitMQ) supervise() {
+	for {
+		r.mu.RLock()
+		conn, ch := r.conn, r.pubCh
+		r.mu.RUnlock()
+		if conn == nil {
+			return
+		}
+
+		connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+		var reason *amqp.Error
+		select {
+		case <-r.ctx.Done():
+			return
+		case reason = <-connClosed:
+		case reason = <-chClosed:
+		}
+
+		r.mu.Lock()
+		r.conn = nil
+		r.pubCh = nil
+		r.connected = make(chan struct{})
+		r.mu.Unlock()
+		_ = conn.Close()
+
+		appmetrics.RabbitMQConnected.WithLabelValues(r.service).Set(0)
+		log.Printf("%s RabbitMQ connection lost: %v", r.service, reason)
+
+		if err := r.connectWithBackoff(r.ctx); err != nil {
+			return
+		}
+	}
+}
+
+func (r *RabbitMQ) connectWithBackoff(ctx context.Context) error {
+	backoff := rabbitMinBackoff
+	for {
+		err := r.connect()
+		if errors.Is(err, ErrRabbitMQClosed) {
+			return err
+		}
+		appmetrics.RabbitMQConnects.WithLabelValues(r.service, appmetrics.ResultFromErr(err)).Inc()
+		if err == nil {
+			return nil
+		}
+		log.Printf("%s RabbitMQ connect failed, retrying in %s: %v", r.service, backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.ctx.Done():
+			return ErrRabbitMQClosed
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff)
+	}
+}
+
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if r.topology != nil {
+		if err := r.topology(ch); err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("declare topology: %w", err)
+		}
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("enable publisher confirms: %w", err)
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = conn.Close()
+		return ErrRabbitMQClosed
+	}
+	r.conn = conn
+	r.pubCh = ch
+	close(r.connected)
+	r.mu.Unlock()
+
+	appmetrics.RabbitMQConnected.WithLabelValues(r.service).Set(1)
+	log.Printf("%s RabbitMQ connected", r.service)
+	return nil
+}
+
+func nextBackoff(current time.Duration) time.Duration {
+	next := current * 2
+	if next > rabbitMaxBackoff {
+		return rabbitMaxBackoff
+	}
+	return next
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
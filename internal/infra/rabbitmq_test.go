@@ -0,0 +1,283 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDrainRunsWorkersConcurrentlyAndWaitsOnShutdown(t *testing.T) {
+	managerCtx, cancelManager := context.WithCancel(context.Background())
+	defer cancelManager()
+	r := &RabbitMQ{service: "test", ctx: managerCtx}
+
+	deliveries := make(chan amqp.Delivery, 3)
+	for i := 0; i < 3; i++ {
+		deliveries <- amqp.Delivery{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	var finished atomic.Int32
+
+	result := make(chan bool, 1)
+	go func() {
+		result <- r.drain(ctx, deliveries, 3, func(amqp.Delivery) {
+			started <- struct{}{}
+			<-release
+			finished.Add(1)
+		})
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 concurrent handlers, got %d", i)
+		}
+	}
+
+	cancel()
+	select {
+	case <-result:
+		t.Fatal("drain returned before in-flight handlers finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case done := <-result:
+		if !done {
+			t.Fatal("expected drain to report shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("drain did not return after handlers finished")
+	}
+	if got := finished.Load(); got != 3 {
+		t.Fatalf("expected 3 finished handlers, got %d", got)
+	}
+}
+
+func TestDrainReportsClosedDeliveries(t *testing.T) {
+	r := &RabbitMQ{service: "test", ctx: context.Background()}
+
+	deliveries := make(chan amqp.Delivery)
+	close(deliveries)
+
+	if done := r.drain(context.Background(), deliveries, 2, func(amqp.Delivery) {}); done {
+		t.Fatal("expected closed delivery channel to request a resubscribe")
+	}
+}
+
+// fakeBroker speaks just enough AMQP 0-9-1 for a client to connect, open a
+// channel and enable publisher confirms.
+type fakeBroker struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	conns   []net.Conn
+	hold    chan struct{}
+	holding chan struct{}
+
+	accepted     atomic.Int32
+	clientClosed chan struct{}
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	b := &fakeBroker{ln: ln, clientClosed: make(chan struct{}, 8)}
+	t.Cleanup(func() {
+		ln.Close()
+		b.drop()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.accepted.Add(1)
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			hold, holding := b.hold, b.holding
+			b.mu.Unlock()
+			go b.serve(conn, hold, holding)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) url() string {
+	return "amqp://guest:guest@" + b.ln.Addr().String() + "/"
+}
+
+// holdOpen makes later handshakes wait before connection.open-ok until the
+// returned function is called; holding receives once a handshake is waiting.
+func (b *fakeBroker) holdOpen() (holding <-chan struct{}, release func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hold = make(chan struct{})
+	b.holding = make(chan struct{}, 1)
+	return b.holding, func() { close(b.hold) }
+}
+
+func (b *fakeBroker) drop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.conns = nil
+}
+
+func (b *fakeBroker) serve(conn net.Conn, hold, holding chan struct{}) {
+	defer conn.Close()
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+
+	var start bytes.Buffer
+	start.Write([]byte{0, 9})
+	binary.Write(&start, binary.BigEndian, uint32(0))
+	writeLongString(&start, "PLAIN")
+	writeLongString(&start, "en_US")
+	writeMethod(conn, 0, 10, 10, start.Bytes())
+
+	for {
+		frameType, channel, payload, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		if frameType != 1 || len(payload) < 4 {
+			continue
+		}
+		class, method := binary.BigEndian.Uint16(payload), binary.BigEndian.Uint16(payload[2:])
+		switch {
+		case class == 10 && method == 11:
+			writeMethod(conn, 0, 10, 30, []byte{0x07, 0xff, 0, 2, 0, 0, 0, 0})
+		case class == 10 && method == 40:
+			if hold != nil {
+				holding <- struct{}{}
+				<-hold
+			}
+			writeMethod(conn, 0, 10, 41, []byte{0})
+		case class == 10 && method == 50:
+			writeMethod(conn, 0, 10, 51, nil)
+			b.clientClosed <- struct{}{}
+			return
+		case class == 20 && method == 10:
+			writeMethod(conn, channel, 20, 11, []byte{0, 0, 0, 0})
+		case class == 20 && method == 40:
+			writeMethod(conn, channel, 20, 41, nil)
+		case class == 85 && method == 10:
+			writeMethod(conn, channel, 85, 11, nil)
+		}
+	}
+}
+
+func readFrame(r io.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func writeMethod(w io.Writer, channel, class, method uint16, args []byte) {
+	var frame bytes.Buffer
+	frame.WriteByte(1)
+	binary.Write(&frame, binary.BigEndian, channel)
+	binary.Write(&frame, binary.BigEndian, uint32(4+len(args)))
+	binary.Write(&frame, binary.BigEndian, class)
+	binary.Write(&frame, binary.BigEndian, method)
+	frame.Write(args)
+	frame.WriteByte(0xce)
+	w.Write(frame.Bytes())
+}
+
+func writeLongString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+func currentConn(r *RabbitMQ) *amqp.Connection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.conn
+}
+
+func TestRabbitMQReconnectsAfterConnectionLoss(t *testing.T) {
+	broker := newFakeBroker(t)
+	r, err := NewRabbitMQ(context.Background(), "test", broker.url(), nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer r.Close()
+	first := currentConn(r)
+
+	broker.drop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		conn, _, err := r.waitConnected(ctx)
+		if err != nil {
+			t.Fatalf("expected a reconnect, got %v", err)
+		}
+		if conn != first {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := broker.accepted.Load(); got != 2 {
+		t.Fatalf("expected 2 connections, got %d", got)
+	}
+}
+
+func TestRabbitMQCloseDuringReconnect(t *testing.T) {
+	broker := newFakeBroker(t)
+	r, err := NewRabbitMQ(context.Background(), "test", broker.url(), nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	holding, release := broker.holdOpen()
+	broker.drop()
+	select {
+	case <-holding:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the manager to start reconnecting")
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	release()
+
+	select {
+	case <-broker.clientClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection opened after Close to be closed")
+	}
+	if conn := currentConn(r); conn != nil {
+		t.Fatal("expected no connection after Close")
+	}
+}
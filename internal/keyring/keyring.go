@@ -0,0 +1,61 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxIDLength bounds key ids, which travel in every link and receipt.
+const MaxIDLength = 32
+
+var ErrInvalidEntry = errors.New("invalid key entry")
+
+// Entry is one <id>:<hex secret> element of a key list.
+type Entry struct {
+	ID     string
+	Secret []byte
+}
+
+// Parse reads a key list in configuration order, so the first entry is the
+// one new signatures use. Blank entries are skipped; ids must be valid and
+// unique. Checking the secret length is left to the caller.
+func Parse(entries []string) ([]Entry, error) {
+	var out []Entry
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secretHex, ok := strings.Cut(entry, ":")
+		if !ok || !ValidName(id, MaxIDLength) {
+			return nil, fmt.Errorf("%w: entries must look like <id>:<hex secret>", ErrInvalidEntry)
+		}
+		secret, err := hex.DecodeString(secretHex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s is not hex-encoded", ErrInvalidEntry, id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("%w: duplicate key id %s", ErrInvalidEntry, id)
+		}
+		seen[id] = true
+		out = append(out, Entry{ID: id, Secret: secret})
+	}
+	return out, nil
+}
+
+// ValidName reports whether name is a non-empty run of ASCII letters, digits,
+// '-' and '_' no longer than maxLen. Key ids and trust store tenants share it.
+func ValidName(name string, maxLen int) bool {
+	if name == "" || len(name) > maxLen {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package keyring
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	entries, err := Parse([]string{" k2:00ff ", "", "k1:0102"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "k2" || entries[1].ID != "k1" || string(entries[0].Secret) != "\x00\xff" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries, err := Parse(nil); entries != nil || err != nil {
+		t.Fatalf("expected no entries, got %v %v", entries, err)
+	}
+
+	for _, bad := range [][]string{
+		{"k1"},
+		{"k1:nothex"},
+		{"bad id:00"},
+		{strings.Repeat("k", MaxIDLength+1) + ":00"},
+		{"k1:00", "k1:01"},
+	} {
+		if _, err := Parse(bad); !errors.Is(err, ErrInvalidEntry) {
+			t.Fatalf("expected %v to be rejected, got %v", bad, err)
+		}
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"acme":                  true,
+		"Acme_2-prod":           true,
+		"":                      false,
+		"acme/../x":             false,
+		"ac me":                 false,
+		"é":                     false,
+		strings.Repeat("a", 64): true,
+		strings.Repeat("a", 65): false,
+	} {
+		if got := ValidName(name, 64); got != want {
+			t.Errorf("ValidName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
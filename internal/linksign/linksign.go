@@ -0,0 +1,133 @@
+package linksign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/keyring"
+)
+
+const (
+	PathPrefix = "/link/"
+
+	minKeyBytes = 32
+)
+
+type Artifact string
+
+const (
+	Original Artifact = "original"
+	Signed   Artifact = "signed"
+)
+
+type Disposition string
+
+const (
+	Attachment Disposition = "attachment"
+	Inline     Disposition = "inline"
+)
+
+var (
+	ErrInvalidKeys = errors.New("invalid link signing keys")
+	ErrInvalidLink = errors.New("invalid signed link")
+	ErrExpired     = errors.New("signed link expired")
+)
+
+type Link struct {
+	Token       string
+	Artifact    Artifact
+	Disposition Disposition
+	ExpiresAt   time.Time
+}
+
+// KeySet holds the HMAC keys accepted for signed links. New links are signed
+// with the first configured key; older keys stay valid for verification until
+// they are removed from the list.
+type KeySet struct {
+	current string
+	keys    map[string][]byte
+}
+
+// ParseKeys reads entries of the form <id>:<hex secret>. It returns nil when no
+// keys are configured.
+func ParseKeys(entries []string) (*KeySet, error) {
+	parsed, err := keyring.Parse(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeys, err)
+	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
+	ks := &KeySet{current: parsed[0].ID, keys: map[string][]byte{}}
+	for _, entry := range parsed {
+		if len(entry.Secret) < minKeyBytes {
+			return nil, fmt.Errorf("%w: key %s must be at least %d hex-encoded bytes", ErrInvalidKeys, entry.ID, minKeyBytes)
+		}
+		ks.keys[entry.ID] = entry.Secret
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) Sign(link Link) url.Values {
+	exp := strconv.FormatInt(link.ExpiresAt.Unix(), 10)
+	values := url.Values{}
+	values.Set("a", string(link.Artifact))
+	values.Set("d", string(link.Disposition))
+	values.Set("exp", exp)
+	values.Set("kid", ks.current)
+	values.Set("sig", signature(ks.keys[ks.current], link.Token, link.Artifact, link.Disposition, exp))
+	return values
+}
+
+// Path returns the downloader path of a signed link, relative to the public
+// base URL.
+func (ks *KeySet) Path(link Link) string {
+	return PathPrefix + url.PathEscape(link.Token) + "?" + ks.Sign(link).Encode()
+}
+
+func (ks *KeySet) Verify(token string, values url.Values, now time.Time) (Link, error) {
+	link := Link{
+		Token:       token,
+		Artifact:    Artifact(values.Get("a")),
+		Disposition: Disposition(values.Get("d")),
+	}
+	if token == "" {
+		return Link{}, ErrInvalidLink
+	}
+	if link.Artifact != Original && link.Artifact != Signed {
+		return Link{}, ErrInvalidLink
+	}
+	if link.Disposition != Attachment && link.Disposition != Inline {
+		return Link{}, ErrInvalidLink
+	}
+	exp := values.Get("exp")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return Link{}, ErrInvalidLink
+	}
+	key, ok := ks.keys[values.Get("kid")]
+	if !ok {
+		return Link{}, ErrInvalidLink
+	}
+	expected := signature(key, token, link.Artifact, link.Disposition, exp)
+	if !hmac.Equal([]byte(expected), []byte(values.Get("sig"))) {
+		return Link{}, ErrInvalidLink
+	}
+	link.ExpiresAt = time.Unix(unix, 0).UTC()
+	if !now.Before(link.ExpiresAt) {
+		return link, ErrExpired
+	}
+	return link, nil
+}
+
+func signature(key []byte, token string, artifact Artifact, disposition Disposition, exp string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("v1\n" + token + "\n" + string(artifact) + "\n" + string(disposition) + "\n" + exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
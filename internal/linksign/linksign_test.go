@@ -0,0 +1,110 @@
+package linksign
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyA = "0000000000000000000000000000000000000000000000000000000000000001"
+	testKeyB = "0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+func mustKeys(t *testing.T, entries ...string) *KeySet {
+	t.Helper()
+	ks, err := ParseKeys(entries)
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	return ks
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	ks := mustKeys(t, "k1:"+testKeyA)
+	link := Link{Token: "abc-token", Artifact: Signed, Disposition: Inline, ExpiresAt: now.Add(time.Hour)}
+
+	got, err := ks.Verify("abc-token", ks.Sign(link), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != link {
+		t.Fatalf("unexpected link: %+v", got)
+	}
+
+	if _, err := ks.Verify("abc-token", ks.Sign(link), now.Add(time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired link, got %v", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	ks := mustKeys(t, "k1:"+testKeyA)
+	values := ks.Sign(Link{Token: "abc-token", Artifact: Original, Disposition: Inline, ExpiresAt: now.Add(time.Hour)})
+
+	if _, err := ks.Verify("other-token", values, now); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expected token swap to be rejected, got %v", err)
+	}
+	for param, value := range map[string]string{"a": "signed", "d": "attachment", "exp": "9999999999", "kid": "k9", "sig": "AAAA"} {
+		tampered := url.Values{}
+		for k, v := range values {
+			tampered[k] = v
+		}
+		tampered.Set(param, value)
+		if _, err := ks.Verify("abc-token", tampered, now); !errors.Is(err, ErrInvalidLink) {
+			t.Fatalf("expected changed %s to be rejected, got %v", param, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	link := Link{Token: "abc-token", Artifact: Original, Disposition: Attachment, ExpiresAt: now.Add(time.Hour)}
+	old := mustKeys(t, "k1:"+testKeyA).Sign(link)
+
+	rotated := mustKeys(t, "k2:"+testKeyB, "k1:"+testKeyA)
+	if _, err := rotated.Verify("abc-token", old, now); err != nil {
+		t.Fatalf("expected link signed with the previous key to verify: %v", err)
+	}
+	if kid := rotated.Sign(link).Get("kid"); kid != "k2" {
+		t.Fatalf("expected new links to use the first key, got %s", kid)
+	}
+
+	retired := mustKeys(t, "k2:"+testKeyB)
+	if _, err := retired.Verify("abc-token", old, now); !errors.Is(err, ErrInvalidLink) {
+		t.Fatalf("expected link signed with a removed key to be rejected, got %v", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	if ks, err := ParseKeys(nil); ks != nil || err != nil {
+		t.Fatalf("expected no key set, got %v %v", ks, err)
+	}
+	for _, entries := range [][]string{
+		{"k1"},
+		{"k1:nothex"},
+		{"k1:" + strings.Repeat("00", 16)},
+		{"bad id:" + testKeyA},
+		{"k1:" + testKeyA, "k1:" + testKeyB},
+	} {
+		if _, err := ParseKeys(entries); !errors.Is(err, ErrInvalidKeys) {
+			t.Fatalf("expected %v to be rejected, got %v", entries, err)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	ks := mustKeys(t, "k1:"+testKeyA)
+	path := ks.Path(Link{Token: "abc-token", Artifact: Signed, Disposition: Attachment, ExpiresAt: time.Unix(1800000000, 0)})
+
+	u, err := url.Parse(path)
+	if err != nil {
+		t.Fatalf("bad path: %v", err)
+	}
+	if u.Path != "/link/abc-token" || u.Query().Get("exp") != "1800000000" || u.Query().Get("sig") == "" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+}
@@ -10,8 +10,9 @@ import (
 )
 
 const (
-	TemplateSigningOTP     = "signing-otp"
-	TemplateSignedDocument = "signed-document"
+	TemplateSigningOTP      = "signing-otp"
+	TemplateSigningReminder = "signing-reminder"
+	TemplateSignedDocument  = "signed-document"
 )
 
 type SendRequest struct {
@@ -28,6 +29,7 @@ type Message struct {
 	Recipient   string
 	Subject     string
 	Body        string
+	HTMLBody    string
 	MessageID   string
 	Correlation string
 	Metadata    map[string]string
@@ -77,6 +79,8 @@ func Render(req SendRequest) (Message, error) {
 	switch req.Template {
 	case TemplateSigningOTP:
 		return renderSigningOTP(req)
+	case TemplateSigningReminder:
+		return renderSigningReminder(req)
 	case TemplateSignedDocument:
 		return renderSignedDocument(req)
 	default:
@@ -97,16 +101,51 @@ func renderSigningOTP(req SendRequest) (Message, error) {
 		subject = "Signer OTP code"
 	}
 
-	body := fmt.Sprintf(
-		"Your one-time password for PDF signing is %s.\n\nSign document: %s\nDownload original PDF: %s\nPreview document: %s\n",
-		req.Variables["code"],
-		req.Variables["sign_url"],
-		req.Variables["download_url"],
-		req.Variables["view_url"],
-	)
+	body, htmlBody, err := renderBodies(req.Template, templateData{Subject: subject, Vars: req.Variables})
+	if err != nil {
+		return Message{}, err
+	}
+
+	metadata := map[string]string{
+		"code_length":      "6",
+		"has_sign_url":     fmt.Sprintf("%t", req.Variables["sign_url"] != ""),
+		"has_view_url":     fmt.Sprintf("%t", req.Variables["view_url"] != ""),
+		"has_download_url": fmt.Sprintf("%t", req.Variables["download_url"] != ""),
+	}
+
+	return Message{
+		Template:    req.Template,
+		Recipient:   req.Recipient,
+		Subject:     subject,
+		Body:        body,
+		HTMLBody:    htmlBody,
+		MessageID:   req.MessageID,
+		Correlation: req.Correlation,
+		Metadata:    metadata,
+	}, nil
+}
+
+func renderSigningReminder(req SendRequest) (Message, error) {
+	requiredKeys := []string{"code", "sign_url", "download_url", "view_url"}
+	for _, key := range requiredKeys {
+		if req.Variables[key] == "" {
+			return Message{}, fmt.Errorf("missing variable %q for template %s", key, req.Template)
+		}
+	}
+
+	subject := req.Subject
+	if subject == "" {
+		subject = "Reminder: a document is waiting for your signature"
+	}
+
+	body, htmlBody, err := renderBodies(req.Template, templateData{Subject: subject, Vars: req.Variables})
+	if err != nil {
+		return Message{}, err
+	}
 
 	metadata := map[string]string{
 		"code_length":      "6",
+		"reminder":         req.Variables["reminder"],
 		"has_sign_url":     fmt.Sprintf("%t", req.Variables["sign_url"] != ""),
 		"has_view_url":     fmt.Sprintf("%t", req.Variables["view_url"] != ""),
 		"has_download_url": fmt.Sprintf("%t", req.Variables["download_url"] != ""),
@@ -117,6 +156,7 @@ func renderSigningOTP(req SendRequest) (Message, error) {
 		Recipient:   req.Recipient,
 		Subject:     subject,
 		Body:        body,
+		HTMLBody:    htmlBody,
 		MessageID:   req.MessageID,
 		Correlation: req.Correlation,
 		Metadata:    metadata,
@@ -136,11 +176,10 @@ func renderSignedDocument(req SendRequest) (Message, error) {
 		subject = "Signer signed document"
 	}
 
-	body := fmt.Sprintf(
-		"Your signed PDF is ready.\n\nDownload signed PDF: %s\nPreview signed PDF: %s\n",
-		req.Variables["signed_download_url"],
-		req.Variables["signed_view_url"],
-	)
+	body, htmlBody, err := renderBodies(req.Template, templateData{Subject: subject, Vars: req.Variables})
+	if err != nil {
+		return Message{}, err
+	}
 
 	metadata := map[string]string{
 		"has_signed_download_url": fmt.Sprintf("%t", req.Variables["signed_download_url"] != ""),
@@ -152,6 +191,7 @@ func renderSignedDocument(req SendRequest) (Message, error) {
 		Recipient:   req.Recipient,
 		Subject:     subject,
 		Body:        body,
+		HTMLBody:    htmlBody,
 		MessageID:   req.MessageID,
 		Correlation: req.Correlation,
 		Metadata:    metadata,
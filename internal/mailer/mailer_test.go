@@ -1,11 +1,88 @@
 package mailer
 
 import (
+	"flag"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
 
+var updateGolden = flag.Bool("update", false, "rewrite testdata golden files")
+
+func TestRenderGolden(t *testing.T) {
+	links := map[string]string{
+		"code":         "123456",
+		"sign_url":     "http://localhost/sign.html?token=abc&lang=en",
+		"download_url": "http://localhost/download/abc",
+		"view_url":     "http://localhost/view/abc",
+	}
+	for template, vars := range map[string]map[string]string{
+		TemplateSigningOTP:      links,
+		TemplateSigningReminder: links,
+		TemplateSignedDocument: {
+			"signed_download_url": "http://localhost/download/abc?signed=1",
+			"signed_view_url":     "http://localhost/view/abc?signed=1",
+		},
+	} {
+		t.Run(template, func(t *testing.T) {
+			msg, err := Render(SendRequest{Template: template, Recipient: "user@example.com", Variables: vars})
+			if err != nil {
+				t.Fatalf("render failed: %v", err)
+			}
+			checkGolden(t, template+".txt.golden", msg.Body)
+			checkGolden(t, template+".html.golden", msg.HTMLBody)
+		})
+	}
+}
+
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run go test ./internal/mailer -update to create it): %v", err)
+	}
+	if got != string(want) {
+		t.Fatalf("%s does not match the rendered body; rerun with -update if the change is intended\ngot:\n%s", path, got)
+	}
+}
+
+func TestRenderEscapesHTMLVariables(t *testing.T) {
+	msg, err := Render(SendRequest{
+		Template:  TemplateSigningOTP,
+		Recipient: "user@example.com",
+		Variables: map[string]string{
+			"code":         "<script>alert(1)</script>",
+			"sign_url":     "javascript:alert(1)",
+			"download_url": `http://localhost/download/abc" onclick="alert(1)`,
+			"view_url":     "http://localhost/view/abc",
+		},
+	})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	for _, unsafe := range []string{"<script>", `href="javascript:`, `" onclick="`} {
+		if strings.Contains(msg.HTMLBody, unsafe) {
+			t.Fatalf("expected %q to be escaped, got:\n%s", unsafe, msg.HTMLBody)
+		}
+	}
+	if !strings.Contains(msg.HTMLBody, "&lt;script&gt;") || !strings.Contains(msg.Body, "<script>alert(1)</script>") {
+		t.Fatalf("expected the code escaped in HTML only, got:\n%s\n%s", msg.HTMLBody, msg.Body)
+	}
+}
+
 func TestRenderSigningOTP(t *testing.T) {
 	msg, err := Render(SendRequest{
 		Template:  TemplateSigningOTP,
@@ -44,6 +121,32 @@ func TestRenderSigningOTPMissingVariable(t *testing.T) {
 	}
 }
 
+func TestRenderSigningReminder(t *testing.T) {
+	msg, err := Render(SendRequest{
+		Template:  TemplateSigningReminder,
+		Recipient: "user@example.com",
+		Variables: map[string]string{
+			"code":         "654321",
+			"sign_url":     "http://localhost/sign.html?token=abc",
+			"download_url": "http://localhost/download/abc",
+			"view_url":     "http://localhost/view/abc",
+			"reminder":     "1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if !strings.Contains(msg.Subject, "Reminder") {
+		t.Fatalf("unexpected subject: %s", msg.Subject)
+	}
+	if !strings.Contains(msg.Body, "654321") {
+		t.Fatal("expected fresh code in reminder body")
+	}
+	if msg.Metadata["reminder"] != "1" {
+		t.Fatalf("unexpected reminder metadata: %q", msg.Metadata["reminder"])
+	}
+}
+
 func TestRenderSignedDocument(t *testing.T) {
 	msg, err := Render(SendRequest{
 		Template:  TemplateSignedDocument,
@@ -136,6 +239,56 @@ func TestBuildSMTPMessage(t *testing.T) {
 	}
 }
 
+func TestBuildSMTPMessageMultipartAlternative(t *testing.T) {
+	from, err := mail.ParseAddress("Signer <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("parse from address: %v", err)
+	}
+	to, err := mail.ParseAddress("user@example.com")
+	if err != nil {
+		t.Fatalf("parse to address: %v", err)
+	}
+
+	raw, err := buildSMTPMessage(from, to, Message{
+		Template: TemplateSignedDocument,
+		Subject:  "Signed document",
+		Body:     "Your signed PDF is ready.\n",
+		HTMLBody: "<p>Your signed PDF is ready.</p>\n",
+	})
+	if err != nil {
+		t.Fatalf("build SMTP message: %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("parse SMTP message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q %v", parsed.Header.Get("Content-Type"), err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{`text/plain; charset="utf-8"`, "Your signed PDF is ready.\r\n"},
+		{`text/html; charset="utf-8"`, "<p>Your signed PDF is ready.</p>\r\n"},
+	} {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		if part.Header.Get("Content-Type") != want.contentType || part.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+			t.Fatalf("unexpected part headers: %v", part.Header)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil || string(body) != want.body {
+			t.Fatalf("expected part body %q, got %q %v", want.body, body, err)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Fatalf("expected exactly two parts, got %v", err)
+	}
+}
+
 func TestBuildSMTPMessageRejectsHeaderInjection(t *testing.T) {
 	from, err := mail.ParseAddress("Signer <no-reply@example.com>")
 	if err != nil {
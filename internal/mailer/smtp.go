@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"mime"
+	"mime/multipart"
 	"mime/quotedprintable"
 	"net"
 	"net/mail"
@@ -210,7 +211,7 @@ func recordSMTPStage(stage, tlsMode string, start time.Time, err error) {
 
 func boundedTemplate(template string) string {
 	switch template {
-	case TemplateSigningOTP, TemplateSignedDocument:
+	case TemplateSigningOTP, TemplateSigningReminder, TemplateSignedDocument:
 		return template
 	default:
 		return "unknown"
@@ -226,13 +227,9 @@ func buildSMTPMessage(from, to *mail.Address, msg Message) ([]byte, error) {
 		return nil, fmt.Errorf("SMTP subject contains a line break")
 	}
 
-	body := &bytes.Buffer{}
-	qpWriter := quotedprintable.NewWriter(body)
-	if _, err := io.WriteString(qpWriter, msg.Body); err != nil {
-		return nil, fmt.Errorf("encode SMTP body: %w", err)
-	}
-	if err := qpWriter.Close(); err != nil {
-		return nil, fmt.Errorf("finish SMTP body encoding: %w", err)
+	body, contentType, err := buildSMTPBody(msg)
+	if err != nil {
+		return nil, err
 	}
 
 	headers := []struct {
@@ -244,10 +241,15 @@ func buildSMTPMessage(from, to *mail.Address, msg Message) ([]byte, error) {
 		{"Subject", mime.QEncoding.Encode("UTF-8", subject)},
 		{"Date", time.Now().UTC().Format(time.RFC1123Z)},
 		{"MIME-Version", "1.0"},
-		{"Content-Type", `text/plain; charset="utf-8"`},
-		{"Content-Transfer-Encoding", "quoted-printable"},
+		{"Content-Type", contentType},
 		{"X-Signer-Template", msg.Template},
 	}
+	if msg.HTMLBody == "" {
+		headers = append(headers, struct {
+			key   string
+			value string
+		}{"Content-Transfer-Encoding", "quoted-printable"})
+	}
 	if msg.MessageID != "" {
 		headers = append(headers, struct {
 			key   string
@@ -268,11 +270,60 @@ func buildSMTPMessage(from, to *mail.Address, msg Message) ([]byte, error) {
 		}
 	}
 	out.WriteString("\r\n")
-	out.Write(body.Bytes())
+	out.Write(body)
 	out.WriteString("\r\n")
 	return out.Bytes(), nil
 }
 
+// buildSMTPBody returns the encoded body and its Content-Type. Messages with
+// an HTML body become multipart/alternative with the plain-text part first,
+// so clients that cannot show HTML fall back to it.
+func buildSMTPBody(msg Message) ([]byte, string, error) {
+	if msg.HTMLBody == "" {
+		body, err := encodeQuotedPrintable(msg.Body)
+		return body, `text/plain; charset="utf-8"`, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{`text/plain; charset="utf-8"`, msg.Body},
+		{`text/html; charset="utf-8"`, msg.HTMLBody},
+	} {
+		encoded, err := encodeQuotedPrintable(part.content)
+		if err != nil {
+			return nil, "", err
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", fmt.Errorf("create SMTP body part: %w", err)
+		}
+		_, _ = partWriter.Write(encoded)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("finish SMTP body parts: %w", err)
+	}
+	return body.Bytes(), mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": writer.Boundary()}), nil
+}
+
+func encodeQuotedPrintable(s string) ([]byte, error) {
+	body := &bytes.Buffer{}
+	qpWriter := quotedprintable.NewWriter(body)
+	if _, err := io.WriteString(qpWriter, s); err != nil {
+		return nil, fmt.Errorf("encode SMTP body: %w", err)
+	}
+	if err := qpWriter.Close(); err != nil {
+		return nil, fmt.Errorf("finish SMTP body encoding: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
 func writeHeader(out *bytes.Buffer, key, value string) error {
 	if strings.ContainsAny(value, "\r\n") {
 		return fmt.Errorf("SMTP header %s contains a line break", key)
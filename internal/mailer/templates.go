@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Each message is a content template rendered inside the shared layout of
+// the same format; the layouts also hold partials such as the document links.
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+type templateData struct {
+	Subject string
+	Vars    map[string]string
+}
+
+type bodyTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var bodies = parseBodyTemplates(TemplateSigningOTP, TemplateSigningReminder, TemplateSignedDocument)
+
+func parseBodyTemplates(names ...string) map[string]bodyTemplates {
+	out := make(map[string]bodyTemplates, len(names))
+	for _, name := range names {
+		out[name] = bodyTemplates{
+			text: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").
+				ParseFS(templateFS, "templates/layout.txt.tmpl", "templates/"+name+".txt.tmpl")),
+			html: htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").
+				ParseFS(templateFS, "templates/layout.html.tmpl", "templates/"+name+".html.tmpl")),
+		}
+	}
+	return out
+}
+
+// renderBodies returns the plain-text and HTML bodies of template. Variables
+// are escaped for their context in the HTML body, so links cannot break out
+// of their attributes.
+func renderBodies(template string, data templateData) (string, string, error) {
+	tmpl, ok := bodies[template]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported template: %s", template)
+	}
+	var text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&text, "layout", data); err != nil {
+		return "", "", fmt.Errorf("render %s text body: %w", template, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return "", "", fmt.Errorf("render %s HTML body: %w", template, err)
+	}
+	return text.String(), html.String(), nil
+}
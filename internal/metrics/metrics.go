@@ -66,10 +66,30 @@ var (
 		Help:    "Generated Redis token TTL in seconds.",
 		Buckets: []float64{3600, 21600, 43200, 82800, 86400, 90000},
 	})
-	RabbitMQPublish = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "signer_rabbitmq_publish_total",
-		Help: "RabbitMQ publish outcomes.",
-	}, []string{"queue", "result"})
+	TaskPublish = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_task_publish_total",
+		Help: "Signing task publish outcomes by task transport.",
+	}, []string{"backend", "queue", "result"})
+	RabbitMQConnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_rabbitmq_connects_total",
+		Help: "RabbitMQ connection attempts, including reconnects.",
+	}, []string{"service", "result"})
+	RabbitMQConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signer_rabbitmq_connected",
+		Help: "Whether the service currently holds a RabbitMQ connection.",
+	}, []string{"service"})
+	OutboxRelay = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_outbox_relay_total",
+		Help: "Upload outbox relay delivery outcomes.",
+	}, []string{"result"})
+	OutboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signer_outbox_pending",
+		Help: "Upload outbox entries not yet confirmed by the broker.",
+	})
+	APIDocumentRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_api_document_requests_total",
+		Help: "API-key document submission outcomes.",
+	}, []string{"result"})
 	VerifyUploadCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_verify_upload_completed_total",
 		Help: "Verify upload completion and metadata creation outcomes.",
@@ -83,10 +103,30 @@ var (
 		Name: "signer_worker_tasks_total",
 		Help: "RabbitMQ task consumption and processing outcomes.",
 	}, []string{"result"})
+	TaskInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "signer_task_in_flight",
+		Help: "Task queue deliveries currently being handled by consumer workers.",
+	}, []string{"service"})
+	TaskRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_task_retries_total",
+		Help: "Signing tasks scheduled onto a delayed retry queue.",
+	}, []string{"delay", "result"})
+	TaskDeadLettered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_task_dead_lettered_total",
+		Help: "Signing tasks moved to the dead-letter queue after exhausting retries.",
+	}, []string{"result"})
+	TaskDLQDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "signer_task_dlq_depth",
+		Help: "Messages waiting in the signer.tasks dead-letter queue or stream.",
+	})
 	OTPSessionsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_otp_sessions_created_total",
 		Help: "PostgreSQL OTP session creation outcomes.",
 	}, []string{"result"})
+	SigningReminders = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_signing_reminders_total",
+		Help: "Signing reminder dispatch outcomes.",
+	}, []string{"result"})
 	MailerNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_mailer_notifications_total",
 		Help: "Signer-side mailer notification dispatch outcomes.",
@@ -118,6 +158,15 @@ var (
 		Help:    "Downstream pdfsigner request latency.",
 		Buckets: longBuckets,
 	}, []string{"operation", "result"})
+	GoPDFSignRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_go_pdf_sign_total",
+		Help: "PDF signing outcomes of the Go signing engine.",
+	}, []string{"result"})
+	GoPDFSignDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "signer_go_pdf_sign_duration_seconds",
+		Help:    "PDF signing latency of the Go signing engine.",
+		Buckets: longBuckets,
+	}, []string{"result"})
 	SignedPDFStore = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_signed_pdf_store_total",
 		Help: "Signed PDF MinIO persistence outcomes.",
@@ -130,15 +179,48 @@ var (
 		Name: "signer_verify_requests_total",
 		Help: "Public verification outcomes.",
 	}, []string{"mode", "status", "service_owned"})
+	VerifyEngineFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_engine_fallbacks_total",
+		Help: "Verifications answered by the Go verifier because pdfsigner failed.",
+	}, []string{"result"})
+	VerifyCrossChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_crosschecks_total",
+		Help: "Comparisons of pdfsigner results with the Go verifier.",
+	}, []string{"result"})
+	VerifyCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_cache_lookups_total",
+		Help: "Verification result cache lookups.",
+	}, []string{"result"})
 	VerifyUploadWaitDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "signer_verify_upload_wait_duration_seconds",
 		Help:    "Tus metadata wait duration for upload verification.",
 		Buckets: durationBuckets,
 	}, []string{"result"})
+	VerifyUploadWakeups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_upload_wakeups_total",
+		Help: "What found the verify upload metadata: the first read, a completion notification, or the fallback recheck.",
+	}, []string{"source"})
 	VerifyCleanup = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_verify_cleanup_total",
 		Help: "Signer cleanup of verify object and sidecar.",
 	}, []string{"target", "result"})
+	VerifyHashLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_hash_lookups_total",
+		Help: "Registry lookups by document hash.",
+	}, []string{"result"})
+	VerifyBatchRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_batch_requests_total",
+		Help: "Batch verification requests by response format.",
+	}, []string{"format", "result"})
+	VerifyBatchItems = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "signer_verify_batch_items",
+		Help:    "Items per accepted batch verification request.",
+		Buckets: []float64{1, 10, 50, 100, 250, 500, 1000},
+	})
+	VerifyReceipts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_verify_receipts_total",
+		Help: "Verification receipts issued and validated.",
+	}, []string{"operation", "result"})
 
 	DownloadRequests = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "signer_download_requests_total",
@@ -158,6 +240,10 @@ var (
 		Help:    "Served file size distribution.",
 		Buckets: byteBuckets,
 	}, []string{"signed"})
+	DownloadAccessLog = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "signer_download_access_log_entries_total",
+		Help: "Download access log entries written, failed or dropped.",
+	}, []string{"result"})
 	SignedLookupMissing = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "signer_signed_lookup_missing_total",
 		Help: "Signed-mode requests where signed_s3_key is absent.",
@@ -330,6 +416,10 @@ func (r *responseRecorder) Flush() {
 	}
 }
 
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := r.ResponseWriter.(http.Hijacker)
 	if !ok {
@@ -0,0 +1,380 @@
+package pdfsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"sort"
+	"time"
+
+	_ "crypto/sha1"
+	_ "crypto/sha512"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAPSS          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     rawContent   `asn1:"optional,tag:0"`
+	CRLs             rawContent   `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        rawContent `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      rawContent `asn1:"optional,tag:1"`
+}
+
+// rawContent keeps an optional context-tagged element undecoded. A plain
+// asn1.RawValue would match whatever element comes next.
+type rawContent struct {
+	Raw asn1.RawContent
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type cmsResult struct {
+	signer       *x509.Certificate
+	certificates []*x509.Certificate
+	signingTime  *time.Time
+}
+
+// verifyDetached checks a detached CMS SignedData over content: the message
+// digest attribute must match content, and the signer certificate's key must
+// verify the signature over the signed attributes. Only the first SignerInfo
+// is considered, as PDF signatures carry exactly one.
+func verifyDetached(der, content []byte) (cmsResult, error) {
+	var result cmsResult
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil || !ci.ContentType.Equal(oidSignedData) {
+		return result, ErrMalformedCMS
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return result, ErrMalformedCMS
+	}
+	if len(sd.EncapContentInfo.EContent.Bytes) > 0 {
+		return result, ErrUnsupportedContent
+	}
+
+	if len(sd.Certificates.Raw) > 0 {
+		var set asn1.RawValue
+		if _, err := asn1.Unmarshal(sd.Certificates.Raw, &set); err != nil {
+			return result, ErrMalformedCMS
+		}
+		certs, err := x509.ParseCertificates(set.Bytes)
+		if err != nil {
+			return result, ErrMalformedCMS
+		}
+		result.certificates = certs
+	}
+	if len(sd.SignerInfos) == 0 {
+		return result, ErrNoSignerInfo
+	}
+	si := sd.SignerInfos[0]
+
+	signer := findSigner(si.SID, result.certificates)
+	if signer == nil {
+		return result, ErrSignerNotFound
+	}
+	result.certificates = signerFirst(signer, result.certificates)
+	result.signer = signer
+
+	hash, ok := digestHash(si.DigestAlgorithm.Algorithm)
+	if !ok || si.SignatureAlgorithm.Algorithm.Equal(oidRSAPSS) {
+		return result, ErrUnsupportedAlgorithm
+	}
+	h := hash.New()
+	h.Write(content)
+	contentDigest := h.Sum(nil)
+
+	signedBytes := content
+	if len(si.SignedAttrs.Raw) > 0 {
+		attrs, err := parseAttributes(si.SignedAttrs.Raw)
+		if err != nil {
+			return result, ErrMalformedCMS
+		}
+		var messageDigest []byte
+		for _, attr := range attrs {
+			switch {
+			case attr.Type.Equal(oidMessageDigest):
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &messageDigest); err != nil {
+					return result, ErrMalformedCMS
+				}
+			case attr.Type.Equal(oidSigningTime):
+				var t time.Time
+				if _, err := asn1.Unmarshal(attr.Value.Bytes, &t); err == nil {
+					t = t.UTC()
+					result.signingTime = &t
+				}
+			}
+		}
+		if !bytes.Equal(messageDigest, contentDigest) {
+			return result, ErrDigestMismatch
+		}
+		// The signature covers the attributes encoded as a SET OF, not with
+		// the [0] IMPLICIT tag they carry inside SignerInfo.
+		signedBytes = append([]byte{0x31}, si.SignedAttrs.Raw[1:]...)
+	}
+
+	if err := checkSignature(signer.PublicKey, hash, signedBytes, si.Signature); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) *x509.Certificate {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert
+			}
+		}
+		return nil
+	}
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil || ias.Serial == nil {
+		return nil
+	}
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(ias.Serial) == 0 && bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) {
+			return cert
+		}
+	}
+	return nil
+}
+
+func signerFirst(signer *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	out := []*x509.Certificate{signer}
+	for _, cert := range certs {
+		if cert != signer {
+			out = append(out, cert)
+		}
+	}
+	return out
+}
+
+func parseAttributes(raw []byte) ([]attribute, error) {
+	var set asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &set); err != nil {
+		return nil, err
+	}
+	var attrs []attribute
+	for rest := set.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func checkSignature(pub any, hash crypto.Hash, signed, signature []byte) error {
+	if key, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(key, signed, signature) {
+			return ErrBadSignature
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(key, hash, digest, signature) != nil {
+			return ErrBadSignature
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return ErrBadSignature
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+	return nil
+}
+
+// essCertIDv2 leaves hashAlgorithm out, which means SHA-256.
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// signCMS returns a detached CMS SignedData over content, signed by certs[0].
+// The signed attributes are the ones PAdES B-B asks for: content type,
+// message digest and a signing-certificate-v2 reference. The signing time
+// lives in the signature dictionary's /M instead.
+func signCMS(key crypto.Signer, certs []*x509.Certificate, content []byte) ([]byte, error) {
+	signer := certs[0]
+	hash, digestOID, sigOID := crypto.SHA256, oidSHA256, oidRSAEncryption
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+	case *ecdsa.PublicKey:
+		sigOID = oidECDSAWithSHA256
+	case ed25519.PublicKey:
+		hash, digestOID, sigOID = crypto.SHA512, oidSHA512, oidEd25519
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	h := hash.New()
+	h.Write(content)
+	certHash := sha256.Sum256(signer.Raw)
+
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidMessageDigest, h.Sum(nil)},
+		{oidSigningCertificateV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	} {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		der, err := asn1.Marshal(attribute{Type: a.oid, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value}})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, der)
+	}
+	// DER orders SET OF members by their encoding.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrBytes := bytes.Join(attrs, nil)
+	signedAttrs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	if err != nil {
+		return nil, err
+	}
+
+	var signature []byte
+	if sigOID.Equal(oidEd25519) {
+		signature, err = key.Sign(rand.Reader, signedAttrs, crypto.Hash(0))
+	} else {
+		h := hash.New()
+		h.Write(signedAttrs)
+		signature, err = key.Sign(rand.Reader, h.Sum(nil), hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	si, err := asn1.Marshal(struct {
+		Version            int
+		SID                issuerAndSerial
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}{
+		Version:            1,
+		SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: signer.RawIssuer}, Serial: signer.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: digestOID},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigOID},
+		Signature:          signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var certBytes []byte
+	for _, cert := range certs {
+		certBytes = append(certBytes, cert.Raw...)
+	}
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo struct{ EContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      []asn1.RawValue `asn1:"set"`
+	}{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: digestOID}},
+		EncapContentInfo: struct{ EContentType asn1.ObjectIdentifier }{oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certBytes},
+		SignerInfos:      []asn1.RawValue{{FullBytes: si}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
@@ -0,0 +1,270 @@
+package pdfsig
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNotPDF             = errors.New("input is not a PDF")
+	ErrByteRange          = errors.New("signature /ByteRange does not match the file")
+	ErrMalformedCMS       = errors.New("malformed CMS signature content")
+	ErrNoSignerInfo       = errors.New("no signer info present")
+	ErrSignerNotFound     = errors.New("signer certificate not found")
+	ErrUnsupportedContent = errors.New("unsupported CMS content")
+	// ErrUnsupportedAlgorithm means the signature may be valid but this
+	// package cannot check it, such as RSA-PSS or an unknown digest.
+	ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+	ErrDigestMismatch       = errors.New("message digest does not match the signed bytes")
+	ErrBadSignature         = errors.New("signature does not verify with the signer certificate")
+)
+
+// Signature is one signature dictionary found in the file, in file order.
+// Signer and Certificates are set whenever the CMS could be read, even when
+// IntegrityValid is false.
+type Signature struct {
+	Index               int
+	ByteRange           []int64
+	CoversWholeDocument bool
+	SigningTime         *time.Time
+	Signer              *x509.Certificate
+	Certificates        []*x509.Certificate
+	IntegrityValid      bool
+	Err                 error
+}
+
+var (
+	byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+	signDatePattern  = regexp.MustCompile(`/M\s*\((D:[^)]*)\)`)
+)
+
+// Verify checks the detached CMS signature of every signature field in pdf,
+// reading it from the gap its /ByteRange leaves for /Contents. Fields are
+// found through the AcroForm; when the cross-reference data is damaged the
+// file is scanned for /ByteRange instead.
+func Verify(pdf []byte) ([]Signature, error) {
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+
+	var found []signatureValue
+	r, err := newReader(pdf)
+	if err == nil {
+		found, err = r.signatureValues()
+	}
+	if err != nil {
+		found = scanSignatureValues(pdf)
+	}
+
+	var out []Signature
+	seen := map[[4]int64]bool{}
+	for _, v := range found {
+		if seen[v.byteRange] {
+			continue
+		}
+		seen[v.byteRange] = true
+
+		br := v.byteRange
+		sig := Signature{Index: len(out), ByteRange: br[:], SigningTime: v.signingTime}
+		sig.CoversWholeDocument = br[0] == 0 && br[2]+br[3] == int64(len(pdf))
+		sig.verify(pdf, br)
+		out = append(out, sig)
+	}
+	return out, nil
+}
+
+// signatureValue is the part of a signature dictionary Verify needs. A
+// /ByteRange entry that is not four integers is kept as -1.
+type signatureValue struct {
+	byteRange   [4]int64
+	signingTime *time.Time
+}
+
+// signatureValues returns the /V dictionary of every signature field in the
+// AcroForm, including fields nested under /Kids, ordered by their /Contents
+// offset so the oldest signature comes first.
+func (r *reader) signatureValues() ([]signatureValue, error) {
+	catalog, ok := r.resolve(r.trailer["Root"]).(pdfDict)
+	if !ok {
+		return nil, errors.New("catalog not found")
+	}
+	form, _ := r.resolve(catalog["AcroForm"]).(pdfDict)
+	fields, _ := r.resolve(form["Fields"]).(pdfArray)
+
+	var out []signatureValue
+	visited := map[pdfRef]bool{}
+	var walk func(fields pdfArray, fieldType any, depth int)
+	walk = func(fields pdfArray, fieldType any, depth int) {
+		if depth > 32 {
+			return
+		}
+		for _, f := range fields {
+			if ref, ok := f.(pdfRef); ok {
+				if visited[ref] {
+					continue
+				}
+				visited[ref] = true
+			}
+			field, ok := r.resolve(f).(pdfDict)
+			if !ok {
+				continue
+			}
+			ft := fieldType
+			if v, ok := field["FT"]; ok {
+				ft = r.resolve(v)
+			}
+			if kids, ok := r.resolve(field["Kids"]).(pdfArray); ok {
+				walk(kids, ft, depth+1)
+			}
+			value, ok := r.resolve(field["V"]).(pdfDict)
+			if ft != pdfName("Sig") || !ok {
+				continue
+			}
+			sv := signatureValue{byteRange: [4]int64{-1, -1, -1, -1}}
+			if br, ok := r.resolve(value["ByteRange"]).(pdfArray); ok && len(br) == 4 {
+				for i := range br {
+					if n, ok := r.resolve(br[i]).(int64); ok {
+						sv.byteRange[i] = n
+					}
+				}
+			}
+			if m, ok := r.resolve(value["M"]).(pdfString); ok {
+				if t, err := ParseDate(string(m)); err == nil {
+					sv.signingTime = &t
+				}
+			}
+			out = append(out, sv)
+		}
+	}
+	walk(fields, nil, 0)
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].byteRange[1] < out[j].byteRange[1] })
+	return out, nil
+}
+
+// scanSignatureValues finds every /ByteRange in the raw bytes, in file order.
+// It is only used when the file cannot be parsed, since it also matches
+// /ByteRange text that is not part of a signature dictionary.
+func scanSignatureValues(pdf []byte) []signatureValue {
+	var out []signatureValue
+	for _, loc := range byteRangePattern.FindAllSubmatchIndex(pdf, -1) {
+		var sv signatureValue
+		for i := range sv.byteRange {
+			n, err := strconv.ParseInt(string(pdf[loc[2+2*i]:loc[3+2*i]]), 10, 64)
+			if err != nil {
+				n = -1
+			}
+			sv.byteRange[i] = n
+		}
+		sv.signingTime = signDate(pdf, loc[0])
+		out = append(out, sv)
+	}
+	return out
+}
+
+func (s *Signature) verify(pdf []byte, br [4]int64) {
+	// Each value is compared with the file size before any arithmetic, so
+	// hostile values cannot overflow past the checks.
+	size := int64(len(pdf))
+	if br[0] != 0 || br[1] <= 0 || br[1] >= size || br[2] <= br[1] || br[2]-br[1] < 2 || br[2] > size ||
+		br[3] < 0 || br[3] > size-br[2] || pdf[br[1]] != '<' || pdf[br[2]-1] != '>' {
+		s.Err = ErrByteRange
+		return
+	}
+	contents, err := hex.DecodeString(string(bytes.Join(bytes.Fields(pdf[br[1]+1:br[2]-1]), nil)))
+	if err != nil {
+		s.Err = ErrMalformedCMS
+		return
+	}
+
+	signed := make([]byte, 0, br[1]+br[3])
+	signed = append(signed, pdf[br[0]:br[0]+br[1]]...)
+	signed = append(signed, pdf[br[2]:br[2]+br[3]]...)
+
+	result, err := verifyDetached(contents, signed)
+	s.Signer = result.signer
+	s.Certificates = result.certificates
+	if s.SigningTime == nil {
+		s.SigningTime = result.signingTime
+	}
+	s.IntegrityValid = err == nil
+	s.Err = err
+}
+
+// signDate reads /M from the object holding the /ByteRange at pos.
+func signDate(pdf []byte, pos int) *time.Time {
+	start := bytes.LastIndex(pdf[:pos], []byte("obj"))
+	if start < 0 {
+		start = 0
+	}
+	end := bytes.Index(pdf[pos:], []byte("endobj"))
+	if end < 0 {
+		end = len(pdf) - pos
+	}
+	m := signDatePattern.FindSubmatch(pdf[start : pos+end])
+	if m == nil {
+		return nil
+	}
+	t, err := ParseDate(string(m[1]))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// ParseDate reads a PDF date string such as D:20260311101530+03'00'. Every
+// field after the year is optional; a missing offset means UTC.
+func ParseDate(value string) (time.Time, error) {
+	s := value
+	if len(s) >= 2 && s[:2] == "D:" {
+		s = s[2:]
+	}
+	fields := []int{0, 1, 1, 0, 0, 0}
+	widths := []int{4, 2, 2, 2, 2, 2}
+	for i, w := range widths {
+		if len(s) < w || !isDigits(s[:w]) {
+			if i == 0 {
+				return time.Time{}, errors.New("invalid PDF date " + strconv.Quote(value))
+			}
+			break
+		}
+		fields[i], _ = strconv.Atoi(s[:w])
+		s = s[w:]
+	}
+
+	loc := time.UTC
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		digits := make([]byte, 0, 4)
+		for i := 1; i < len(s) && len(digits) < 4; i++ {
+			if s[i] >= '0' && s[i] <= '9' {
+				digits = append(digits, s[i])
+			}
+		}
+		for len(digits) < 4 {
+			digits = append(digits, '0')
+		}
+		hours, _ := strconv.Atoi(string(digits[:2]))
+		minutes, _ := strconv.Atoi(string(digits[2:]))
+		offset := hours*3600 + minutes*60
+		if s[0] == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(fields[0], time.Month(fields[1]), fields[2], fields[3], fields[4], fields[5], 0, loc).UTC(), nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
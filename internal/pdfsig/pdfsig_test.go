@@ -0,0 +1,303 @@
+package pdfsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 3, 11, 10, 15, 30, 0, time.UTC)
+
+func newTestSigner(t *testing.T, key crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "user@example.com", Organization: []string{"CryptoSigner Demo"}},
+		NotBefore:             testNow.Add(-time.Hour),
+		NotAfter:              testNow.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+func marshal(t *testing.T, v any) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return der
+}
+
+func testAttribute(t *testing.T, oid asn1.ObjectIdentifier, value any) []byte {
+	return marshal(t, attribute{
+		Type:  oid,
+		Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: marshal(t, value)},
+	})
+}
+
+// testCMS builds a detached SignedData over content the way PDF signers do:
+// SHA-256, signed attributes, and the signer certificate embedded.
+func testCMS(t *testing.T, key crypto.Signer, cert *x509.Certificate, content []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(content)
+	attrs := [][]byte{
+		testAttribute(t, oidContentType, oidData),
+		testAttribute(t, oidSigningTime, testNow),
+		testAttribute(t, oidMessageDigest, digest[:]),
+	}
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrBytes := bytes.Join(attrs, nil)
+
+	signedAttrs := marshal(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+	attrDigest := sha256.Sum256(signedAttrs)
+	var opts crypto.SignerOpts = crypto.SHA256
+	signature, err := key.Sign(rand.Reader, attrDigest[:], opts)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sigAlg := asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		sigAlg = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	}
+
+	si := struct {
+		Version            int
+		SID                issuerAndSerial
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}{
+		Version:            1,
+		SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+		Signature:          signature,
+	}
+	sd := struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo struct{ EContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      []asn1.RawValue `asn1:"set"`
+	}{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: struct{ EContentType asn1.ObjectIdentifier }{oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+		SignerInfos:      []asn1.RawValue{{FullBytes: marshal(t, si)}},
+	}
+	return marshal(t, struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: marshal(t, sd)},
+	})
+}
+
+// testPDF returns a small PDF with one signature dictionary whose /Contents
+// holds a CMS signature over the /ByteRange.
+func testPDF(t *testing.T, key crypto.Signer, cert *x509.Certificate) []byte {
+	t.Helper()
+	const contentsSize = 8192
+	placeholder := "/ByteRange [0 0000000000 0000000000 0000000000]"
+	doc := "%PDF-1.7\n1 0 obj\n<< /Type /Catalog >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /M (D:20260311131530+03'00') " +
+		placeholder + " /Contents <" + strings.Repeat("0", contentsSize) + "> >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n"
+
+	start := strings.Index(doc, "/Contents <") + len("/Contents ")
+	end := start + contentsSize + 2
+	byteRange := fmt.Sprintf("/ByteRange [0 %d %d %d]", start, end, len(doc)-end)
+	doc = strings.Replace(doc, placeholder, byteRange+strings.Repeat(" ", len(placeholder)-len(byteRange)), 1)
+
+	pdf := []byte(doc)
+	signed := append(append([]byte{}, pdf[:start]...), pdf[end:]...)
+	encoded := hex.EncodeToString(testCMS(t, key, cert, signed))
+	if len(encoded) > contentsSize {
+		t.Fatalf("signature too large: %d", len(encoded))
+	}
+	copy(pdf[start+1:], encoded)
+	return pdf
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	for name, key := range map[string]crypto.Signer{"rsa": rsaKey, "ecdsa": ecKey} {
+		t.Run(name, func(t *testing.T) {
+			cert := newTestSigner(t, key)
+			pdf := testPDF(t, key, cert)
+
+			sigs, err := Verify(pdf)
+			if err != nil || len(sigs) != 1 {
+				t.Fatalf("expected one signature, got %d %v", len(sigs), err)
+			}
+			sig := sigs[0]
+			if !sig.IntegrityValid || sig.Err != nil || !sig.CoversWholeDocument {
+				t.Fatalf("expected an intact signature over the whole file, got %+v", sig)
+			}
+			if sig.Signer == nil || sig.Signer.Subject.CommonName != "user@example.com" || len(sig.Certificates) != 1 {
+				t.Fatalf("unexpected signer: %+v", sig)
+			}
+			if sig.SigningTime == nil || !sig.SigningTime.Equal(testNow) {
+				t.Fatalf("expected /M to give the signing time, got %v", sig.SigningTime)
+			}
+
+			sigs, _ = Verify(append(append([]byte{}, pdf...), "\n% appended\n"...))
+			if len(sigs) != 1 || !sigs[0].IntegrityValid || sigs[0].CoversWholeDocument {
+				t.Fatalf("expected appended bytes to leave the signature intact but partial, got %+v", sigs)
+			}
+
+			tampered := append([]byte{}, pdf...)
+			tampered[bytes.Index(tampered, []byte("Catalog"))] = 'K'
+			sigs, _ = Verify(tampered)
+			if len(sigs) != 1 || sigs[0].IntegrityValid || !errors.Is(sigs[0].Err, ErrDigestMismatch) || sigs[0].Signer == nil {
+				t.Fatalf("expected a digest mismatch, got %+v", sigs)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsBrokenSignatures(t *testing.T) {
+	if _, err := Verify([]byte("not a pdf")); !errors.Is(err, ErrNotPDF) {
+		t.Fatalf("expected ErrNotPDF, got %v", err)
+	}
+	if sigs, err := Verify([]byte("%PDF-1.7\n1 0 obj\n<< >>\nendobj\n%%EOF\n")); err != nil || len(sigs) != 0 {
+		t.Fatalf("expected no signatures, got %v %v", sigs, err)
+	}
+
+	pdf := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Sig /ByteRange [0 40 60 9999] /Contents <00> >>\nendobj\n")
+	if sigs, _ := Verify(pdf); len(sigs) != 1 || !errors.Is(sigs[0].Err, ErrByteRange) {
+		t.Fatalf("expected a byte range error, got %+v", sigs)
+	}
+
+	for _, br := range []string{"[0 9223372036854775807 10 0]", "[0 9223372036854775806 9223372036854775807 0]", "[0 40 41 0]"} {
+		pdf := []byte("%PDF-1.7\n1 0 obj\n<< /Type /Sig /ByteRange " + br + " /Contents <00> >>\nendobj\n")
+		if sigs, _ := Verify(pdf); len(sigs) != 1 || !errors.Is(sigs[0].Err, ErrByteRange) {
+			t.Fatalf("%s: expected a byte range error, got %+v", br, sigs)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	pdf = testPDF(t, key, newTestSigner(t, key))
+	start := bytes.Index(pdf, []byte("/Contents <")) + len("/Contents <")
+	copy(pdf[start:], "3000")
+	if sigs, _ := Verify(pdf); len(sigs) != 1 || !errors.Is(sigs[0].Err, ErrMalformedCMS) {
+		t.Fatalf("expected malformed CMS, got %+v", sigs)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for value, want := range map[string]time.Time{
+		"D:20260311131530+03'00'": testNow,
+		"D:20260311101530Z":       testNow,
+		"20260311101530":          testNow,
+		"D:2026031110":            time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC),
+		"D:20260311051530-05'00":  testNow,
+	} {
+		got, err := ParseDate(value)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("ParseDate(%q) = %v %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseDate("D:yesterday"); err == nil {
+		t.Fatal("expected an invalid date to be rejected")
+	}
+}
+
+func TestVerifyReadsSignatureFields(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	// A /ByteRange in page content is text, not a signature.
+	phantom := bytes.Replace(classicPDF(), []byte("BT /F1 12 Tf 72 720 Td (Hi) Tj ET"), []byte("BT  (/ByteRange [0 1 2 3]) Tj  ET"), 1)
+	if sigs, err := Verify(phantom); err != nil || len(sigs) != 0 {
+		t.Fatalf("expected no signatures, got %+v %v", sigs, err)
+	}
+	sigs, err := Verify(signTestPDF(t, phantom, key))
+	if err != nil || len(sigs) != 1 || !sigs[0].IntegrityValid {
+		t.Fatalf("expected only the real signature, got %+v %v", sigs, err)
+	}
+
+	// A signature dictionary compressed into an object stream is still found,
+	// and reported as broken because its /Contents is not in the file bytes.
+	bodies := []string{
+		"<< /Type /Catalog /AcroForm << /Fields [2 0 R] >> >>",
+		"<< /FT /Sig /T (Signature1) /Kids [3 0 R] >>",
+		"<< /Parent 2 0 R /V 4 0 R >>",
+		"<< /Type /Sig /ByteRange [0 10 20 5] /Contents <00> /M (D:20260311101530Z) >>",
+	}
+	var header, body strings.Builder
+	for i, b := range bodies {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(b + " ")
+	}
+	objStm := deflate([]byte(header.String() + body.String()))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	stmOffset := buf.Len()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /ObjStm /N 4 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", header.Len(), len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+	xrefOffset := buf.Len()
+	rows := []byte{
+		0, 0, 0, 255,
+		2, 0, 5, 0,
+		2, 0, 5, 1,
+		2, 0, 5, 2,
+		2, 0, 5, 3,
+		1, byte(stmOffset >> 8), byte(stmOffset), 0,
+		1, byte(xrefOffset >> 8), byte(xrefOffset), 0,
+	}
+	fmt.Fprintf(&buf, "6 0 obj\n<< /Type /XRef /Size 7 /W [1 2 1] /Root 1 0 R /Length %d >>\nstream\n", len(rows))
+	buf.Write(rows)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	sigs, err = Verify(buf.Bytes())
+	if err != nil || len(sigs) != 1 || !errors.Is(sigs[0].Err, ErrByteRange) {
+		t.Fatalf("expected the compressed signature to be reported, got %+v %v", sigs, err)
+	}
+	if sigs[0].ByteRange[3] != 5 || sigs[0].SigningTime == nil || !sigs[0].SigningTime.Equal(testNow) {
+		t.Fatalf("expected the dictionary's byte range and time, got %+v", sigs[0])
+	}
+}
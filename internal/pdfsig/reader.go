@@ -0,0 +1,727 @@
+package pdfsig
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The reader understands just enough of the PDF object model to find the
+// catalog and pages and to copy the objects an incremental update rewrites.
+type (
+	pdfName   string
+	pdfString []byte
+	pdfArray  []any
+	pdfDict   map[pdfName]any
+	pdfRef    struct{ num, gen int }
+	pdfStream struct {
+		dict pdfDict
+		data []byte
+	}
+)
+
+var errEOF = errors.New("unexpected end of PDF data")
+
+type xrefEntry struct {
+	kind   int // 0 free, 1 at offset, 2 inside an object stream
+	offset int64
+	gen    int
+	stream int
+	index  int
+}
+
+type reader struct {
+	data       []byte
+	xref       map[int]xrefEntry
+	trailer    pdfDict
+	startxref  int64
+	xrefStream bool
+	cache      map[int]any
+	objStreams map[int]*objectStream
+}
+
+type objectStream struct {
+	data    []byte
+	offsets map[int]int
+}
+
+func newReader(data []byte) (*reader, error) {
+	r := &reader{
+		data:       data,
+		xref:       map[int]xrefEntry{},
+		cache:      map[int]any{},
+		objStreams: map[int]*objectStream{},
+	}
+	if err := r.loadXref(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *reader) loadXref() error {
+	idx := bytes.LastIndex(r.data, []byte("startxref"))
+	if idx < 0 {
+		return errors.New("startxref not found")
+	}
+	l := &lexer{data: r.data, pos: idx + len("startxref")}
+	v, err := l.object()
+	offset, ok := v.(int64)
+	if err != nil || !ok {
+		return errors.New("startxref has no offset")
+	}
+	r.startxref = offset
+
+	seen := map[int64]bool{}
+	for first := true; ; first = false {
+		if offset <= 0 || offset >= int64(len(r.data)) || seen[offset] {
+			return fmt.Errorf("cross-reference offset %d is invalid", offset)
+		}
+		seen[offset] = true
+		trailer, isStream, err := r.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if first {
+			r.trailer = trailer
+			r.xrefStream = isStream
+		}
+		if stm, ok := trailer["XRefStm"].(int64); ok && !isStream && !seen[stm] {
+			seen[stm] = true
+			if _, _, err := r.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	if _, ok := r.trailer["Root"].(pdfRef); !ok {
+		return errors.New("trailer has no /Root")
+	}
+	return nil
+}
+
+// readXrefSection reads one classic table or cross-reference stream. Entries
+// already known from a newer section win.
+func (r *reader) readXrefSection(offset int64) (pdfDict, bool, error) {
+	l := &lexer{data: r.data, pos: int(offset)}
+	l.skipSpace()
+	if !bytes.HasPrefix(r.data[l.pos:], []byte("xref")) {
+		_, obj, err := r.parseIndirect(offset)
+		if err != nil {
+			return nil, false, fmt.Errorf("read cross-reference stream: %w", err)
+		}
+		stm, ok := obj.(*pdfStream)
+		if !ok || stm.dict["Type"] != pdfName("XRef") {
+			return nil, false, errors.New("cross-reference offset does not point at a table or stream")
+		}
+		return stm.dict, true, r.readXrefStream(stm)
+	}
+
+	l.pos += len("xref")
+	for {
+		l.skipSpace()
+		if bytes.HasPrefix(r.data[l.pos:], []byte("trailer")) {
+			l.pos += len("trailer")
+			obj, err := l.object()
+			if err != nil {
+				return nil, false, fmt.Errorf("read trailer: %w", err)
+			}
+			trailer, ok := obj.(pdfDict)
+			if !ok {
+				return nil, false, errors.New("trailer is not a dictionary")
+			}
+			return trailer, false, nil
+		}
+		start, err1 := l.integer()
+		count, err2 := l.integer()
+		if err1 != nil || err2 != nil {
+			return nil, false, errors.New("malformed cross-reference table")
+		}
+		for i := 0; i < count; i++ {
+			off, err1 := l.integer()
+			gen, err2 := l.integer()
+			l.skipSpace()
+			kind := l.keyword()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, false, errors.New("malformed cross-reference entry")
+			}
+			entry := xrefEntry{gen: gen}
+			if kind == "n" {
+				entry.kind, entry.offset = 1, int64(off)
+			}
+			r.setEntry(start+i, entry)
+		}
+	}
+}
+
+func (r *reader) readXrefStream(stm *pdfStream) error {
+	data, err := r.decodeStream(stm)
+	if err != nil {
+		return err
+	}
+	w, ok := stm.dict["W"].(pdfArray)
+	if !ok || len(w) != 3 {
+		return errors.New("cross-reference stream has no /W")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i := range widths {
+		n, ok := w[i].(int64)
+		if !ok || n < 0 || n > 8 {
+			return errors.New("cross-reference stream has a bad /W")
+		}
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+	size, _ := stm.dict["Size"].(int64)
+	index := pdfArray{int64(0), size}
+	if v, ok := stm.dict["Index"].(pdfArray); ok {
+		index = v
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 {
+			return errors.New("cross-reference stream has a bad /Index")
+		}
+		for n := int64(0); n < count; n++ {
+			if pos+rowLen > len(data) {
+				return errors.New("cross-reference stream is truncated")
+			}
+			var fields [3]int64
+			for f, width := range widths {
+				for b := 0; b < width; b++ {
+					fields[f] = fields[f]<<8 | int64(data[pos])
+					pos++
+				}
+			}
+			if widths[0] == 0 {
+				fields[0] = 1
+			}
+			entry := xrefEntry{kind: int(fields[0])}
+			switch entry.kind {
+			case 1:
+				entry.offset, entry.gen = fields[1], int(fields[2])
+			case 2:
+				entry.stream, entry.index = int(fields[1]), int(fields[2])
+			}
+			r.setEntry(int(start+n), entry)
+		}
+	}
+	return nil
+}
+
+func (r *reader) setEntry(num int, entry xrefEntry) {
+	if _, ok := r.xref[num]; !ok {
+		r.xref[num] = entry
+	}
+}
+
+// size is the next free object number.
+func (r *reader) size() int {
+	size := 0
+	if n, ok := r.trailer["Size"].(int64); ok {
+		size = int(n)
+	}
+	for num := range r.xref {
+		if num >= size {
+			size = num + 1
+		}
+	}
+	return size
+}
+
+func (r *reader) resolve(v any) any {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj, err := r.object(ref.num)
+		if err != nil {
+			return nil
+		}
+		v = obj
+	}
+	return nil
+}
+
+func (r *reader) object(num int) (any, error) {
+	if obj, ok := r.cache[num]; ok {
+		return obj, nil
+	}
+	entry, ok := r.xref[num]
+	var obj any
+	var err error
+	switch {
+	case !ok || entry.kind == 0:
+		return nil, nil
+	case entry.kind == 1:
+		var ref pdfRef
+		ref, obj, err = r.parseIndirect(entry.offset)
+		if err == nil && ref.num != num {
+			err = fmt.Errorf("object %d not found at offset %d", num, entry.offset)
+		}
+	case entry.kind == 2:
+		obj, err = r.objectFromStream(num, entry.stream)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cache[num] = obj
+	return obj, nil
+}
+
+func (r *reader) parseIndirect(offset int64) (pdfRef, any, error) {
+	if offset < 0 || offset >= int64(len(r.data)) {
+		return pdfRef{}, nil, errEOF
+	}
+	l := &lexer{data: r.data, pos: int(offset)}
+	num, err1 := l.integer()
+	gen, err2 := l.integer()
+	l.skipSpace()
+	if err1 != nil || err2 != nil || l.keyword() != "obj" {
+		return pdfRef{}, nil, fmt.Errorf("no object at offset %d", offset)
+	}
+	ref := pdfRef{num, gen}
+	obj, err := l.object()
+	if err != nil {
+		return ref, nil, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return ref, obj, nil
+	}
+	l.skipSpace()
+	if !bytes.HasPrefix(r.data[l.pos:], []byte("stream")) {
+		return ref, obj, nil
+	}
+	l.pos += len("stream")
+	if l.pos < len(r.data) && r.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(r.data) && r.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+	end := -1
+	if length, ok := r.resolve(dict["Length"]).(int64); ok && length >= 0 && int64(start)+length <= int64(len(r.data)) {
+		tail := bytes.TrimLeft(r.data[start+int(length):], " \t\r\n\f\x00")
+		if bytes.HasPrefix(tail, []byte("endstream")) {
+			end = start + int(length)
+		}
+	}
+	if end < 0 {
+		i := bytes.Index(r.data[start:], []byte("endstream"))
+		if i < 0 {
+			return ref, nil, errors.New("stream has no endstream")
+		}
+		end = start + i
+		if end > start && r.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && r.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return ref, &pdfStream{dict: dict, data: r.data[start:end]}, nil
+}
+
+func (r *reader) objectFromStream(num, streamNum int) (any, error) {
+	os, ok := r.objStreams[streamNum]
+	if !ok {
+		obj, err := r.object(streamNum)
+		if err != nil {
+			return nil, err
+		}
+		stm, isStream := obj.(*pdfStream)
+		if !isStream {
+			return nil, fmt.Errorf("object stream %d not found", streamNum)
+		}
+		data, err := r.decodeStream(stm)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := stm.dict["N"].(int64)
+		first, _ := stm.dict["First"].(int64)
+		os = &objectStream{data: data, offsets: map[int]int{}}
+		l := &lexer{data: data}
+		for i := int64(0); i < n; i++ {
+			objNum, err1 := l.integer()
+			off, err2 := l.integer()
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("object stream %d has a bad header", streamNum)
+			}
+			os.offsets[objNum] = int(first) + off
+		}
+		r.objStreams[streamNum] = os
+	}
+	off, ok := os.offsets[num]
+	if !ok || off < 0 || off >= len(os.data) {
+		return nil, fmt.Errorf("object %d not found in object stream %d", num, streamNum)
+	}
+	l := &lexer{data: os.data, pos: off}
+	return l.object()
+}
+
+// decodeStream undoes FlateDecode with optional PNG predictors, which is what
+// cross-reference and object streams use in practice.
+func (r *reader) decodeStream(stm *pdfStream) ([]byte, error) {
+	filter := r.resolve(stm.dict["Filter"])
+	parms, _ := r.resolve(stm.dict["DecodeParms"]).(pdfDict)
+	if filters, ok := filter.(pdfArray); ok {
+		if len(filters) > 1 {
+			return nil, errors.New("stream uses a filter chain")
+		}
+		filter = nil
+		if len(filters) == 1 {
+			filter = r.resolve(filters[0])
+		}
+		if all, ok := r.resolve(stm.dict["DecodeParms"]).(pdfArray); ok && len(all) == 1 {
+			parms, _ = r.resolve(all[0]).(pdfDict)
+		}
+	}
+	switch filter {
+	case nil:
+		return stm.data, nil
+	case pdfName("FlateDecode"):
+	default:
+		return nil, fmt.Errorf("stream filter %v is not supported", filter)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(stm.data))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	predictor, _ := parms["Predictor"].(int64)
+	switch {
+	case predictor <= 1:
+		return data, nil
+	case predictor >= 10:
+		columns, colors, bpc := int64(1), int64(1), int64(8)
+		if v, ok := parms["Columns"].(int64); ok {
+			columns = v
+		}
+		if v, ok := parms["Colors"].(int64); ok {
+			colors = v
+		}
+		if v, ok := parms["BitsPerComponent"].(int64); ok {
+			bpc = v
+		}
+		return unpredictPNG(data, int((colors*bpc*columns+7)/8), int(max(1, colors*bpc/8)))
+	}
+	return nil, fmt.Errorf("predictor %d is not supported", predictor)
+}
+
+func unpredictPNG(data []byte, rowLen, bpp int) ([]byte, error) {
+	if rowLen <= 0 {
+		return nil, errors.New("bad predictor columns")
+	}
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("unknown PNG filter %d", kind)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) keyword() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) integer() (int, error) {
+	l.skipSpace()
+	n, err := strconv.Atoi(l.keyword())
+	return n, err
+}
+
+func (l *lexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errEOF
+	}
+	switch c := l.data[l.pos]; {
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		return l.dictionary()
+	case c == '<':
+		return l.hexString()
+	case c == '(':
+		return l.literalString()
+	case c == '[':
+		return l.array()
+	case c == '/':
+		return l.name(), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number()
+	}
+	start := l.pos
+	switch kw := l.keyword(); kw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", kw, start)
+	}
+}
+
+func (l *lexer) dictionary() (pdfDict, error) {
+	l.pos += 2
+	d := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return d, nil
+		}
+		if l.pos >= len(l.data) || l.data[l.pos] != '/' {
+			return nil, fmt.Errorf("dictionary key expected at offset %d", l.pos)
+		}
+		key := l.name()
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		d[key] = value
+	}
+}
+
+func (l *lexer) array() (pdfArray, error) {
+	l.pos++
+	a := pdfArray{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, errEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return a, nil
+		}
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, value)
+	}
+}
+
+func (l *lexer) name() pdfName {
+	l.pos++
+	raw := l.keyword()
+	if !bytes.Contains([]byte(raw), []byte("#")) {
+		return pdfName(raw)
+	}
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if b, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return pdfName(out)
+}
+
+func (l *lexer) number() (any, error) {
+	start := l.pos
+	token := l.keyword()
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		// "n g R" is a reference; anything else leaves the integer alone.
+		if n >= 0 {
+			save := l.pos
+			if gen, err := l.integer(); err == nil && gen >= 0 {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+					(l.pos+1 == len(l.data) || isSpace(l.data[l.pos+1]) || isDelimiter(l.data[l.pos+1])) {
+					l.pos++
+					return pdfRef{int(n), gen}, nil
+				}
+			}
+			l.pos = save
+		}
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %q at offset %d", token, start)
+	}
+	return f, nil
+}
+
+func (l *lexer) hexString() (pdfString, error) {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil, errEOF
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		b, err := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad hex string at offset %d", l.pos)
+		}
+		out[i] = byte(b)
+	}
+	return out, nil
+}
+
+func (l *lexer) literalString() (pdfString, error) {
+	l.pos++
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, errEOF
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, errEOF
+}
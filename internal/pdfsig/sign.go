@@ -0,0 +1,484 @@
+package pdfsig
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrEncrypted            = errors.New("encrypted PDFs cannot be signed")
+	ErrNoPages              = errors.New("PDF has no pages")
+	ErrSignatureTooLarge    = errors.New("signature does not fit the reserved /Contents space")
+	ErrNoSignerCertificates = errors.New("signer certificate is required")
+)
+
+const defaultContentsSize = 16384
+
+// Options describes the signature dictionary and its visible stamp.
+type Options struct {
+	Name        string
+	Reason      string
+	Location    string
+	SigningTime time.Time
+	// Stamp lines are drawn in a box at the bottom right of the last page.
+	// Without them the signature field is invisible.
+	Stamp []string
+	// ContentsSize is the number of bytes reserved for the CMS signature.
+	ContentsSize int
+}
+
+// rawToken is written to the file as is; Sign uses it for the /ByteRange and
+// /Contents placeholders it patches after the update is laid out.
+type rawToken string
+
+type updateObject struct {
+	ref   pdfRef
+	value any
+}
+
+// Sign appends an incremental update to pdf that adds a signature field on the
+// last page and a PAdES (ETSI.CAdES.detached) signature by key over the
+// /ByteRange. certs[0] must be the certificate for key; the rest are embedded
+// as the chain. The original bytes are left untouched, so earlier signatures
+// stay valid.
+func Sign(pdf []byte, key crypto.Signer, certs []*x509.Certificate, opts Options) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, ErrNoSignerCertificates
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	if opts.ContentsSize <= 0 {
+		opts.ContentsSize = defaultContentsSize
+	}
+	if opts.SigningTime.IsZero() {
+		opts.SigningTime = time.Now()
+	}
+
+	r, err := newReader(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("read pdf: %w", err)
+	}
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+	rootRef := r.trailer["Root"].(pdfRef)
+	catalog, ok := r.resolve(rootRef).(pdfDict)
+	if !ok {
+		return nil, errors.New("read pdf: catalog is not a dictionary")
+	}
+	pageRef, page, err := r.lastPage(catalog)
+	if err != nil {
+		return nil, err
+	}
+
+	next := r.size()
+	var objects []updateObject
+	add := func(value any) pdfRef {
+		ref := pdfRef{num: next}
+		next++
+		objects = append(objects, updateObject{ref, value})
+		return ref
+	}
+	set := func(ref pdfRef, value any) {
+		objects = append(objects, updateObject{ref, value})
+	}
+
+	contentsPlaceholder := "<" + strings.Repeat("0", 2*opts.ContentsSize) + ">"
+	byteRangePlaceholder := "[0 0000000000 0000000000 0000000000]"
+	sigRef := add(pdfDict{
+		"Type":      pdfName("Sig"),
+		"Filter":    pdfName("Adobe.PPKLite"),
+		"SubFilter": pdfName("ETSI.CAdES.detached"),
+		"Name":      pdfString(opts.Name),
+		"Reason":    pdfString(opts.Reason),
+		"Location":  pdfString(opts.Location),
+		"M":         pdfString(opts.SigningTime.UTC().Format("D:20060102150405+00'00'")),
+		"ByteRange": rawToken(byteRangePlaceholder),
+		"Contents":  rawToken(contentsPlaceholder),
+	})
+
+	acroForm, acroFormRef := catalog["AcroForm"], pdfRef{}
+	if ref, ok := acroForm.(pdfRef); ok {
+		acroFormRef = ref
+		acroForm = r.resolve(ref)
+	}
+	form, _ := acroForm.(pdfDict)
+	form = copyDict(form)
+	fields, fieldsRef := form["Fields"], pdfRef{}
+	if ref, ok := fields.(pdfRef); ok {
+		fieldsRef = ref
+		fields = r.resolve(ref)
+	}
+	fieldList, _ := fields.(pdfArray)
+
+	widget := pdfDict{
+		"Type":    pdfName("Annot"),
+		"Subtype": pdfName("Widget"),
+		"FT":      pdfName("Sig"),
+		"T":       pdfString(r.fieldName(fieldList)),
+		"V":       sigRef,
+		"F":       int64(132),
+		"P":       pageRef,
+		"Rect":    pdfArray{int64(0), int64(0), int64(0), int64(0)},
+	}
+	if len(opts.Stamp) > 0 {
+		rect, appearance := stampAppearance(r.pageBox(page), opts.Stamp)
+		widget["Rect"] = rect
+		widget["AP"] = pdfDict{"N": add(appearance)}
+	}
+	widgetRef := add(widget)
+
+	fieldList = append(append(pdfArray{}, fieldList...), widgetRef)
+	if fieldsRef != (pdfRef{}) {
+		set(fieldsRef, fieldList)
+	} else {
+		form["Fields"] = fieldList
+	}
+	form["SigFlags"] = int64(3)
+	switch {
+	case acroFormRef != (pdfRef{}):
+		set(acroFormRef, form)
+	default:
+		catalog = copyDict(catalog)
+		catalog["AcroForm"] = add(form)
+		set(rootRef, catalog)
+	}
+
+	switch annots := page["Annots"].(type) {
+	case pdfRef:
+		list, _ := r.resolve(annots).(pdfArray)
+		set(annots, append(append(pdfArray{}, list...), widgetRef))
+	default:
+		list, _ := annots.(pdfArray)
+		page = copyDict(page)
+		page["Annots"] = append(append(pdfArray{}, list...), widgetRef)
+		set(pageRef, page)
+	}
+
+	out := writeUpdate(r, objects, next, rootRef)
+	return sealSignature(out, key, certs, opts.ContentsSize, contentsPlaceholder, byteRangePlaceholder)
+}
+
+// writeUpdate appends objects and a cross-reference section of the same kind
+// the file already ends with.
+func writeUpdate(r *reader, objects []updateObject, next int, root pdfRef) []byte {
+	var buf bytes.Buffer
+	buf.Write(r.data)
+	if !bytes.HasSuffix(r.data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	offsets := map[pdfRef]int{}
+	for _, obj := range objects {
+		offsets[obj.ref] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", obj.ref.num, obj.ref.gen)
+		writeValue(&buf, obj.value)
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := pdfDict{"Root": root, "Prev": r.startxref}
+	for _, key := range []pdfName{"Info", "ID"} {
+		if v, ok := r.trailer[key]; ok {
+			trailer[key] = v
+		}
+	}
+
+	xrefOffset := buf.Len()
+	if r.xrefStream {
+		xrefRef := pdfRef{num: next}
+		offsets[xrefRef] = xrefOffset
+		refs := sortedRefs(offsets)
+		var index pdfArray
+		var rows []byte
+		for _, group := range contiguous(refs) {
+			index = append(index, int64(group[0].num), int64(len(group)))
+			for _, ref := range group {
+				off := offsets[ref]
+				rows = append(rows, 1, byte(off>>24), byte(off>>16), byte(off>>8), byte(off), byte(ref.gen>>8), byte(ref.gen))
+			}
+		}
+		trailer["Type"] = pdfName("XRef")
+		trailer["Size"] = int64(next + 1)
+		trailer["W"] = pdfArray{int64(1), int64(4), int64(2)}
+		trailer["Index"] = index
+		fmt.Fprintf(&buf, "%d 0 obj\n", xrefRef.num)
+		writeValue(&buf, &pdfStream{dict: trailer, data: rows})
+		buf.WriteString("\nendobj\n")
+	} else {
+		buf.WriteString("xref\n")
+		for _, group := range contiguous(sortedRefs(offsets)) {
+			fmt.Fprintf(&buf, "%d %d\n", group[0].num, len(group))
+			for _, ref := range group {
+				fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[ref], ref.gen)
+			}
+		}
+		trailer["Size"] = int64(next)
+		buf.WriteString("trailer\n")
+		writeValue(&buf, trailer)
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+// sealSignature fills in the /ByteRange of the update's signature dictionary
+// and writes the CMS signature over it into /Contents.
+func sealSignature(out []byte, key crypto.Signer, certs []*x509.Certificate, contentsSize int, contentsPlaceholder, byteRangePlaceholder string) ([]byte, error) {
+	start := bytes.LastIndex(out, []byte(contentsPlaceholder))
+	brPos := bytes.LastIndex(out[:start], []byte(byteRangePlaceholder))
+	end := start + len(contentsPlaceholder)
+
+	byteRange := fmt.Sprintf("[0 %d %d %d]", start, end, len(out)-end)
+	if len(byteRange) > len(byteRangePlaceholder) {
+		return nil, errors.New("PDF is too large to sign")
+	}
+	copy(out[brPos:], byteRange+strings.Repeat(" ", len(byteRangePlaceholder)-len(byteRange)))
+
+	signed := make([]byte, 0, len(out)-len(contentsPlaceholder))
+	signed = append(signed, out[:start]...)
+	signed = append(signed, out[end:]...)
+	der, err := signCMS(key, certs, signed)
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	if len(der) > contentsSize {
+		return nil, ErrSignatureTooLarge
+	}
+	copy(out[start+1:], hex.EncodeToString(der))
+	return out, nil
+}
+
+func (r *reader) lastPage(catalog pdfDict) (pdfRef, pdfDict, error) {
+	node, ok := catalog["Pages"].(pdfRef)
+	for depth := 0; ok && depth < 64; depth++ {
+		d, isDict := r.resolve(node).(pdfDict)
+		if !isDict {
+			break
+		}
+		kids, isPages := r.resolve(d["Kids"]).(pdfArray)
+		if !isPages {
+			if d["Type"] == pdfName("Pages") {
+				break
+			}
+			return node, d, nil
+		}
+		if len(kids) == 0 {
+			break
+		}
+		node, ok = kids[len(kids)-1].(pdfRef)
+	}
+	return pdfRef{}, nil, ErrNoPages
+}
+
+// pageBox returns the visible area of page, honouring inherited attributes.
+func (r *reader) pageBox(page pdfDict) [4]float64 {
+	box := [4]float64{0, 0, 612, 792}
+	for _, key := range []pdfName{"CropBox", "MediaBox"} {
+		node := page
+		for depth := 0; node != nil && depth < 32; depth++ {
+			if rect, ok := r.resolve(node[key]).(pdfArray); ok && len(rect) == 4 {
+				for i := range box {
+					box[i] = number(r.resolve(rect[i]))
+				}
+				return box
+			}
+			node, _ = r.resolve(node["Parent"]).(pdfDict)
+		}
+	}
+	return box
+}
+
+func (r *reader) fieldName(fields pdfArray) string {
+	taken := map[string]bool{}
+	for _, f := range fields {
+		if d, ok := r.resolve(f).(pdfDict); ok {
+			if t, ok := r.resolve(d["T"]).(pdfString); ok {
+				taken[string(t)] = true
+			}
+		}
+	}
+	for i := len(fields) + 1; ; i++ {
+		if name := "Signature" + strconv.Itoa(i); !taken[name] {
+			return name
+		}
+	}
+}
+
+// stampAppearance lays the stamp out at the bottom right of box and returns
+// the widget rectangle and its appearance stream.
+func stampAppearance(box [4]float64, lines []string) (pdfArray, *pdfStream) {
+	const margin, lineHeight = 24.0, 16.0
+	width := min(300, box[2]-box[0]-2*margin)
+	height := lineHeight*float64(len(lines)) + 12
+	x := box[2] - margin - width
+	y := box[1] + margin
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "q\n0.2 0.2 0.2 RG 1 w\n0.5 0.5 %s %s re S\n", formatNumber(width-1), formatNumber(height-1))
+	for i, line := range lines {
+		font := "/Helv 10"
+		if i == 0 {
+			font = "/HelvB 11"
+		}
+		fmt.Fprintf(&content, "BT %s Tf 8 %s Td ", font, formatNumber(height-lineHeight*float64(i+1)))
+		writeValue(&content, pdfString(winAnsi(line)))
+		content.WriteString(" Tj ET\n")
+	}
+	content.WriteString("Q\n")
+
+	font := func(base string) pdfDict {
+		return pdfDict{
+			"Type":     pdfName("Font"),
+			"Subtype":  pdfName("Type1"),
+			"BaseFont": pdfName(base),
+			"Encoding": pdfName("WinAnsiEncoding"),
+		}
+	}
+	return pdfArray{x, y, x + width, y + height}, &pdfStream{
+		dict: pdfDict{
+			"Type":      pdfName("XObject"),
+			"Subtype":   pdfName("Form"),
+			"BBox":      pdfArray{int64(0), int64(0), width, height},
+			"Resources": pdfDict{"Font": pdfDict{"Helv": font("Helvetica"), "HelvB": font("Helvetica-Bold")}},
+		},
+		data: content.Bytes(),
+	}
+}
+
+// winAnsi keeps the stamp within the standard fonts' encoding.
+func winAnsi(s string) string {
+	out := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e {
+			c = '?'
+		}
+		out = append(out, byte(c))
+	}
+	return string(out)
+}
+
+func number(v any) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func copyDict(d pdfDict) pdfDict {
+	out := make(pdfDict, len(d)+1)
+	for k, v := range d {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedRefs(offsets map[pdfRef]int) []pdfRef {
+	refs := make([]pdfRef, 0, len(offsets))
+	for ref := range offsets {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].num < refs[j].num })
+	return refs
+}
+
+func contiguous(refs []pdfRef) [][]pdfRef {
+	var groups [][]pdfRef
+	for i, ref := range refs {
+		if i == 0 || ref.num != refs[i-1].num+1 {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], ref)
+	}
+	return groups
+}
+
+func writeValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(formatNumber(v))
+	case rawToken:
+		buf.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(buf, "%d %d R", v.num, v.gen)
+	case pdfName:
+		writeName(buf, v)
+	case pdfString:
+		buf.WriteByte('(')
+		for _, c := range v {
+			switch {
+			case c == '(' || c == ')' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c < 0x20 || c > 0x7e:
+				fmt.Fprintf(buf, "\\%03o", c)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte(')')
+	case pdfArray:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeValue(buf, item)
+		}
+		buf.WriteByte(']')
+	case pdfDict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			buf.WriteByte(' ')
+			writeName(buf, pdfName(k))
+			buf.WriteByte(' ')
+			writeValue(buf, v[pdfName(k)])
+		}
+		buf.WriteString(" >>")
+	case *pdfStream:
+		d := copyDict(v.dict)
+		d["Length"] = int64(len(v.data))
+		writeValue(buf, d)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.data)
+		buf.WriteString("\nendstream")
+	}
+}
+
+func writeName(buf *bytes.Buffer, n pdfName) {
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c <= 0x20 || c >= 0x7f || c == '#' || isDelimiter(c) {
+			fmt.Fprintf(buf, "#%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
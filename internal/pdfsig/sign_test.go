@@ -0,0 +1,238 @@
+package pdfsig
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// classicPDF is a two-page document with a classic cross-reference table.
+func classicPDF() []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 595 842] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R /Annots [] >>",
+		"<< /Length 33 >>\nstream\nBT /F1 12 Tf 72 720 Td (Hi) Tj ET\nendstream",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f\r\n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n\r\n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /ID [<01> <01>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// xrefStreamPDF keeps its catalog and pages in an object stream and indexes
+// them with a PNG-predicted cross-reference stream, as most modern writers do.
+func xrefStreamPDF() []byte {
+	bodies := []string{
+		"<< /Type /Catalog /Pages 2 0 R /AcroForm << /Fields [] >> >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Annots 6 0 R >>",
+	}
+	var header, body strings.Builder
+	for i, b := range bodies {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(b + " ")
+	}
+	objStm := deflate([]byte(header.String() + body.String()))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	stmOffset := buf.Len()
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", header.Len(), len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+	annotsOffset := buf.Len()
+	buf.WriteString("6 0 obj\n[]\nendobj\n")
+
+	xrefOffset := buf.Len()
+	rows := [][]byte{
+		{0, 0, 0, 255},
+		{2, 0, 4, 0},
+		{2, 0, 4, 1},
+		{2, 0, 4, 2},
+		{1, byte(stmOffset >> 8), byte(stmOffset), 0},
+		{1, byte(xrefOffset >> 8), byte(xrefOffset), 0},
+		{1, byte(annotsOffset >> 8), byte(annotsOffset), 0},
+	}
+	var predicted []byte
+	prev := make([]byte, 4)
+	for _, row := range rows {
+		predicted = append(predicted, 2)
+		for i := range row {
+			predicted = append(predicted, row[i]-prev[i])
+		}
+		prev = row
+	}
+	data := deflate(predicted)
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /XRef /Size 7 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Columns 4 /Predictor 12 >> /Length %d >>\nstream\n", len(data))
+	buf.Write(data)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return buf.Bytes()
+}
+
+func signTestPDF(t *testing.T, pdf []byte, key crypto.Signer, stamp ...string) []byte {
+	t.Helper()
+	signed, err := Sign(pdf, key, []*x509.Certificate{newTestSigner(t, key)}, Options{
+		Name:        "user@example.com",
+		Reason:      "Document signed",
+		SigningTime: testNow,
+		Stamp:       stamp,
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if !bytes.HasPrefix(signed, pdf) {
+		t.Fatal("expected an incremental update that keeps the original bytes")
+	}
+	return signed
+}
+
+func TestSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		pdf []byte
+		key crypto.Signer
+	}{
+		"classic xref rsa":    {classicPDF(), rsaKey},
+		"classic xref ec":     {classicPDF(), ecKey},
+		"xref stream rsa":     {xrefStreamPDF(), rsaKey},
+		"xref stream ed25519": {xrefStreamPDF(), edKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signed := signTestPDF(t, tc.pdf, tc.key, "Digitally signed", "Email: user@example.com")
+
+			sigs, err := Verify(signed)
+			if err != nil || len(sigs) != 1 {
+				t.Fatalf("expected one signature, got %d %v", len(sigs), err)
+			}
+			if !sigs[0].IntegrityValid || !sigs[0].CoversWholeDocument || !sigs[0].SigningTime.Equal(testNow) {
+				t.Fatalf("expected a valid signature over the whole file, got %+v", sigs[0])
+			}
+
+			r, err := newReader(signed)
+			if err != nil {
+				t.Fatalf("signed PDF does not parse: %v", err)
+			}
+			catalog := r.resolve(r.trailer["Root"]).(pdfDict)
+			form, _ := r.resolve(catalog["AcroForm"]).(pdfDict)
+			fields, _ := r.resolve(form["Fields"]).(pdfArray)
+			if len(fields) != 1 || form["SigFlags"] != int64(3) {
+				t.Fatalf("expected one signature field, got %v", form)
+			}
+			widget, _ := r.resolve(fields[0]).(pdfDict)
+			_, page, err := r.lastPage(catalog)
+			if err != nil {
+				t.Fatalf("last page: %v", err)
+			}
+			annots, _ := r.resolve(page["Annots"]).(pdfArray)
+			if widget["FT"] != pdfName("Sig") || len(annots) != 1 || annots[0] != fields[0] {
+				t.Fatalf("expected the widget on the last page, got field %v annots %v", widget, annots)
+			}
+			sigDict, _ := r.resolve(widget["V"]).(pdfDict)
+			if sigDict["SubFilter"] != pdfName("ETSI.CAdES.detached") {
+				t.Fatalf("unexpected signature dictionary %v", sigDict)
+			}
+			if ap, _ := widget["AP"].(pdfDict); ap == nil {
+				t.Fatal("expected a visible stamp appearance")
+			}
+		})
+	}
+}
+
+func TestSignTwice(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	for name, pdf := range map[string][]byte{"classic xref": classicPDF(), "xref stream": xrefStreamPDF()} {
+		t.Run(name, func(t *testing.T) {
+			signed := signTestPDF(t, signTestPDF(t, pdf, key), key)
+
+			sigs, err := Verify(signed)
+			if err != nil || len(sigs) != 2 {
+				t.Fatalf("expected two signatures, got %d %v", len(sigs), err)
+			}
+			if !sigs[0].IntegrityValid || sigs[0].CoversWholeDocument || !sigs[1].IntegrityValid || !sigs[1].CoversWholeDocument {
+				t.Fatalf("expected the first signature to stay valid under the second, got %+v", sigs)
+			}
+
+			r, err := newReader(signed)
+			if err != nil {
+				t.Fatalf("signed PDF does not parse: %v", err)
+			}
+			form, _ := r.resolve(r.resolve(r.trailer["Root"]).(pdfDict)["AcroForm"]).(pdfDict)
+			fields, _ := r.resolve(form["Fields"]).(pdfArray)
+			if len(fields) != 2 {
+				t.Fatalf("expected two fields, got %v", fields)
+			}
+			first, _ := r.resolve(fields[0]).(pdfDict)
+			second, _ := r.resolve(fields[1]).(pdfDict)
+			if string(first["T"].(pdfString)) == string(second["T"].(pdfString)) {
+				t.Fatalf("expected unique field names, got %q twice", first["T"])
+			}
+		})
+	}
+}
+
+func TestSignRejectsUnsupportedInput(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	certs := []*x509.Certificate{newTestSigner(t, key)}
+
+	if _, err := Sign([]byte("not a pdf"), key, certs, Options{}); !errors.Is(err, ErrNotPDF) {
+		t.Fatalf("expected ErrNotPDF, got %v", err)
+	}
+	encrypted := bytes.Replace(classicPDF(), []byte("/Root 1 0 R"), []byte("/Root 1 0 R /Encrypt 9 0 R"), 1)
+	if _, err := Sign(encrypted, key, certs, Options{}); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+	if _, err := Sign(classicPDF(), key, certs, Options{ContentsSize: 16}); !errors.Is(err, ErrSignatureTooLarge) {
+		t.Fatalf("expected ErrSignatureTooLarge, got %v", err)
+	}
+	if _, err := Sign(classicPDF(), key, nil, Options{}); !errors.Is(err, ErrNoSignerCertificates) {
+		t.Fatalf("expected ErrNoSignerCertificates, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testRetryDelays = []time.Duration{200 * time.Millisecond}
+
+type queueFactory func(t *testing.T, name string) Queue
+
+type consumed struct {
+	body     string
+	attempts int
+}
+
+func runConformance(t *testing.T, newQueue queueFactory) {
+	t.Run("PublishConsumeAck", func(t *testing.T) {
+		q := newQueue(t, "signer.test."+uuid.NewString())
+		got := startConsumer(t, q, 1, func(Delivery) Action { return Ack })
+
+		publish(t, q, `{"n":1}`)
+		d := expectDelivery(t, got)
+		if d.body != `{"n":1}` || d.attempts != 0 {
+			t.Fatalf("unexpected delivery: %+v", d)
+		}
+		expectNoDelivery(t, got, 500*time.Millisecond)
+	})
+
+	t.Run("RejectDrops", func(t *testing.T) {
+		q := newQueue(t, "signer.test."+uuid.NewString())
+		got := startConsumer(t, q, 3, func(Delivery) Action { return Reject })
+
+		publish(t, q, `{"n":2}`)
+		expectDelivery(t, got)
+		expectNoDelivery(t, got, time.Second)
+		expectDeadLetterDepth(t, q, 0)
+	})
+
+	t.Run("RetryRedeliversWithAttempts", func(t *testing.T) {
+		q := newQueue(t, "signer.test."+uuid.NewString())
+		got := startConsumer(t, q, 3, func(d Delivery) Action {
+			if d.Attempts == 0 {
+				return Retry
+			}
+			return Ack
+		})
+
+		publish(t, q, `{"n":3}`)
+		if d := expectDelivery(t, got); d.attempts != 0 {
+			t.Fatalf("expected first attempt, got %+v", d)
+		}
+		if d := expectDelivery(t, got); d.body != `{"n":3}` || d.attempts != 1 {
+			t.Fatalf("expected redelivery with one attempt, got %+v", d)
+		}
+		expectNoDelivery(t, got, time.Second)
+	})
+
+	t.Run("DeadLettersAfterMaxAttempts", func(t *testing.T) {
+		q := newQueue(t, "signer.test."+uuid.NewString())
+		got := startConsumer(t, q, 2, func(Delivery) Action { return Retry })
+
+		publish(t, q, `{"n":4}`)
+		expectDelivery(t, got)
+		expectDelivery(t, got)
+		expectNoDelivery(t, got, time.Second)
+		expectDeadLetterDepth(t, q, 1)
+	})
+
+	t.Run("ListAndReplayDeadLetters", func(t *testing.T) {
+		q := newQueue(t, "signer.test."+uuid.NewString())
+		var calls atomic.Int32
+		got := startConsumer(t, q, 1, func(Delivery) Action {
+			if calls.Add(1) == 1 {
+				return Retry
+			}
+			return Ack
+		})
+
+		publish(t, q, `{"n":5}`)
+		expectDelivery(t, got)
+		expectDeadLetterDepth(t, q, 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		letters, err := q.DeadLetters(ctx, 10)
+		if err != nil {
+			t.Fatalf("list dead letters: %v", err)
+		}
+		if len(letters) != 1 || string(letters[0].Body) != `{"n":5}` || letters[0].Attempts != 1 || letters[0].DeadLetteredAt == "" {
+			t.Fatalf("unexpected dead letters: %+v", letters)
+		}
+		expectDeadLetterDepth(t, q, 1)
+
+		replayed, err := q.ReplayDeadLetters(ctx, 10)
+		if err != nil || replayed != 1 {
+			t.Fatalf("replay: %d, %v", replayed, err)
+		}
+		if d := expectDelivery(t, got); d.body != `{"n":5}` || d.attempts != 0 {
+			t.Fatalf("unexpected replayed delivery: %+v", d)
+		}
+		expectDeadLetterDepth(t, q, 0)
+	})
+}
+
+func startConsumer(t *testing.T, q Queue, maxAttempts int, decide func(Delivery) Action) <-chan consumed {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan consumed, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := q.Consume(ctx, ConsumeOptions{Workers: 2, Prefetch: 4, MaxAttempts: maxAttempts, SettleTimeout: 5 * time.Second}, func(_ context.Context, d Delivery) Action {
+			got <- consumed{body: string(d.Body), attempts: d.Attempts}
+			return decide(d)
+		})
+		if err != nil {
+			t.Errorf("consume: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Error("consumer did not stop")
+		}
+	})
+	return got
+}
+
+func publish(t *testing.T, q Queue, body string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Publish(ctx, []byte(body)); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+func expectDelivery(t *testing.T, got <-chan consumed) consumed {
+	t.Helper()
+	select {
+	case d := <-got:
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return consumed{}
+	}
+}
+
+func expectNoDelivery(t *testing.T, got <-chan consumed, wait time.Duration) {
+	t.Helper()
+	select {
+	case d := <-got:
+		t.Fatalf("unexpected delivery: %+v", d)
+	case <-time.After(wait):
+	}
+}
+
+func expectDeadLetterDepth(t *testing.T, q Queue, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		depth, err := q.DeadLetterDepth(ctx)
+		cancel()
+		if err == nil && depth == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected dead-letter depth %d, got %d (err=%v)", want, depth, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
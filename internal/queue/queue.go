@@ -0,0 +1,210 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yarlKot1904/signer/internal/config"
+	"github.com/yarlKot1904/signer/internal/infra"
+	appmetrics "github.com/yarlKot1904/signer/internal/metrics"
+)
+
+const (
+	SignerTasks = "signer.tasks"
+
+	BackendRabbitMQ = "rabbitmq"
+	BackendRedis    = "redis"
+
+	defaultSettleTimeout = 30 * time.Second
+)
+
+var DefaultRetryDelays = []time.Duration{
+	10 * time.Second,
+	20 * time.Second,
+	40 * time.Second,
+	80 * time.Second,
+	160 * time.Second,
+	320 * time.Second,
+	640 * time.Second,
+	1280 * time.Second,
+}
+
+type Action int
+
+const (
+	Ack Action = iota
+	Reject
+	Retry
+)
+
+type Delivery struct {
+	Body     []byte
+	Attempts int
+}
+
+type DeadLetter struct {
+	ID             string
+	Body           []byte
+	Attempts       int
+	DeadLetteredAt string
+}
+
+type Handler func(ctx context.Context, d Delivery) Action
+
+type ConsumeOptions struct {
+	Workers       int
+	Prefetch      int
+	MaxAttempts   int
+	SettleTimeout time.Duration
+}
+
+type Queue interface {
+	Name() string
+	Backend() string
+	Publish(ctx context.Context, body []byte) error
+	Consume(ctx context.Context, opts ConsumeOptions, handler Handler) error
+	DeadLetterDepth(ctx context.Context) (int, error)
+	DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, limit int) (int, error)
+	Close() error
+}
+
+type settler interface {
+	ack(ctx context.Context) error
+	reject(ctx context.Context) error
+	retry(ctx context.Context, attempts int, delay time.Duration) error
+	deadLetter(ctx context.Context, attempts int) error
+	requeue(ctx context.Context) error
+}
+
+func New(ctx context.Context, service string, cfg *config.Config, rdb *redis.Client) (Queue, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.TaskQueueBackend)) {
+	case "", BackendRabbitMQ:
+		if cfg.RabbitURL == "" {
+			return nil, fmt.Errorf("RABBIT_URL is required for the %s task queue", BackendRabbitMQ)
+		}
+		conn, err := infra.NewRabbitMQ(ctx, service, cfg.RabbitURL, RabbitTopology(SignerTasks, DefaultRetryDelays))
+		if err != nil {
+			return nil, err
+		}
+		return NewRabbitMQ(conn, service, SignerTasks, DefaultRetryDelays), nil
+	case BackendRedis:
+		if rdb == nil {
+			return nil, fmt.Errorf("redis client is required for the %s task queue", BackendRedis)
+		}
+		return NewRedisStreams(rdb, service, SignerTasks, DefaultRetryDelays, cfg.TaskClaimIdle), nil
+	default:
+		return nil, fmt.Errorf("unknown TASK_QUEUE_BACKEND %q", cfg.TaskQueueBackend)
+	}
+}
+
+func DeadLetterName(name string) string {
+	return name + ".dlq"
+}
+
+func retryDelay(delays []time.Duration, attempt int) time.Duration {
+	idx := attempt - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(delays) {
+		idx = len(delays) - 1
+	}
+	return delays[idx]
+}
+
+func normalizeOptions(opts ConsumeOptions) ConsumeOptions {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Prefetch < opts.Workers {
+		opts.Prefetch = opts.Workers
+	}
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.SettleTimeout <= 0 {
+		opts.SettleTimeout = defaultSettleTimeout
+	}
+	return opts
+}
+
+func handle(ctx context.Context, name, service string, delays []time.Duration, opts ConsumeOptions, d Delivery, s settler, handler Handler) {
+	appmetrics.TaskInFlight.WithLabelValues(service).Inc()
+	defer appmetrics.TaskInFlight.WithLabelValues(service).Dec()
+
+	baseCtx := context.WithoutCancel(ctx)
+	action := handler(baseCtx, d)
+
+	settleCtx, cancel := context.WithTimeout(baseCtx, opts.SettleTimeout)
+	defer cancel()
+
+	var err error
+	switch action {
+	case Ack:
+		err = s.ack(settleCtx)
+	case Reject:
+		err = s.reject(settleCtx)
+	case Retry:
+		attempts := d.Attempts + 1
+		if attempts >= opts.MaxAttempts {
+			err = s.deadLetter(settleCtx, attempts)
+			appmetrics.TaskDeadLettered.WithLabelValues(appmetrics.ResultFromErr(err)).Inc()
+			if err == nil {
+				log.Printf("Task moved to %s after %d attempts", DeadLetterName(name), attempts)
+			}
+		} else {
+			delay := retryDelay(delays, attempts)
+			err = s.retry(settleCtx, attempts, delay)
+			appmetrics.TaskRetries.WithLabelValues(delay.String(), appmetrics.ResultFromErr(err)).Inc()
+			if err == nil {
+				log.Printf("Task on %s scheduled for retry in %s (attempt %d of %d)", name, delay, attempts, opts.MaxAttempts)
+			}
+		}
+		if err != nil {
+			log.Printf("Task retry on %s failed, requeueing: %v", name, err)
+			err = s.requeue(settleCtx)
+		}
+	}
+	if err != nil {
+		log.Printf("Task settle on %s failed: %v", name, err)
+	}
+}
+
+type workerPool struct {
+	jobs chan func()
+	wg   sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{jobs: make(chan func())}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+func (p *workerPool) submit(ctx context.Context, job func()) bool {
+	select {
+	case p.jobs <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *workerPool) stop() {
+	close(p.jobs)
+	p.wg.Wait()
+}
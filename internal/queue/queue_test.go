@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeSettler struct {
+	calls    []string
+	attempts int
+	delay    time.Duration
+	retryErr error
+}
+
+func (s *fakeSettler) ack(context.Context) error {
+	s.calls = append(s.calls, "ack")
+	return nil
+}
+
+func (s *fakeSettler) reject(context.Context) error {
+	s.calls = append(s.calls, "reject")
+	return nil
+}
+
+func (s *fakeSettler) requeue(context.Context) error {
+	s.calls = append(s.calls, "requeue")
+	return nil
+}
+
+func (s *fakeSettler) retry(_ context.Context, attempts int, delay time.Duration) error {
+	s.calls = append(s.calls, "retry")
+	s.attempts, s.delay = attempts, delay
+	return s.retryErr
+}
+
+func (s *fakeSettler) deadLetter(_ context.Context, attempts int) error {
+	s.calls = append(s.calls, "dead_letter")
+	s.attempts = attempts
+	return nil
+}
+
+func TestHandleSettlesByAction(t *testing.T) {
+	delays := []time.Duration{time.Second, 2 * time.Second}
+	opts := normalizeOptions(ConsumeOptions{MaxAttempts: 3})
+
+	cases := []struct {
+		name     string
+		action   Action
+		attempts int
+		retryErr error
+		calls    string
+		delay    time.Duration
+	}{
+		{name: "ack", action: Ack, calls: "ack"},
+		{name: "reject", action: Reject, calls: "reject"},
+		{name: "first retry", action: Retry, attempts: 0, calls: "retry", delay: time.Second},
+		{name: "second retry", action: Retry, attempts: 1, calls: "retry", delay: 2 * time.Second},
+		{name: "exhausted", action: Retry, attempts: 2, calls: "dead_letter"},
+		{name: "retry publish fails", action: Retry, retryErr: errors.New("down"), calls: "retry,requeue", delay: time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &fakeSettler{retryErr: tc.retryErr}
+			handle(context.Background(), "q", "test", delays, opts, Delivery{Attempts: tc.attempts}, s, func(context.Context, Delivery) Action {
+				return tc.action
+			})
+			calls := ""
+			for i, c := range s.calls {
+				if i > 0 {
+					calls += ","
+				}
+				calls += c
+			}
+			if calls != tc.calls {
+				t.Fatalf("expected %s, got %s", tc.calls, calls)
+			}
+			if tc.delay != 0 && s.delay != tc.delay {
+				t.Fatalf("expected delay %s, got %s", tc.delay, s.delay)
+			}
+		})
+	}
+}
+
+func TestHandlerContextSurvivesShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := &fakeSettler{}
+	handle(ctx, "q", "test", DefaultRetryDelays, normalizeOptions(ConsumeOptions{}), Delivery{}, s, func(ctx context.Context, _ Delivery) Action {
+		if ctx.Err() != nil {
+			t.Fatalf("handler context cancelled: %v", ctx.Err())
+		}
+		return Ack
+	})
+}
+
+func TestRetryDelay(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 10 * time.Second},
+		{attempt: 1, want: 10 * time.Second},
+		{attempt: 3, want: 40 * time.Second},
+		{attempt: 50, want: 1280 * time.Second},
+	}
+	for _, tc := range cases {
+		if got := retryDelay(DefaultRetryDelays, tc.attempt); got != tc.want {
+			t.Fatalf("attempt %d: got %s, want %s", tc.attempt, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/yarlKot1904/signer/internal/infra"
+)
+
+const (
+	AttemptsHeader     = "x-signer-attempts"
+	DeadLetteredHeader = "x-signer-dead-lettered-at"
+)
+
+type RabbitMQ struct {
+	conn    *infra.RabbitMQ
+	service string
+	name    string
+	delays  []time.Duration
+}
+
+func NewRabbitMQ(conn *infra.RabbitMQ, service, name string, retryDelays []time.Duration) *RabbitMQ {
+	return &RabbitMQ{conn: conn, service: service, name: name, delays: retryDelays}
+}
+
+func RabbitTopology(name string, retryDelays []time.Duration) infra.RabbitTopology {
+	return func(ch *amqp.Channel) error {
+		if _, err := ch.QueueDeclare(name, true, false, false, false, nil); err != nil {
+			return err
+		}
+		if _, err := ch.QueueDeclare(DeadLetterName(name), true, false, false, false, nil); err != nil {
+			return err
+		}
+		for _, delay := range retryDelays {
+			_, err := ch.QueueDeclare(rabbitRetryQueue(name, delay), true, false, false, false, amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": name,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (q *RabbitMQ) Name() string {
+	return q.name
+}
+
+func (q *RabbitMQ) Backend() string {
+	return BackendRabbitMQ
+}
+
+func (q *RabbitMQ) Publish(ctx context.Context, body []byte) error {
+	return q.conn.Publish(ctx, "", q.name, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+func (q *RabbitMQ) Consume(ctx context.Context, opts ConsumeOptions, handler Handler) error {
+	opts = normalizeOptions(opts)
+	return q.conn.Consume(ctx, q.name, infra.ConsumeOptions{Prefetch: opts.Prefetch, Workers: opts.Workers}, func(delivery amqp.Delivery) {
+		d := Delivery{Body: delivery.Body, Attempts: rabbitAttempts(delivery.Headers)}
+		handle(ctx, q.name, q.service, q.delays, opts, d, &rabbitSettler{q: q, delivery: delivery}, handler)
+	})
+}
+
+func (q *RabbitMQ) DeadLetterDepth(ctx context.Context) (int, error) {
+	return q.conn.QueueDepth(ctx, DeadLetterName(q.name))
+}
+
+func (q *RabbitMQ) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := q.conn.WithChannel(ctx, func(ch *amqp.Channel) error {
+		var lastTag uint64
+		for len(letters) < limit {
+			msg, ok, err := ch.Get(DeadLetterName(q.name), false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			lastTag = msg.DeliveryTag
+			letters = append(letters, rabbitDeadLetter(msg, len(letters)+1))
+		}
+		if lastTag == 0 {
+			return nil
+		}
+		return ch.Nack(lastTag, true, true)
+	})
+	return letters, err
+}
+
+func (q *RabbitMQ) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	replayed := 0
+	err := q.conn.WithChannel(ctx, func(ch *amqp.Channel) error {
+		for replayed < limit {
+			msg, ok, err := ch.Get(DeadLetterName(q.name), false)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+
+			headers := amqp.Table{}
+			for k, v := range msg.Headers {
+				if k != AttemptsHeader && k != DeadLetteredHeader {
+					headers[k] = v
+				}
+			}
+			err = q.conn.Publish(ctx, "", q.name, amqp.Publishing{
+				ContentType:  msg.ContentType,
+				DeliveryMode: amqp.Persistent,
+				Headers:      headers,
+				Body:         msg.Body,
+			})
+			if err != nil {
+				_ = msg.Nack(false, true)
+				return err
+			}
+			if err := msg.Ack(false); err != nil {
+				return err
+			}
+			replayed++
+		}
+		return nil
+	})
+	return replayed, err
+}
+
+func (q *RabbitMQ) Close() error {
+	return q.conn.Close()
+}
+
+type rabbitSettler struct {
+	q        *RabbitMQ
+	delivery amqp.Delivery
+}
+
+func (s *rabbitSettler) ack(context.Context) error {
+	return s.delivery.Ack(false)
+}
+
+func (s *rabbitSettler) reject(context.Context) error {
+	return s.delivery.Reject(false)
+}
+
+func (s *rabbitSettler) requeue(context.Context) error {
+	return s.delivery.Nack(false, true)
+}
+
+func (s *rabbitSettler) retry(ctx context.Context, attempts int, delay time.Duration) error {
+	if err := s.q.conn.Publish(ctx, "", rabbitRetryQueue(s.q.name, delay), s.republish(attempts, nil)); err != nil {
+		return err
+	}
+	return s.delivery.Ack(false)
+}
+
+func (s *rabbitSettler) deadLetter(ctx context.Context, attempts int) error {
+	extra := amqp.Table{DeadLetteredHeader: time.Now().UTC().Format(time.RFC3339)}
+	if err := s.q.conn.Publish(ctx, "", DeadLetterName(s.q.name), s.republish(attempts, extra)); err != nil {
+		return err
+	}
+	return s.delivery.Ack(false)
+}
+
+func (s *rabbitSettler) republish(attempts int, extra amqp.Table) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range s.delivery.Headers {
+		headers[k] = v
+	}
+	for k, v := range extra {
+		headers[k] = v
+	}
+	headers[AttemptsHeader] = int32(attempts)
+
+	return amqp.Publishing{
+		ContentType:  s.delivery.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         s.delivery.Body,
+	}
+}
+
+func rabbitDeadLetter(msg amqp.Delivery, position int) DeadLetter {
+	id := msg.MessageId
+	if id == "" {
+		id = fmt.Sprintf("#%d", position)
+	}
+	deadAt, _ := msg.Headers[DeadLetteredHeader].(string)
+	return DeadLetter{
+		ID:             id,
+		Body:           msg.Body,
+		Attempts:       rabbitAttempts(msg.Headers),
+		DeadLetteredAt: deadAt,
+	}
+}
+
+func rabbitRetryQueue(name string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", name, delay)
+}
+
+func rabbitAttempts(headers amqp.Table) int {
+	switch v := headers[AttemptsHeader].(type) {
+	case int:
+		return v
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	default:
+		return 0
+	}
+}
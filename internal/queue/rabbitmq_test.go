@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/yarlKot1904/signer/internal/infra"
+)
+
+func TestRabbitMQConformance(t *testing.T) {
+	url := os.Getenv("QUEUE_TEST_RABBIT_URL")
+	if url == "" {
+		t.Skip("QUEUE_TEST_RABBIT_URL not set")
+	}
+
+	runConformance(t, func(t *testing.T, name string) Queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		conn, err := infra.NewRabbitMQ(ctx, "test", url, RabbitTopology(name, testRetryDelays))
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+			deleteRabbitQueues(t, url, name)
+		})
+		return NewRabbitMQ(conn, "test", name, testRetryDelays)
+	})
+}
+
+func deleteRabbitQueues(t *testing.T, url, name string) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		t.Logf("cleanup connect: %v", err)
+		return
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		t.Logf("cleanup channel: %v", err)
+		return
+	}
+	defer ch.Close()
+
+	queues := []string{name, DeadLetterName(name)}
+	for _, delay := range testRetryDelays {
+		queues = append(queues, rabbitRetryQueue(name, delay))
+	}
+	for _, q := range queues {
+		if _, err := ch.QueueDelete(q, false, false, false); err != nil {
+			t.Logf("cleanup %s: %v", q, err)
+		}
+	}
+}
+
+func TestRabbitRetryQueueName(t *testing.T) {
+	if got := rabbitRetryQueue(SignerTasks, 80*time.Second); got != "signer.tasks.retry.1m20s" {
+		t.Fatalf("unexpected retry queue: %s", got)
+	}
+}
+
+func TestRabbitAttempts(t *testing.T) {
+	if got := rabbitAttempts(nil); got != 0 {
+		t.Fatalf("expected 0 attempts without headers, got %d", got)
+	}
+	if got := rabbitAttempts(amqp.Table{AttemptsHeader: int32(3)}); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+	if got := rabbitAttempts(amqp.Table{AttemptsHeader: "3"}); got != 0 {
+		t.Fatalf("expected non-numeric header to be ignored, got %d", got)
+	}
+}
@@ -0,0 +1,348 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisGroup          = "signer"
+	redisBlock          = 2 * time.Second
+	redisErrorBackoff   = time.Second
+	redisPromoteEvery   = time.Second
+	redisPromoteBatch   = 100
+	redisDefaultIdle    = 5 * time.Minute
+	redisFieldBody      = "body"
+	redisFieldAttempts  = "attempts"
+	redisFieldDeadAt    = "dead_lettered_at"
+	redisFieldSourceID  = "source_id"
+	redisRetryKeySuffix = ".retry"
+)
+
+var promoteRetriesScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, member in ipairs(due) do
+  local first = string.find(member, '\n', 1, true)
+  local second = string.find(member, '\n', first + 1, true)
+  redis.call('XADD', KEYS[2], '*', 'body', string.sub(member, second + 1), 'attempts', string.sub(member, first + 1, second - 1))
+  redis.call('ZREM', KEYS[1], member)
+end
+return #due
+`)
+
+type RedisStreams struct {
+	rdb       *redis.Client
+	service   string
+	name      string
+	delays    []time.Duration
+	claimIdle time.Duration
+	consumer  string
+}
+
+func NewRedisStreams(rdb *redis.Client, service, name string, retryDelays []time.Duration, claimIdle time.Duration) *RedisStreams {
+	if claimIdle <= 0 {
+		claimIdle = redisDefaultIdle
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = service
+	}
+	return &RedisStreams{
+		rdb:       rdb,
+		service:   service,
+		name:      name,
+		delays:    retryDelays,
+		claimIdle: claimIdle,
+		consumer:  host + "-" + uuid.NewString()[:8],
+	}
+}
+
+func (q *RedisStreams) Name() string {
+	return q.name
+}
+
+func (q *RedisStreams) Backend() string {
+	return BackendRedis
+}
+
+func (q *RedisStreams) Publish(ctx context.Context, body []byte) error {
+	return q.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.name,
+		Values: []interface{}{redisFieldBody, string(body), redisFieldAttempts, 0},
+	}).Err()
+}
+
+func (q *RedisStreams) Consume(ctx context.Context, opts ConsumeOptions, handler Handler) error {
+	opts = normalizeOptions(opts)
+	if err := q.ensureGroup(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	pool := newWorkerPool(opts.Workers)
+	defer pool.stop()
+	go q.promoteRetries(ctx)
+
+	log.Printf("%s Redis stream consumer %s subscribed to %s (workers=%d prefetch=%d)", q.service, q.consumer, q.name, opts.Workers, opts.Prefetch)
+
+	lastClaim := time.Time{}
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var msgs []redis.XMessage
+		var err error
+		if time.Since(lastClaim) >= q.claimIdle/2 {
+			msgs, err = q.reclaim(ctx, opts.Prefetch)
+			lastClaim = time.Now()
+		}
+		if err == nil && len(msgs) == 0 {
+			msgs, err = q.read(ctx, opts.Prefetch)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				err = q.ensureGroup(ctx)
+			}
+			if err != nil {
+				log.Printf("%s Redis stream read from %s failed: %v", q.service, q.name, err)
+			}
+			if !sleepContext(ctx, redisErrorBackoff) {
+				return nil
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			d, ok := decodeRedisMessage(msg)
+			s := &redisSettler{q: q, id: msg.ID, delivery: d}
+			if !ok {
+				log.Printf("%s Redis stream %s dropping malformed entry %s", q.service, q.name, msg.ID)
+				_ = s.ack(ctx)
+				continue
+			}
+			if !pool.submit(ctx, func() {
+				handle(ctx, q.name, q.service, q.delays, opts, d, s, handler)
+			}) {
+				return nil
+			}
+		}
+	}
+}
+
+func (q *RedisStreams) DeadLetterDepth(ctx context.Context) (int, error) {
+	n, err := q.rdb.XLen(ctx, DeadLetterName(q.name)).Result()
+	return int(n), err
+}
+
+func (q *RedisStreams) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	msgs, err := q.rdb.XRangeN(ctx, DeadLetterName(q.name), "-", "+", int64(limit)).Result()
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(msgs))
+	for _, msg := range msgs {
+		d, _ := decodeRedisMessage(msg)
+		deadAt, _ := msg.Values[redisFieldDeadAt].(string)
+		letters = append(letters, DeadLetter{ID: msg.ID, Body: d.Body, Attempts: d.Attempts, DeadLetteredAt: deadAt})
+	}
+	return letters, nil
+}
+
+func (q *RedisStreams) ReplayDeadLetters(ctx context.Context, limit int) (int, error) {
+	msgs, err := q.rdb.XRangeN(ctx, DeadLetterName(q.name), "-", "+", int64(limit)).Result()
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, msg := range msgs {
+		d, _ := decodeRedisMessage(msg)
+		_, err := q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: q.name,
+				Values: []interface{}{redisFieldBody, string(d.Body), redisFieldAttempts, 0},
+			})
+			pipe.XDel(ctx, DeadLetterName(q.name), msg.ID)
+			return nil
+		})
+		if err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (q *RedisStreams) Close() error {
+	return nil
+}
+
+func (q *RedisStreams) ensureGroup(ctx context.Context) error {
+	err := q.rdb.XGroupCreateMkStream(ctx, q.name, redisGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("create consumer group: %w", err)
+	}
+	return nil
+}
+
+func (q *RedisStreams) read(ctx context.Context, count int) ([]redis.XMessage, error) {
+	streams, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisGroup,
+		Consumer: q.consumer,
+		Streams:  []string{q.name, ">"},
+		Count:    int64(count),
+		Block:    redisBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var msgs []redis.XMessage
+	for _, stream := range streams {
+		msgs = append(msgs, stream.Messages...)
+	}
+	return msgs, nil
+}
+
+func (q *RedisStreams) reclaim(ctx context.Context, count int) ([]redis.XMessage, error) {
+	msgs, _, err := q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.name,
+		Group:    redisGroup,
+		Consumer: q.consumer,
+		MinIdle:  q.claimIdle,
+		Start:    "0-0",
+		Count:    int64(count),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) > 0 {
+		log.Printf("%s Redis stream %s reclaimed %d stalled entries", q.service, q.name, len(msgs))
+	}
+	return msgs, nil
+}
+
+func (q *RedisStreams) promoteRetries(ctx context.Context) {
+	ticker := time.NewTicker(redisPromoteEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := promoteRetriesScript.Run(ctx, q.rdb,
+			[]string{q.name + redisRetryKeySuffix, q.name},
+			time.Now().UnixMilli(), redisPromoteBatch,
+		).Err()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("%s Redis stream %s retry promotion failed: %v", q.service, q.name, err)
+		}
+	}
+}
+
+type redisSettler struct {
+	q        *RedisStreams
+	id       string
+	delivery Delivery
+}
+
+func (s *redisSettler) ack(ctx context.Context) error {
+	_, err := s.q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		s.remove(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSettler) reject(ctx context.Context) error {
+	return s.ack(ctx)
+}
+
+func (s *redisSettler) requeue(ctx context.Context) error {
+	_, err := s.q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.q.name,
+			Values: []interface{}{redisFieldBody, string(s.delivery.Body), redisFieldAttempts, s.delivery.Attempts},
+		})
+		s.remove(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSettler) retry(ctx context.Context, attempts int, delay time.Duration) error {
+	_, err := s.q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, s.q.name+redisRetryKeySuffix, redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: encodeRedisRetry(uuid.NewString(), attempts, s.delivery.Body),
+		})
+		s.remove(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSettler) deadLetter(ctx context.Context, attempts int) error {
+	_, err := s.q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: DeadLetterName(s.q.name),
+			Values: []interface{}{
+				redisFieldBody, string(s.delivery.Body),
+				redisFieldAttempts, attempts,
+				redisFieldDeadAt, time.Now().UTC().Format(time.RFC3339),
+				redisFieldSourceID, s.id,
+			},
+		})
+		s.remove(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+func (s *redisSettler) remove(ctx context.Context, pipe redis.Pipeliner) {
+	pipe.XAck(ctx, s.q.name, redisGroup, s.id)
+	pipe.XDel(ctx, s.q.name, s.id)
+}
+
+func encodeRedisRetry(id string, attempts int, body []byte) string {
+	return id + "\n" + strconv.Itoa(attempts) + "\n" + string(body)
+}
+
+func decodeRedisMessage(msg redis.XMessage) (Delivery, bool) {
+	body, ok := msg.Values[redisFieldBody].(string)
+	if !ok {
+		return Delivery{}, false
+	}
+	attempts := 0
+	if raw, ok := msg.Values[redisFieldAttempts].(string); ok {
+		attempts, _ = strconv.Atoi(raw)
+	}
+	return Delivery{Body: []byte(body), Attempts: attempts}, true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis connects to QUEUE_TEST_REDIS_ADDR, or to an in-process
+// miniredis server when it is unset, so the Redis Streams suite always runs.
+func newTestRedis(t *testing.T) *redis.Client {
+	addr := os.Getenv("QUEUE_TEST_REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+func cleanupRedisQueue(t *testing.T, rdb *redis.Client, name string) {
+	t.Cleanup(func() {
+		_ = rdb.Del(context.Background(), name, DeadLetterName(name), name+redisRetryKeySuffix).Err()
+	})
+}
+
+func TestRedisStreamsConformance(t *testing.T) {
+	rdb := newTestRedis(t)
+
+	runConformance(t, func(t *testing.T, name string) Queue {
+		cleanupRedisQueue(t, rdb, name)
+		return NewRedisStreams(rdb, "test", name, testRetryDelays, time.Second)
+	})
+}
+
+func TestRedisStreamsReclaimsStalledEntries(t *testing.T) {
+	rdb := newTestRedis(t)
+	name := "signer.test." + uuid.NewString()
+	cleanupRedisQueue(t, rdb, name)
+
+	q := NewRedisStreams(rdb, "test", name, testRetryDelays, 500*time.Millisecond)
+	ctx := context.Background()
+	if err := q.ensureGroup(ctx); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	publish(t, q, `{"n":5}`)
+
+	crashed := NewRedisStreams(rdb, "test", name, testRetryDelays, 500*time.Millisecond)
+	msgs, err := crashed.read(ctx, 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("crashed consumer read: %v (%d messages)", err, len(msgs))
+	}
+
+	got := startConsumer(t, q, 3, func(Delivery) Action { return Ack })
+	if d := expectDelivery(t, got); d.body != `{"n":5}` {
+		t.Fatalf("unexpected reclaimed delivery: %+v", d)
+	}
+}
+
+func TestRedisRetryEncoding(t *testing.T) {
+	member := encodeRedisRetry("id", 2, []byte("{\"a\":\"x\\ny\"}"))
+	if member != "id\n2\n{\"a\":\"x\\ny\"}" {
+		t.Fatalf("unexpected member: %q", member)
+	}
+
+	d, ok := decodeRedisMessage(redis.XMessage{ID: "1-0", Values: map[string]interface{}{"body": "{}", "attempts": "2"}})
+	if !ok || string(d.Body) != "{}" || d.Attempts != 2 {
+		t.Fatalf("unexpected decode: %+v ok=%v", d, ok)
+	}
+	if _, ok := decodeRedisMessage(redis.XMessage{ID: "1-0", Values: map[string]interface{}{}}); ok {
+		t.Fatal("expected entry without body to be malformed")
+	}
+}
@@ -0,0 +1,157 @@
+package receipt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yarlKot1904/signer/internal/keyring"
+)
+
+const (
+	algorithm = "EdDSA"
+	tokenType = "verification-receipt+jwt"
+)
+
+var (
+	ErrInvalidKeys    = errors.New("invalid receipt signing keys")
+	ErrInvalidReceipt = errors.New("invalid verification receipt")
+)
+
+// Claims is the signed body of a receipt. Verification holds the verify
+// response exactly as it was returned to the caller.
+type Claims struct {
+	Issuer         string          `json:"iss"`
+	IssuedAt       int64           `json:"iat"`
+	DocumentSHA256 string          `json:"document_sha256"`
+	Verification   json.RawMessage `json:"verification"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// JWK is an Ed25519 public key in the OKP form of RFC 8037.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the Ed25519 keys used for receipts. New receipts are signed
+// with the first configured key; the others stay published and verifiable so
+// receipts issued before a rotation keep validating.
+type KeySet struct {
+	current string
+	order   []string
+	keys    map[string]ed25519.PrivateKey
+}
+
+// ParseKeys reads entries of the form <id>:<hex 32-byte seed>. It returns nil
+// when no keys are configured.
+func ParseKeys(entries []string) (*KeySet, error) {
+	parsed, err := keyring.Parse(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeys, err)
+	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
+	ks := &KeySet{current: parsed[0].ID, keys: map[string]ed25519.PrivateKey{}}
+	for _, entry := range parsed {
+		if len(entry.Secret) != ed25519.SeedSize {
+			return nil, fmt.Errorf("%w: key %s must be a %d-byte hex-encoded Ed25519 seed", ErrInvalidKeys, entry.ID, ed25519.SeedSize)
+		}
+		ks.keys[entry.ID] = ed25519.NewKeyFromSeed(entry.Secret)
+		ks.order = append(ks.order, entry.ID)
+	}
+	return ks, nil
+}
+
+// Sign returns the claims as a compact JWS.
+func (ks *KeySet) Sign(claims Claims) (string, error) {
+	head, err := json.Marshal(header{Alg: algorithm, Kid: ks.current, Typ: tokenType})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encode(head) + "." + encode(body)
+	sig := ed25519.Sign(ks.keys[ks.current], []byte(signingInput))
+	return signingInput + "." + encode(sig), nil
+}
+
+// Verify checks a compact JWS against the configured keys and returns its
+// claims.
+func (ks *KeySet) Verify(token string) (Claims, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrInvalidReceipt
+	}
+	headBytes, err := decode(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalidReceipt
+	}
+	var head header
+	if err := json.Unmarshal(headBytes, &head); err != nil || head.Alg != algorithm {
+		return Claims{}, ErrInvalidReceipt
+	}
+	key, ok := ks.keys[head.Kid]
+	if !ok {
+		return Claims{}, ErrInvalidReceipt
+	}
+	sig, err := decode(parts[2])
+	if err != nil {
+		return Claims{}, ErrInvalidReceipt
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(parts[0]+"."+parts[1]), sig) {
+		return Claims{}, ErrInvalidReceipt
+	}
+	body, err := decode(parts[1])
+	if err != nil {
+		return Claims{}, ErrInvalidReceipt
+	}
+	var claims Claims
+	if err := json.Unmarshal(body, &claims); err != nil {
+		return Claims{}, ErrInvalidReceipt
+	}
+	return claims, nil
+}
+
+// JWKS returns the public half of every configured key, current key first.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.order))}
+	for _, id := range ks.order {
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(ks.keys[id].Public().(ed25519.PublicKey)),
+			Kid: id,
+			Alg: algorithm,
+			Use: "sig",
+		})
+	}
+	return set
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
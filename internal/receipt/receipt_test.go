@@ -0,0 +1,113 @@
+package receipt
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testSeedA = "0000000000000000000000000000000000000000000000000000000000000001"
+	testSeedB = "0000000000000000000000000000000000000000000000000000000000000002"
+)
+
+func mustKeys(t *testing.T, entries ...string) *KeySet {
+	t.Helper()
+	ks, err := ParseKeys(entries)
+	if err != nil {
+		t.Fatalf("parse keys: %v", err)
+	}
+	return ks
+}
+
+func testClaims() Claims {
+	return Claims{
+		Issuer:         "http://signer.local",
+		IssuedAt:       1800000000,
+		DocumentSHA256: strings.Repeat("ab", 32),
+		Verification:   json.RawMessage(`{"status":"verified","service_owned":true}`),
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ks := mustKeys(t, "r1:"+testSeedA)
+	token, err := ks.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	claims, err := ks.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.DocumentSHA256 != testClaims().DocumentSHA256 || string(claims.Verification) != string(testClaims().Verification) {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	ks := mustKeys(t, "r1:"+testSeedA)
+	token, err := ks.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	parts := strings.Split(token, ".")
+
+	forged := testClaims()
+	forged.Verification = json.RawMessage(`{"status":"verified","service_owned":false}`)
+	body, _ := json.Marshal(forged)
+	for name, candidate := range map[string]string{
+		"payload":   parts[0] + "." + base64.RawURLEncoding.EncodeToString(body) + "." + parts[2],
+		"signature": parts[0] + "." + parts[1] + ".AAAA",
+		"alg none":  base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"r1"}`)) + "." + parts[1] + ".",
+		"truncated": parts[0] + "." + parts[1],
+	} {
+		if _, err := ks.Verify(candidate); !errors.Is(err, ErrInvalidReceipt) {
+			t.Fatalf("expected %s to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := mustKeys(t, "r1:"+testSeedA).Sign(testClaims())
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	rotated := mustKeys(t, "r2:"+testSeedB, "r1:"+testSeedA)
+	if _, err := rotated.Verify(old); err != nil {
+		t.Fatalf("expected receipt signed with the previous key to verify: %v", err)
+	}
+	if _, err := mustKeys(t, "r2:"+testSeedB).Verify(old); !errors.Is(err, ErrInvalidReceipt) {
+		t.Fatalf("expected receipt signed with a removed key to be rejected, got %v", err)
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "r2" || jwks.Keys[1].Kid != "r1" {
+		t.Fatalf("unexpected key set: %+v", jwks)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(jwks.Keys[1].X)
+	if err != nil || len(x) != ed25519.PublicKeySize {
+		t.Fatalf("bad public key: %q", jwks.Keys[1].X)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	if ks, err := ParseKeys(nil); ks != nil || err != nil {
+		t.Fatalf("expected no key set, got %v %v", ks, err)
+	}
+	for _, entries := range [][]string{
+		{"r1"},
+		{"r1:nothex"},
+		{"r1:" + strings.Repeat("00", 16)},
+		{"bad id:" + testSeedA},
+		{"r1:" + testSeedA, "r1:" + testSeedB},
+	} {
+		if _, err := ParseKeys(entries); !errors.Is(err, ErrInvalidKeys) {
+			t.Fatalf("expected %v to be rejected, got %v", entries, err)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package tokenpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultTTL = 24 * time.Hour
+	MinTTL     = time.Minute
+
+	MetadataMaxDownloads = "maxDownloads"
+	MetadataViewOnly     = "viewOnly"
+	MetadataExpiresIn    = "expiresIn"
+)
+
+type Route string
+
+const (
+	RouteDownload Route = "download"
+	RouteView     Route = "view"
+)
+
+type Decision string
+
+const (
+	Allowed   Decision = "ok"
+	Missing   Decision = "missing"
+	Revoked   Decision = "revoked"
+	ViewOnly  Decision = "view_only"
+	Exhausted Decision = "exhausted"
+)
+
+var ErrInvalidPolicy = errors.New("invalid token policy")
+
+// RevocationVersionKey counts revocations. The signer puts its value into
+// verification cache keys, so every revocation retires the cached results.
+const RevocationVersionKey = "verify:cache:revocations"
+
+// Policy is stored inside the doc:<token> metadata JSON so the downloader can
+// enforce it in the same Redis script that reads the metadata.
+type Policy struct {
+	MaxDownloads int        `json:"max_downloads,omitempty"`
+	ViewOnly     bool       `json:"view_only,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+var authorizeScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+  return {'revoked', ''}
+end
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+  return {'missing', ''}
+end
+local ok, meta = pcall(cjson.decode, raw)
+if not ok or type(meta) ~= 'table' then
+  return {'ok', raw}
+end
+if ARGV[1] == 'download' and meta['view_only'] == true then
+  return {'view_only', raw}
+end
+local max = tonumber(meta['max_downloads']) or 0
+if max > 0 and ARGV[2] ~= '1' then
+  local used = tonumber(redis.call('GET', KEYS[3]) or '0')
+  local metered = tonumber(redis.call('GET', KEYS[4]) or '0')
+  if used >= max and metered >= 0 then
+    return {'exhausted', raw}
+  end
+end
+if max > 0 and ARGV[2] == '1' then
+  local used = redis.call('INCR', KEYS[3])
+  if used == 1 then
+    local ttl = redis.call('PTTL', KEYS[1])
+    if ttl > 0 then
+      redis.call('PEXPIRE', KEYS[3], ttl)
+    end
+  end
+  if used > max then
+    redis.call('DECR', KEYS[3])
+    return {'exhausted', raw}
+  end
+end
+return {'ok', raw}
+`)
+
+// recordBytesScript meters bytes served outside counted requests in
+// doc:<token>:bytes. A counted request that stopped early leaves the rest of
+// the object as credit (a negative balance) for the ranges a viewer fetches
+// next; once uncounted bytes add up to the object size, they use up a download.
+var recordBytesScript = redis.NewScript(`
+local raw = redis.call('GET', KEYS[1])
+if not raw then
+  return 0
+end
+local ok, meta = pcall(cjson.decode, raw)
+if not ok or type(meta) ~= 'table' then
+  return 0
+end
+local max = tonumber(meta['max_downloads']) or 0
+if max <= 0 then
+  return 0
+end
+local size = tonumber(ARGV[2])
+local metered
+if ARGV[3] == '1' then
+  metered = redis.call('INCRBY', KEYS[3], tonumber(ARGV[1]) - size)
+else
+  metered = redis.call('INCRBY', KEYS[3], ARGV[1])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+  redis.call('PEXPIRE', KEYS[3], ttl)
+end
+local counted = 0
+local used = tonumber(redis.call('GET', KEYS[2]) or '0')
+while metered >= size and used < max do
+  used = redis.call('INCR', KEYS[2])
+  metered = redis.call('DECRBY', KEYS[3], size)
+  counted = counted + 1
+end
+if counted > 0 and ttl > 0 then
+  redis.call('PEXPIRE', KEYS[2], ttl)
+end
+return counted
+`)
+
+func New(maxDownloads int, viewOnly bool, expiresIn time.Duration, now time.Time, maxTTL time.Duration) (Policy, error) {
+	if maxDownloads < 0 {
+		return Policy{}, fmt.Errorf("%w: max downloads must not be negative", ErrInvalidPolicy)
+	}
+	if expiresIn == 0 {
+		expiresIn = DefaultTTL
+	}
+	if maxTTL < DefaultTTL {
+		maxTTL = DefaultTTL
+	}
+	if expiresIn < MinTTL || expiresIn > maxTTL {
+		return Policy{}, fmt.Errorf("%w: expiry must be between %s and %s", ErrInvalidPolicy, MinTTL, maxTTL)
+	}
+	expiresAt := now.UTC().Add(expiresIn)
+	return Policy{MaxDownloads: maxDownloads, ViewOnly: viewOnly, ExpiresAt: &expiresAt}, nil
+}
+
+func FromMetadata(metadata map[string]string, now time.Time, maxTTL time.Duration) (Policy, error) {
+	maxDownloads := 0
+	if raw := strings.TrimSpace(metadata[MetadataMaxDownloads]); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return Policy{}, fmt.Errorf("%w: %s must be an integer", ErrInvalidPolicy, MetadataMaxDownloads)
+		}
+		maxDownloads = n
+	}
+
+	viewOnly := false
+	if raw := strings.TrimSpace(metadata[MetadataViewOnly]); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return Policy{}, fmt.Errorf("%w: %s must be true or false", ErrInvalidPolicy, MetadataViewOnly)
+		}
+		viewOnly = b
+	}
+
+	expiresIn, err := ParseExpiresIn(metadata[MetadataExpiresIn])
+	if err != nil {
+		return Policy{}, err
+	}
+	return New(maxDownloads, viewOnly, expiresIn, now, maxTTL)
+}
+
+func ParseExpiresIn(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%w: expiry must be a duration such as 2h", ErrInvalidPolicy)
+	}
+	return d, nil
+}
+
+// TTL returns how long the doc:<token> key should live. Metadata written
+// before policies existed has no ExpiresAt and keeps the default lifetime.
+func (p Policy) TTL(now, createdAt time.Time) time.Duration {
+	if p.ExpiresAt == nil {
+		return DefaultTTL - now.Sub(createdAt)
+	}
+	return p.ExpiresAt.Sub(now)
+}
+
+func MetaKey(token string) string {
+	return "doc:" + token
+}
+
+func revokedKey(token string) string {
+	return "doc:" + token + ":revoked"
+}
+
+func downloadsKey(token string) string {
+	return "doc:" + token + ":downloads"
+}
+
+func bytesKey(token string) string {
+	return "doc:" + token + ":bytes"
+}
+
+func Authorize(ctx context.Context, rdb *redis.Client, token string, route Route, count bool) (string, Decision, error) {
+	countArg := "0"
+	if count {
+		countArg = "1"
+	}
+	res, err := authorizeScript.Run(ctx, rdb,
+		[]string{MetaKey(token), revokedKey(token), downloadsKey(token), bytesKey(token)},
+		string(route), countArg,
+	).StringSlice()
+	if err != nil {
+		return "", "", err
+	}
+	if len(res) != 2 {
+		return "", "", fmt.Errorf("unexpected policy script reply: %v", res)
+	}
+	return res[1], Decision(res[0]), nil
+}
+
+// RecordBytes meters sent bytes of an object of size bytes against a token
+// with a download limit. counted says whether the request already used up a
+// download in Authorize. It returns how many downloads the bytes used up.
+func RecordBytes(ctx context.Context, rdb *redis.Client, token string, sent, size int64, counted bool) (int, error) {
+	if size <= 0 {
+		return 0, nil
+	}
+	countArg := "0"
+	if counted {
+		countArg = "1"
+	}
+	return recordBytesScript.Run(ctx, rdb,
+		[]string{MetaKey(token), downloadsKey(token), bytesKey(token)},
+		sent, size, countArg,
+	).Int()
+}
+
+// Usage is the download counter state of a limited token, kept in the
+// documents table so it survives the loss of the Redis keys.
+type Usage struct {
+	Downloads    int
+	MeteredBytes int64
+}
+
+// restoreScript writes the metadata only when the key is missing, and then
+// raises the counters to the durable usage; counters Redis still holds are
+// never lowered.
+var restoreScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2], 'NX') then
+  return 0
+end
+local used = tonumber(redis.call('GET', KEYS[2]) or '0')
+if tonumber(ARGV[3]) > used then
+  redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[2])
+end
+if redis.call('EXISTS', KEYS[3]) == 0 and tonumber(ARGV[4]) ~= 0 then
+  redis.call('SET', KEYS[3], ARGV[4], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// Restore writes doc:<token> metadata and its download counters back from the
+// durable document record. An existing key wins so a concurrent upload
+// delivery is never overwritten.
+func Restore(ctx context.Context, rdb *redis.Client, token, meta string, ttl time.Duration, usage Usage) error {
+	return restoreScript.Run(ctx, rdb,
+		[]string{MetaKey(token), downloadsKey(token), bytesKey(token)},
+		meta, ttl.Milliseconds(), usage.Downloads, usage.MeteredBytes,
+	).Err()
+}
+
+// ReadUsage returns the Redis download counters of token.
+func ReadUsage(ctx context.Context, rdb *redis.Client, token string) (Usage, error) {
+	values, err := rdb.MGet(ctx, downloadsKey(token), bytesKey(token)).Result()
+	if err != nil {
+		return Usage{}, err
+	}
+	var usage Usage
+	if raw, ok := values[0].(string); ok {
+		if usage.Downloads, err = strconv.Atoi(raw); err != nil {
+			return Usage{}, err
+		}
+	}
+	if raw, ok := values[1].(string); ok {
+		if usage.MeteredBytes, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return Usage{}, err
+		}
+	}
+	return usage, nil
+}
+
+func Refund(ctx context.Context, rdb *redis.Client, token string) error {
+	key := downloadsKey(token)
+	n, err := rdb.Decr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return rdb.Set(ctx, key, 0, redis.KeepTTL).Err()
+	}
+	return nil
+}
+
+func Downloads(ctx context.Context, rdb *redis.Client, token string) (int, error) {
+	n, err := rdb.Get(ctx, downloadsKey(token)).Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func Revoke(ctx context.Context, rdb *redis.Client, token string, maxTTL time.Duration) error {
+	ttl, err := rdb.PTTL(ctx, MetaKey(token)).Result()
+	if err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		ttl = max(maxTTL, DefaultTTL)
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, revokedKey(token), time.Now().UTC().Format(time.RFC3339), ttl)
+		pipe.Incr(ctx, RevocationVersionKey)
+		return nil
+	})
+	return err
+}
+
+func RevocationVersion(ctx context.Context, rdb *redis.Client) (int64, error) {
+	n, err := rdb.Get(ctx, RevocationVersionKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func IsRevoked(ctx context.Context, rdb *redis.Client, token string) (bool, error) {
+	n, err := rdb.Exists(ctx, revokedKey(token)).Result()
+	return n > 0, err
+}
@@ -0,0 +1,252 @@
+package tokenpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNewDefaultsAndBounds(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	p, err := New(0, false, 0, now, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.ExpiresAt == nil || !p.ExpiresAt.Equal(now.Add(DefaultTTL)) {
+		t.Fatalf("expected default expiry, got %v", p.ExpiresAt)
+	}
+
+	if _, err := New(-1, false, 0, now, 7*24*time.Hour); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("expected negative limit to be rejected, got %v", err)
+	}
+	if _, err := New(0, false, 30*time.Second, now, 7*24*time.Hour); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("expected too short expiry to be rejected, got %v", err)
+	}
+	if _, err := New(0, false, 8*24*time.Hour, now, 7*24*time.Hour); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("expected too long expiry to be rejected, got %v", err)
+	}
+}
+
+func TestFromMetadata(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	p, err := FromMetadata(map[string]string{
+		MetadataMaxDownloads: "3",
+		MetadataViewOnly:     "true",
+		MetadataExpiresIn:    "2h",
+		"filename":           "contract.pdf",
+	}, now, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.MaxDownloads != 3 || !p.ViewOnly || !p.ExpiresAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("unexpected policy: %+v", p)
+	}
+
+	for _, md := range []map[string]string{
+		{MetadataMaxDownloads: "many"},
+		{MetadataViewOnly: "sometimes"},
+		{MetadataExpiresIn: "tomorrow"},
+	} {
+		if _, err := FromMetadata(md, now, 7*24*time.Hour); !errors.Is(err, ErrInvalidPolicy) {
+			t.Fatalf("expected %v to be rejected, got %v", md, err)
+		}
+	}
+}
+
+func TestPolicyTTL(t *testing.T) {
+	created := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := created.Add(time.Hour)
+
+	if got := (Policy{}).TTL(now, created); got != 23*time.Hour {
+		t.Fatalf("expected legacy metadata to keep the default lifetime, got %s", got)
+	}
+	expiresAt := created.Add(48 * time.Hour)
+	if got := (Policy{ExpiresAt: &expiresAt}).TTL(now, created); got != 47*time.Hour {
+		t.Fatalf("unexpected ttl: %s", got)
+	}
+}
+
+func newTestRedis(t *testing.T) *redis.Client {
+	addr := os.Getenv("TOKENPOLICY_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TOKENPOLICY_TEST_REDIS_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+func storeTestToken(t *testing.T, rdb *redis.Client, policy Policy) string {
+	t.Helper()
+	token := uuid.NewString()
+	data, _ := json.Marshal(struct {
+		S3Key string `json:"s3_key"`
+		Policy
+	}{S3Key: "2026/05/file", Policy: policy})
+	if err := rdb.Set(context.Background(), MetaKey(token), data, time.Minute).Err(); err != nil {
+		t.Fatalf("store token: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = rdb.Del(context.Background(), MetaKey(token), revokedKey(token), downloadsKey(token), bytesKey(token)).Err()
+	})
+	return token
+}
+
+func TestAuthorizeEnforcesDownloadLimit(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	token := storeTestToken(t, rdb, Policy{MaxDownloads: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, decision, err := Authorize(ctx, rdb, token, RouteDownload, true); err != nil || decision != Allowed {
+			t.Fatalf("download %d: decision=%s err=%v", i+1, decision, err)
+		}
+	}
+	if _, err := RecordBytes(ctx, rdb, token, 100, 1000, true); err != nil {
+		t.Fatalf("record bytes: %v", err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteView, false); decision != Allowed {
+		t.Fatalf("ranges within a stopped download must not be limited, got %s", decision)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, true); decision != Exhausted {
+		t.Fatalf("expected limit to be reached, got %s", decision)
+	}
+
+	if err := Refund(ctx, rdb, token); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, true); decision != Allowed {
+		t.Fatalf("expected refunded download to be allowed, got %s", decision)
+	}
+	if n, _ := Downloads(ctx, rdb, token); n != 2 {
+		t.Fatalf("expected 2 recorded downloads, got %d", n)
+	}
+}
+
+func TestRestoreCarriesUsage(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	token := storeTestToken(t, rdb, Policy{MaxDownloads: 2})
+	if _, decision, err := Authorize(ctx, rdb, token, RouteDownload, true); err != nil || decision != Allowed {
+		t.Fatalf("download: decision=%s err=%v", decision, err)
+	}
+	if _, err := RecordBytes(ctx, rdb, token, 300, 1000, false); err != nil {
+		t.Fatalf("record bytes: %v", err)
+	}
+	usage, err := ReadUsage(ctx, rdb, token)
+	if err != nil || usage != (Usage{Downloads: 1, MeteredBytes: 300}) {
+		t.Fatalf("unexpected usage %+v: %v", usage, err)
+	}
+
+	meta, _ := rdb.Get(ctx, MetaKey(token)).Result()
+	if err := rdb.Del(ctx, MetaKey(token), downloadsKey(token), bytesKey(token)).Err(); err != nil {
+		t.Fatalf("evict: %v", err)
+	}
+	if err := Restore(ctx, rdb, token, meta, time.Minute, Usage{Downloads: 2, MeteredBytes: 300}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, true); decision != Exhausted {
+		t.Fatalf("expected restored usage to keep the limit, got %s", decision)
+	}
+	if restored, _ := ReadUsage(ctx, rdb, token); restored != (Usage{Downloads: 2, MeteredBytes: 300}) {
+		t.Fatalf("unexpected restored usage %+v", restored)
+	}
+
+	if err := Restore(ctx, rdb, token, meta, time.Minute, Usage{}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if kept, _ := ReadUsage(ctx, rdb, token); kept.Downloads != 2 {
+		t.Fatalf("expected a live key to keep its counters, got %+v", kept)
+	}
+}
+
+func TestRecordBytesCountsRanges(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	const size = 1000
+
+	// bytes=-1000 on a 1000-byte file is the whole file.
+	token := storeTestToken(t, rdb, Policy{MaxDownloads: 1})
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, false); decision != Allowed {
+		t.Fatalf("expected the first suffix range to be allowed, got %s", decision)
+	}
+	if n, err := RecordBytes(ctx, rdb, token, size, size, false); err != nil || n != 1 {
+		t.Fatalf("expected a whole-file suffix range to use up a download, got %d %v", n, err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, false); decision != Exhausted {
+		t.Fatalf("expected further ranges to be refused, got %s", decision)
+	}
+
+	// bytes=1- followed by bytes=0-0 also adds up to the whole file.
+	token = storeTestToken(t, rdb, Policy{MaxDownloads: 1})
+	if n, err := RecordBytes(ctx, rdb, token, size-1, size, false); err != nil || n != 0 {
+		t.Fatalf("expected bytes=1- alone not to use up a download, got %d %v", n, err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, true); decision != Allowed {
+		t.Fatalf("expected bytes=0-0 to be counted, got %s", decision)
+	}
+	if _, err := RecordBytes(ctx, rdb, token, 1, size, true); err != nil {
+		t.Fatalf("record bytes: %v", err)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, false); decision != Exhausted {
+		t.Fatalf("expected another bytes=1- to be refused, got %s", decision)
+	}
+
+	// Repeated bytes=1- requests add up to downloads.
+	token = storeTestToken(t, rdb, Policy{MaxDownloads: 2})
+	counted := 0
+	for i := 0; i < 3; i++ {
+		if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, false); decision != Allowed {
+			t.Fatalf("request %d: expected to be allowed, got %s", i+1, decision)
+		}
+		n, err := RecordBytes(ctx, rdb, token, size-1, size, false)
+		if err != nil {
+			t.Fatalf("record bytes: %v", err)
+		}
+		counted += n
+	}
+	if counted != 2 {
+		t.Fatalf("expected three near-complete ranges to use up both downloads, got %d", counted)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, false); decision != Exhausted {
+		t.Fatalf("expected the limit to be reached, got %s", decision)
+	}
+}
+
+func TestAuthorizeViewOnlyAndRevocation(t *testing.T) {
+	rdb := newTestRedis(t)
+	ctx := context.Background()
+	token := storeTestToken(t, rdb, Policy{ViewOnly: true})
+
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteDownload, true); decision != ViewOnly {
+		t.Fatalf("expected download to be refused, got %s", decision)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteView, true); decision != Allowed {
+		t.Fatalf("expected view to be allowed, got %s", decision)
+	}
+
+	before, err := RevocationVersion(ctx, rdb)
+	if err != nil {
+		t.Fatalf("revocation version: %v", err)
+	}
+	if err := Revoke(ctx, rdb, token, DefaultTTL); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if after, _ := RevocationVersion(ctx, rdb); after != before+1 {
+		t.Fatalf("expected revocation version to move from %d, got %d", before, after)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, token, RouteView, true); decision != Revoked {
+		t.Fatalf("expected revoked token, got %s", decision)
+	}
+	if _, decision, _ := Authorize(ctx, rdb, uuid.NewString(), RouteView, true); decision != Missing {
+		t.Fatalf("expected unknown token to be missing, got %s", decision)
+	}
+}
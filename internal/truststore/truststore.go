@@ -0,0 +1,303 @@
+package truststore
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yarlKot1904/signer/internal/keyring"
+)
+
+// maxTenantLength bounds tenant directory names.
+const maxTenantLength = 64
+
+var ErrUnknownTenant = errors.New("unknown trust store tenant")
+
+// Extended key usages that mark a certificate as issued for signing
+// documents: RFC 9336 id-kp-documentSigning, Adobe Authentic Documents Trust
+// and Microsoft Document Signing. S/MIME certificates (emailProtection) are
+// accepted as well, since PDF signers commonly reuse them.
+var (
+	oidDocumentSigning          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 36}
+	oidAdobeAuthenticDocuments  = asn1.ObjectIdentifier{1, 2, 840, 113583, 1, 1, 5}
+	oidMicrosoftDocumentSigning = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 10, 3, 12}
+)
+
+// Certificate describes one element of a signer's certificate chain.
+type Certificate struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SHA256    string    `json:"sha256"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+}
+
+// Chain is the outcome of validating a signer certificate. Certificates runs
+// from the signer to the trust anchor when Trusted is set, and lists the
+// certificates found in the signature otherwise.
+type Chain struct {
+	Trusted      bool          `json:"trusted"`
+	Tenant       string        `json:"tenant,omitempty"`
+	Certificates []Certificate `json:"certificates"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Store holds the CA certificates accepted as trust anchors. Files directly in
+// the store directory apply to everyone; each subdirectory names a tenant whose
+// certificates are trusted in addition to the shared ones.
+type Store struct {
+	roots   *x509.CertPool
+	tenants map[string]*x509.CertPool
+	anchors int
+	version string
+}
+
+// Load reads PEM or DER certificates (.pem, .crt, .cer) from dir. It returns
+// nil when dir is empty.
+func Load(dir string) (*Store, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read trust store: %w", err)
+	}
+
+	s := &Store{roots: x509.NewCertPool(), tenants: map[string]*x509.CertPool{}}
+	var tenantDirs, fingerprints []string
+	for _, entry := range entries {
+		// Kubernetes volume mounts keep their real files in hidden directories.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if !keyring.ValidName(entry.Name(), maxTenantLength) {
+				return nil, fmt.Errorf("trust store tenant directory %q has an invalid name", entry.Name())
+			}
+			tenantDirs = append(tenantDirs, entry.Name())
+			continue
+		}
+		certs, err := addFile(s.roots, path)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint("", certs)...)
+	}
+
+	for _, tenant := range tenantDirs {
+		pool := s.roots.Clone()
+		files, err := os.ReadDir(filepath.Join(dir, tenant))
+		if err != nil {
+			return nil, fmt.Errorf("read trust store tenant %s: %w", tenant, err)
+		}
+		for _, file := range files {
+			if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			certs, err := addFile(pool, filepath.Join(dir, tenant, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			fingerprints = append(fingerprints, fingerprint(tenant, certs)...)
+		}
+		s.tenants[tenant] = pool
+	}
+
+	if len(fingerprints) == 0 {
+		return nil, fmt.Errorf("trust store %s contains no certificates", dir)
+	}
+	s.anchors = len(fingerprints)
+	sort.Strings(fingerprints)
+	sum := sha256.Sum256([]byte(strings.Join(fingerprints, "\n")))
+	s.version = hex.EncodeToString(sum[:8])
+	return s, nil
+}
+
+func (s *Store) Anchors() int {
+	return s.anchors
+}
+
+func (s *Store) Tenants() int {
+	return len(s.tenants)
+}
+
+// Version identifies the set of anchors and their tenants. It changes whenever
+// a certificate is added, removed or moved to another tenant.
+func (s *Store) Version() string {
+	return s.version
+}
+
+// CheckTenant reports whether tenant selects a known set of anchors. The empty
+// tenant selects the shared anchors.
+func (s *Store) CheckTenant(tenant string) error {
+	if tenant == "" {
+		return nil
+	}
+	if _, ok := s.tenants[tenant]; !ok {
+		return ErrUnknownTenant
+	}
+	return nil
+}
+
+// Evaluate validates a signer certificate chain given as base64 DER, signer
+// first, against the anchors of tenant at time now.
+func (s *Store) Evaluate(encoded []string, tenant string, now time.Time) Chain {
+	result := Chain{Tenant: tenant, Certificates: []Certificate{}}
+	roots := s.roots
+	if tenant != "" {
+		pool, ok := s.tenants[tenant]
+		if !ok {
+			result.Error = ErrUnknownTenant.Error()
+			return result
+		}
+		roots = pool
+	}
+
+	certs := make([]*x509.Certificate, 0, len(encoded))
+	for _, value := range encoded {
+		der, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			result.Error = "signature certificates could not be decoded"
+			return result
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			result.Error = "signature certificates could not be parsed"
+			return result
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		result.Error = "signature contains no certificates"
+		return result
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		result.Certificates = describe(certs)
+		result.Error = err.Error()
+		return result
+	}
+	if err := checkSigningUsage(certs[0]); err != nil {
+		result.Certificates = describe(certs)
+		result.Error = err.Error()
+		return result
+	}
+	result.Trusted = true
+	result.Certificates = describe(chains[0])
+	return result
+}
+
+// checkSigningUsage rejects signer certificates that were not issued for
+// signatures, such as TLS server certificates: the key usage must allow
+// digitalSignature or contentCommitment, unless a document-signing extended
+// key usage vouches for the certificate, and any listed extended key usages
+// must include one for documents.
+func checkSigningUsage(cert *x509.Certificate) error {
+	documentEKU := hasDocumentSigningEKU(cert)
+	if len(cert.ExtKeyUsage)+len(cert.UnknownExtKeyUsage) > 0 && !documentEKU {
+		return errors.New("signer certificate is not issued for document signing")
+	}
+	signingKU := cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment) != 0
+	if (cert.KeyUsage != 0 || !documentEKU) && !signingKU {
+		return errors.New("signer certificate key usage does not allow signatures")
+	}
+	return nil
+}
+
+func hasDocumentSigningEKU(cert *x509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageAny || usage == x509.ExtKeyUsageEmailProtection {
+			return true
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		if oid.Equal(oidDocumentSigning) || oid.Equal(oidAdobeAuthenticDocuments) || oid.Equal(oidMicrosoftDocumentSigning) {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(certs []*x509.Certificate) []Certificate {
+	out := make([]Certificate, 0, len(certs))
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		out = append(out, Certificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			SHA256:    hex.EncodeToString(sum[:]),
+			NotBefore: cert.NotBefore.UTC(),
+			NotAfter:  cert.NotAfter.UTC(),
+		})
+	}
+	return out
+}
+
+func fingerprint(tenant string, certs []*x509.Certificate) []string {
+	out := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		out = append(out, tenant+"/"+hex.EncodeToString(sum[:]))
+	}
+	return out
+}
+
+func addFile(pool *x509.CertPool, path string) ([]*x509.Certificate, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pem", ".crt", ".cer":
+	default:
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read trust anchor: %w", err)
+	}
+
+	var added []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse trust anchor %s: %w", path, err)
+		}
+		pool.AddCert(cert)
+		added = append(added, cert)
+	}
+	if len(added) == 0 {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, fmt.Errorf("trust anchor %s holds no PEM or DER certificate", path)
+		}
+		pool.AddCert(cert)
+		added = append(added, cert)
+	}
+	return added, nil
+}
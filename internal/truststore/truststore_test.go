@@ -0,0 +1,217 @@
+package truststore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	return newTestCertWith(t, cn, parent, isCA, nil)
+}
+
+func newTestCertWith(t *testing.T, cn string, parent *testCert, isCA bool, adjust func(*x509.Certificate)) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             testNow.Add(-time.Hour),
+		NotAfter:              testNow.Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if adjust != nil {
+		adjust(tmpl)
+	}
+	signerCert, signerKey := tmpl, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func writePEM(t *testing.T, path string, certs ...*testCert) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func encodeChain(certs ...*testCert) []string {
+	out := make([]string, 0, len(certs))
+	for _, c := range certs {
+		out = append(out, base64.StdEncoding.EncodeToString(c.cert.Raw))
+	}
+	return out
+}
+
+func TestEvaluate(t *testing.T) {
+	root := newTestCert(t, "Shared Root", nil, true)
+	intermediate := newTestCert(t, "Shared Intermediate", root, true)
+	leaf := newTestCert(t, "signer@example.com", intermediate, false)
+	tenantRoot := newTestCert(t, "Tenant Root", nil, true)
+	tenantLeaf := newTestCert(t, "tenant@example.com", tenantRoot, false)
+
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "shared.pem"), root)
+	writePEM(t, filepath.Join(dir, "acme", "root.crt"), tenantRoot)
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("ignored"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	store, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if store.Anchors() != 2 || store.Tenants() != 1 {
+		t.Fatalf("unexpected store: anchors=%d tenants=%d", store.Anchors(), store.Tenants())
+	}
+
+	chain := store.Evaluate(encodeChain(leaf, intermediate), "", testNow)
+	if !chain.Trusted || len(chain.Certificates) != 3 || chain.Certificates[2].Subject != "CN=Shared Root" {
+		t.Fatalf("expected chain to the shared root, got %+v", chain)
+	}
+
+	if chain := store.Evaluate(encodeChain(leaf), "", testNow); chain.Trusted || chain.Error == "" {
+		t.Fatalf("expected a missing intermediate to fail, got %+v", chain)
+	}
+	if chain := store.Evaluate(encodeChain(leaf, intermediate), "", testNow.Add(48*time.Hour)); chain.Trusted {
+		t.Fatalf("expected an expired chain to fail, got %+v", chain)
+	}
+
+	if chain := store.Evaluate(encodeChain(tenantLeaf), "", testNow); chain.Trusted {
+		t.Fatalf("expected tenant anchors to stay out of the shared pool, got %+v", chain)
+	}
+	if chain := store.Evaluate(encodeChain(tenantLeaf), "acme", testNow); !chain.Trusted || chain.Tenant != "acme" {
+		t.Fatalf("expected tenant chain to be trusted, got %+v", chain)
+	}
+	if chain := store.Evaluate(encodeChain(leaf, intermediate), "acme", testNow); !chain.Trusted {
+		t.Fatalf("expected tenants to inherit shared anchors, got %+v", chain)
+	}
+
+	if err := store.CheckTenant("other"); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("expected unknown tenant, got %v", err)
+	}
+	if chain := store.Evaluate([]string{"not base64!"}, "", testNow); chain.Trusted || chain.Error == "" {
+		t.Fatalf("expected bad input to fail, got %+v", chain)
+	}
+}
+
+func TestEvaluateRequiresSigningUsage(t *testing.T) {
+	root := newTestCert(t, "Shared Root", nil, true)
+	dir := t.TempDir()
+	writePEM(t, filepath.Join(dir, "shared.pem"), root)
+	store, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		adjust  func(*x509.Certificate)
+		trusted bool
+	}{
+		{"tls server", func(c *x509.Certificate) {
+			c.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+			c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		}, false},
+		{"key encipherment only", func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageKeyEncipherment }, false},
+		{"no usages", func(c *x509.Certificate) { c.KeyUsage = 0 }, false},
+		{"content commitment", func(c *x509.Certificate) { c.KeyUsage = x509.KeyUsageContentCommitment }, true},
+		{"s/mime", func(c *x509.Certificate) {
+			c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+		}, true},
+		{"document signing eku", func(c *x509.Certificate) {
+			c.KeyUsage = 0
+			c.UnknownExtKeyUsage = []asn1.ObjectIdentifier{oidDocumentSigning}
+		}, true},
+	}
+	for _, tc := range cases {
+		leaf := newTestCertWith(t, tc.name, root, false, tc.adjust)
+		chain := store.Evaluate(encodeChain(leaf), "", testNow)
+		if chain.Trusted != tc.trusted || (!tc.trusted && chain.Error == "") {
+			t.Errorf("%s: got %+v, want trusted=%v", tc.name, chain, tc.trusted)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	if store, err := Load(""); store != nil || err != nil {
+		t.Fatalf("expected no store, got %v %v", store, err)
+	}
+	if _, err := Load(t.TempDir()); err == nil {
+		t.Fatal("expected an empty trust store to be rejected")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a certificate"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Fatal("expected an unreadable anchor to be rejected")
+	}
+
+	dir = t.TempDir()
+	root := newTestCert(t, "DER Root", nil, true)
+	if err := os.WriteFile(filepath.Join(dir, "root.cer"), root.cert.Raw, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "..data"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	store, err := Load(dir)
+	if err != nil || store.Anchors() != 1 || store.Tenants() != 0 {
+		t.Fatalf("expected one DER anchor, got %v %v", store, err)
+	}
+
+	writePEM(t, filepath.Join(dir, "acme", "root.pem"), root)
+	tenantStore, err := Load(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if again, _ := Load(dir); again.Version() != tenantStore.Version() {
+		t.Fatalf("expected a stable version, got %s and %s", again.Version(), tenantStore.Version())
+	}
+	if tenantStore.Version() == store.Version() {
+		t.Fatalf("expected a new tenant anchor to change the version %s", store.Version())
+	}
+}
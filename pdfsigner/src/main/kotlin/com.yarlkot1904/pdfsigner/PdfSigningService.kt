@@ -43,6 +43,7 @@ import java.security.cert.CertificateException
 import java.security.cert.X509Certificate
 import java.time.Duration
 import java.time.Instant
+import java.util.Base64
 import java.util.Calendar
 import java.util.concurrent.TimeUnit
 
@@ -57,7 +58,9 @@ data class VerificationResult(
     val certificateSelfSigned: Boolean? = null,
     val certificateSha256: String? = null,
     val certificateTrusted: Boolean? = null,
-    val error: String? = null
+    val certificateChain: List<String>? = null,
+    val error: String? = null,
+    val signatures: List<SignatureDetails> = emptyList()
 ) {
     companion object {
         fun error(message: String): VerificationResult = VerificationResult(
@@ -69,6 +72,26 @@ data class VerificationResult(
     }
 }
 
+/**
+ * One signature dictionary of the PDF, in document order. The top-level
+ * [VerificationResult] fields summarise the first of these.
+ */
+@JsonNaming(PropertyNamingStrategies.SnakeCaseStrategy::class)
+data class SignatureDetails(
+    val index: Int,
+    val status: String,
+    val integrityValid: Boolean,
+    val signerSubject: String? = null,
+    val signerCn: String? = null,
+    val signingTime: String? = null,
+    val byteRange: List<Long> = emptyList(),
+    val coversWholeDocument: Boolean = false,
+    val certificateSelfSigned: Boolean? = null,
+    val certificateSha256: String? = null,
+    val certificateChain: List<String>? = null,
+    val error: String? = null
+)
+
 @Service
 class PdfSigningService(
     private val registry: MeterRegistry
@@ -196,66 +219,23 @@ class PdfSigningService(
                     return verification
                 }
 
-                val signature = signatures.first()
-                val contents = signature.getContents(pdfBytes)
-                val signedContent = signature.getSignedContent(pdfBytes)
-                val cms = try {
-                    CMSSignedData(CMSProcessableByteArray(signedContent), contents)
-                } catch (e: CMSException) {
-                    logger.warn("Failed to parse CMS signature payload", e)
-                    val verification = invalidSignature(signature, "Malformed CMS signature content")
-                    status = verification.status
-                    return verification
-                } catch (e: IllegalArgumentException) {
-                    logger.warn("Failed to decode CMS signature payload", e)
-                    val verification = invalidSignature(signature, "Malformed CMS signature content")
-                    status = verification.status
-                    return verification
-                }
-                val signerInfo = cms.signerInfos.signers.firstOrNull()
-                if (signerInfo == null) {
-                    val verification = invalidSignature(signature, "No signer info present")
-                    status = verification.status
-                    return verification
-                }
-
-                @Suppress("UNCHECKED_CAST")
-                val matches = cms.certificates.getMatches(signerInfo.sid as Selector<X509CertificateHolder>)
-                val certHolder = matches.firstOrNull() as? X509CertificateHolder
-                if (certHolder == null) {
-                    val verification = invalidSignature(signature, "Signer certificate not found")
-                    status = verification.status
-                    return verification
+                val details = signatures.mapIndexed { index, signature ->
+                    verifySignature(index, signature, pdfBytes)
                 }
-                val cert = JcaX509CertificateConverter()
-                    .setProvider(BouncyCastleProvider.PROVIDER_NAME)
-                    .getCertificate(certHolder)
-
-                val integrityValid = signerInfo.verify(
-                    JcaSimpleSignerInfoVerifierBuilder()
-                        .setProvider(BouncyCastleProvider.PROVIDER_NAME)
-                        .build(cert)
-                )
-
-                val subject = cert.subjectX500Principal.name
-                val certHash = sha256Hex(cert.encoded)
-                logger.info(
-                    "Verification result: integrityValid={}, subject={}, certSha256={}",
-                    integrityValid,
-                    subject,
-                    certHash
-                )
+                val first = details.first()
                 val verification = VerificationResult(
-                    status = if (integrityValid) "verified" else "invalid_signature",
+                    status = first.status,
                     signaturePresent = true,
-                    integrityValid = integrityValid,
-                    signerSubject = subject,
-                    signerCn = extractEmailFromSubject(subject) ?: extractCn(subject),
-                    signingTime = signature.signDate?.toInstant()?.toString(),
-                    certificateSelfSigned = isSelfSigned(cert),
-                    certificateSha256 = certHash,
+                    integrityValid = first.integrityValid,
+                    signerSubject = first.signerSubject,
+                    signerCn = first.signerCn,
+                    signingTime = first.signingTime,
+                    certificateSelfSigned = first.certificateSelfSigned,
+                    certificateSha256 = first.certificateSha256,
                     certificateTrusted = null,
-                    error = if (integrityValid) null else "Signature integrity check failed"
+                    certificateChain = first.certificateChain,
+                    error = first.error,
+                    signatures = details
                 )
                 status = verification.status
                 return verification
@@ -266,6 +246,76 @@ class PdfSigningService(
         }
     }
 
+    private fun verifySignature(index: Int, signature: PDSignature, pdfBytes: ByteArray): SignatureDetails {
+        val byteRange = signature.byteRange?.map { it.toLong() } ?: emptyList()
+        val coversWholeDocument = byteRange.size == 4 &&
+            byteRange[0] == 0L &&
+            byteRange[2] + byteRange[3] == pdfBytes.size.toLong()
+
+        fun invalid(message: String) = SignatureDetails(
+            index = index,
+            status = "invalid_signature",
+            integrityValid = false,
+            signingTime = signature.signDate?.toInstant()?.toString(),
+            byteRange = byteRange,
+            coversWholeDocument = coversWholeDocument,
+            error = message
+        )
+
+        val contents = signature.getContents(pdfBytes)
+        val signedContent = signature.getSignedContent(pdfBytes)
+        val cms = try {
+            CMSSignedData(CMSProcessableByteArray(signedContent), contents)
+        } catch (e: CMSException) {
+            logger.warn("Failed to parse CMS signature payload: index={}", index, e)
+            return invalid("Malformed CMS signature content")
+        } catch (e: IllegalArgumentException) {
+            logger.warn("Failed to decode CMS signature payload: index={}", index, e)
+            return invalid("Malformed CMS signature content")
+        }
+        val signerInfo = cms.signerInfos.signers.firstOrNull()
+            ?: return invalid("No signer info present")
+
+        @Suppress("UNCHECKED_CAST")
+        val matches = cms.certificates.getMatches(signerInfo.sid as Selector<X509CertificateHolder>)
+        val certHolder = matches.firstOrNull() as? X509CertificateHolder
+            ?: return invalid("Signer certificate not found")
+        val cert = JcaX509CertificateConverter()
+            .setProvider(BouncyCastleProvider.PROVIDER_NAME)
+            .getCertificate(certHolder)
+
+        val integrityValid = signerInfo.verify(
+            JcaSimpleSignerInfoVerifierBuilder()
+                .setProvider(BouncyCastleProvider.PROVIDER_NAME)
+                .build(cert)
+        )
+
+        val subject = cert.subjectX500Principal.name
+        val certHash = sha256Hex(cert.encoded)
+        logger.info(
+            "Verification result: index={}, integrityValid={}, coversWholeDocument={}, subject={}, certSha256={}",
+            index,
+            integrityValid,
+            coversWholeDocument,
+            subject,
+            certHash
+        )
+        return SignatureDetails(
+            index = index,
+            status = if (integrityValid) "verified" else "invalid_signature",
+            integrityValid = integrityValid,
+            signerSubject = subject,
+            signerCn = extractEmailFromSubject(subject) ?: extractCn(subject),
+            signingTime = signature.signDate?.toInstant()?.toString(),
+            byteRange = byteRange,
+            coversWholeDocument = coversWholeDocument,
+            certificateSelfSigned = isSelfSigned(cert),
+            certificateSha256 = certHash,
+            certificateChain = certificateChain(certHolder, cms.certificates),
+            error = if (integrityValid) null else "Signature integrity check failed"
+        )
+    }
+
     private fun extractEmailFromSubject(subject: String): String? {
         val cnMatch = Regex("""CN=([^,]+)""").find(subject)?.groupValues?.getOrNull(1)?.trim()
         if (!cnMatch.isNullOrBlank() && cnMatch.contains("@")) return cnMatch
@@ -415,15 +465,20 @@ class PdfSigningService(
         }
     }
 
-    private fun invalidSignature(signature: PDSignature, message: String): VerificationResult =
-        VerificationResult(
-            status = "invalid_signature",
-            signaturePresent = true,
-            integrityValid = false,
-            signingTime = signature.signDate?.toInstant()?.toString(),
-            error = message,
-            certificateTrusted = null
-        )
+    /**
+     * Signer certificate first, then every other certificate embedded in the
+     * CMS, as base64 DER. The signer service builds and validates the chain.
+     */
+    private fun certificateChain(
+        signerCert: X509CertificateHolder,
+        store: Store<X509CertificateHolder>
+    ): List<String> {
+        val encoder = Base64.getEncoder()
+        val others = store.getMatches(null)
+            .filter { it != signerCert }
+            .map { encoder.encodeToString(it.encoded) }
+        return listOf(encoder.encodeToString(signerCert.encoded)) + others
+    }
 
     private fun isSelfSigned(cert: X509Certificate): Boolean {
         if (cert.subjectX500Principal != cert.issuerX500Principal) {
@@ -42,8 +42,30 @@ class PdfSigningServiceTest {
         assertNotNull(result.signerSubject)
         assertEquals("user@example.com", result.signerCn)
         assertEquals(true, result.certificateSelfSigned)
+        assertEquals(1, result.certificateChain?.size)
         assertNotNull(result.signingTime)
         assertEquals(null, result.error)
+
+        val signature = result.signatures.single()
+        assertEquals("verified", signature.status)
+        assertEquals(4, signature.byteRange.size)
+        assertTrue(signature.coversWholeDocument)
+        assertEquals(result.certificateSha256, signature.certificateSha256)
+    }
+
+    @Test
+    fun `verify reports bytes appended after signing`() {
+        val (certPem, keyPem) = createSigningMaterial("user@example.com")
+        val signedPdf = service.signPdf(createPdf("Hello Signer"), certPem, keyPem, "test-document-id")
+        val extendedPdf = signedPdf + "\n% appended after signing\n".toByteArray()
+
+        val result = service.verifyPdf(extendedPdf)
+
+        assertEquals("verified", result.status)
+        val signature = result.signatures.single()
+        assertTrue(signature.integrityValid)
+        assertFalse(signature.coversWholeDocument)
+        assertEquals(signedPdf.size.toLong(), signature.byteRange[2] + signature.byteRange[3])
     }
 
     @Test
@@ -67,6 +89,7 @@ class PdfSigningServiceTest {
         assertFalse(result.integrityValid)
         assertEquals(null, result.signerSubject)
         assertEquals(null, result.signingTime)
+        assertTrue(result.signatures.isEmpty())
     }
 
     @Test